@@ -28,6 +28,26 @@ type Config struct {
 	// streamReader 是配置文件的读取器
 	// streamReader is the reader of the configuration file
 	streamReader io.Reader
+
+	// streams 是追加的配置流，按顺序合并到 streamReader 之上
+	// streams are the additional config streams, merged in order on top of streamReader
+	streams []*stream
+
+	// template 是模板预处理的选项，为空表示不进行模板预处理
+	// template is the options of template pre-processing, nil means no template pre-processing
+	template *templateOptions
+}
+
+// stream 是一个追加的配置流，包含读取器和它的文件格式
+// stream is an additional config stream, which includes the reader and its file format
+type stream struct {
+	// reader 是配置流的读取器
+	// reader is the reader of the config stream
+	reader io.Reader
+
+	// fileType 是配置流的文件格式，为空时使用配置的文件格式
+	// fileType is the file format of the config stream, the config file format is used when it is empty
+	fileType string
 }
 
 // NewConfig 返回一个带有默认值的新配置，包括默认的搜索路径、文件名、文件格式和读取器
@@ -93,6 +113,31 @@ func (c *Config) SetReader(reader io.Reader) *Config {
 	return c
 }
 
+// AddReader 追加一个包含配置数据的读取器，它会在加载时按添加顺序合并到 SetReader 设置的读取器之上
+// AddReader appends a reader which contains config data, it is merged in the order of addition on top of the reader set by SetReader when loading
+func (c *Config) AddReader(reader io.Reader, fileFormat string) *Config {
+	// 如果读取器为空，直接返回
+	// If the reader is nil, return directly
+	if reader == nil {
+		return c
+	}
+
+	// 将文件格式转换为小写并去除两端的空格
+	// Convert the file format to lowercase and trim the spaces at both ends
+	fileFormat = strings.ToLower(strings.TrimSpace(fileFormat))
+
+	// 如果文件格式不为空且不被支持，直接返回
+	// If the file format is not empty and not supported, return directly
+	if fileFormat != "" && !isConfigTypeSupported(fileFormat) {
+		return c
+	}
+
+	// 追加配置流
+	// Append the config stream
+	c.streams = append(c.streams, &stream{reader: reader, fileType: fileFormat})
+	return c
+}
+
 // DefaultConfig 返回一个带有默认值的新配置
 // DefaultConfig returns a new config with default values
 func DefaultConfig() *Config {
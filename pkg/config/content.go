@@ -3,7 +3,10 @@ package config
 import (
 	"bytes"
 	"io"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -18,6 +21,22 @@ type Content struct {
 	// viper 是 viper 对象，用于处理配置文件
 	// viper is the viper object, used for handling configuration files
 	viper *viper.Viper
+
+	// mu 保护 viper 对象和来源记录
+	// mu protects the viper object and the source records
+	mu sync.RWMutex
+
+	// prov 记录了每个配置键的来源
+	// prov records the source of each config key
+	prov *provenance
+
+	// lastLoadTime 是最近一次加载配置文件的时间
+	// lastLoadTime is the time of the last loading of the config file
+	lastLoadTime time.Time
+
+	// lastLoadErr 是最近一次加载配置文件的错误
+	// lastLoadErr is the error of the last loading of the config file
+	lastLoadErr error
 }
 
 // NewContent 创建一个新的 Content 实例
@@ -50,6 +69,7 @@ func NewContent(config *Config) *Content {
 	return &Content{
 		config: config,
 		viper:  viper,
+		prov:   newProvenance(),
 	}
 }
 
@@ -61,10 +81,19 @@ func (c *Content) GetViper() *viper.Viper {
 
 // LoadFromFile 从文件中加载配置数据
 // LoadFromFile loads configuration data from a file
-func (c *Content) LoadFromFile(data any, opts ...viper.DecoderConfigOption) error {
+func (c *Content) LoadFromFile(data any, opts ...viper.DecoderConfigOption) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 记录本次加载的时间和结果
+	// record the time and result of this loading
+	defer func() {
+		c.lastLoadTime, c.lastLoadErr = time.Now(), err
+	}()
+
 	// 读取配置文件
 	// read config file
-	if err := c.viper.ReadInConfig(); err != nil {
+	if err := c.readFile(); err != nil {
 		return err
 	}
 
@@ -79,6 +108,47 @@ func (c *Content) LoadFromFile(data any, opts ...viper.DecoderConfigOption) erro
 	return nil
 }
 
+// LastLoad 返回最近一次加载配置文件的时间和错误，从未加载时返回零值时间
+// LastLoad returns the time and error of the last loading of the config file, the zero time is returned if it has never been loaded
+func (c *Content) LastLoad() (time.Time, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastLoadTime, c.lastLoadErr
+}
+
+// readFile 读取配置文件到 viper 中，并记录每个键的来源，调用者必须持有写锁
+// readFile reads the config file into viper and records the source of each key, the caller must hold the write lock
+func (c *Content) readFile() error {
+	// 读取配置文件的内容
+	// read the content of the config file
+	fileName := c.viper.ConfigFileUsed()
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	// 渲染配置文件模板
+	// render the config file template
+	content, sourceLines, err := renderTemplateLines(c.config, fileName, content)
+	if err != nil {
+		return err
+	}
+
+	// 读取配置文件
+	// read config file
+	if err := c.viper.ReadConfig(bytes.NewReader(content)); err != nil {
+		return err
+	}
+
+	// 记录配置文件中每个键的来源
+	// record the source of each key in the config file
+	c.recordFile(fileName, content, sourceLines)
+
+	// 成功
+	// success
+	return nil
+}
+
 // SaveToFile 将配置保存到文件
 // SaveToFile saves the configuration to a file
 func (c *Content) SaveToFile() error {
@@ -132,20 +202,62 @@ func (c *StreamContent) GetViper() *viper.Viper {
 	return c.viper
 }
 
-// LoadFromStream 从流中加载配置数据
-// LoadFromStream loads configuration data from a stream
+// LoadFromStream 从流中加载配置数据，SetReader 设置的读取器作为基础，AddReader 追加的读取器按顺序合并到其上
+// LoadFromStream loads configuration data from a stream, the reader set by SetReader is the base, and the readers added by AddReader are merged on top of it in order
 func (c *StreamContent) LoadFromStream(data any, opts ...viper.DecoderConfigOption) error {
-	// 从 io.Reader 读取所有字节
-	// read all bytes from io.Reader
-	content, err := io.ReadAll(c.config.streamReader)
-	if err != nil {
-		return err
+	// 加载结束后恢复配置文件的类型，保证保存时使用配置的文件格式
+	// Restore the type of the config file after loading, so that the configured file format is used when saving
+	defer c.viper.SetConfigType(c.config.fileType)
+
+	// 标记是否已经读取了第一个流
+	// Mark whether the first stream has been read
+	loaded := false
+
+	// 读取基础流
+	// read the base stream
+	if c.config.streamReader != nil {
+		content, err := io.ReadAll(c.config.streamReader)
+		if err != nil {
+			return err
+		}
+
+		// 重置流读取器
+		// reset stream reader
+		c.config.streamReader = bytes.NewReader(content)
+
+		// 基础流为空且存在追加的流时跳过它，由第一个追加的流作为基础
+		// Skip the base stream when it is empty and there are additional streams, the first additional stream becomes the base
+		if len(bytes.TrimSpace(content)) > 0 || len(c.config.streams) == 0 {
+			if err := c.readStream(content, c.config.fileType, loaded); err != nil {
+				return err
+			}
+			loaded = true
+		}
 	}
 
-	// 从 io.Reader 读取内容
-	// read content from io.Reader
-	if err := c.viper.ReadConfig(bytes.NewReader(content)); err != nil {
-		return err
+	// 按顺序合并追加的流
+	// merge the additional streams in order
+	for _, s := range c.config.streams {
+		// 如果流没有指定格式，使用配置的文件格式
+		// If the stream has no format, use the configured file format
+		fileType := s.fileType
+		if fileType == "" {
+			fileType = c.config.fileType
+		}
+
+		content, err := io.ReadAll(s.reader)
+		if err != nil {
+			return err
+		}
+
+		// 重置流读取器
+		// reset stream reader
+		s.reader = bytes.NewReader(content)
+
+		if err := c.readStream(content, fileType, loaded); err != nil {
+			return err
+		}
+		loaded = true
 	}
 
 	// 反序列化配置文件数据
@@ -154,15 +266,33 @@ func (c *StreamContent) LoadFromStream(data any, opts ...viper.DecoderConfigOpti
 		return err
 	}
 
-	// 重置流读取器
-	// reset stream reader
-	c.config.streamReader = bytes.NewReader(content)
-
 	// 成功
 	// success
 	return nil
 }
 
+// readStream 按给定的格式将一个流的内容读入或合并到 viper 中
+// readStream reads or merges the content of a stream into viper with the given format
+func (c *StreamContent) readStream(content []byte, fileType string, merge bool) error {
+	// 渲染配置流模板
+	// render the config stream template
+	rendered, err := renderTemplate(c.config, "stream", content)
+	if err != nil {
+		return err
+	}
+
+	// 设置当前流的文件格式
+	// set the file format of the current stream
+	c.viper.SetConfigType(fileType)
+
+	// 第一个流直接读取，后续的流合并到已有的配置上
+	// the first stream is read directly, the following streams are merged into the existing config
+	if merge {
+		return c.viper.MergeConfig(bytes.NewReader(rendered))
+	}
+	return c.viper.ReadConfig(bytes.NewReader(rendered))
+}
+
 // SaveToFile 将配置保存到文件
 // SaveToFile saves the configuration to a file
 func (c *StreamContent) SaveToFile() error {
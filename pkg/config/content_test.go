@@ -264,6 +264,86 @@ func TestStreamContent_LoadFromStream_TOML(t *testing.T) {
 	assert.Equal(t, "value2", data.Key2)
 }
 
+func TestStreamContent_LoadFromStream_Merge(t *testing.T) {
+	// Read base and override data from strings of different formats
+	baseData := `
+	{
+		"key1": "value1",
+		"key2": "value2",
+		"nested": {
+			"key3": "value3",
+			"key4": "value4"
+		}
+	}
+	`
+	overrideData := `
+key2: override2
+nested:
+  key4: override4
+`
+	defaultData := `
+	key5 = "value5"
+	`
+
+	// Create a new StreamContent instance with several readers
+	cfg := NewConfig().SetFileFormat(JSONType).SetReader(strings.NewReader(baseData))
+	cfg.AddReader(strings.NewReader(overrideData), YAMLType).AddReader(strings.NewReader(defaultData), TOMLType)
+	content := NewStreamContent(cfg)
+
+	// Define the expected data structure for unmarshaling
+	var data struct {
+		Key1   string `json:"key1"`
+		Key2   string `json:"key2"`
+		Key5   string `json:"key5"`
+		Nested struct {
+			Key3 string `json:"key3"`
+			Key4 string `json:"key4"`
+		} `json:"nested"`
+	}
+
+	// Call the LoadFromStream method
+	err := content.LoadFromStream(&data)
+	assert.NoError(t, err)
+
+	// Verify the merged data
+	assert.Equal(t, "value1", data.Key1)
+	assert.Equal(t, "override2", data.Key2)
+	assert.Equal(t, "value5", data.Key5)
+	assert.Equal(t, "value3", data.Nested.Key3)
+	assert.Equal(t, "override4", data.Nested.Key4)
+
+	// Load again to verify the readers have been reset
+	err = content.LoadFromStream(&data)
+	assert.NoError(t, err)
+	assert.Equal(t, "override2", data.Key2)
+}
+
+func TestStreamContent_LoadFromStream_AddReaderOnly(t *testing.T) {
+	// Create a new StreamContent instance with added readers only, the default empty reader is skipped
+	cfg := NewConfig().AddReader(strings.NewReader("a: 1\nb: 2\n"), YAMLType).AddReader(strings.NewReader(`b = 3`), TOMLType)
+	content := NewStreamContent(cfg)
+
+	// Call the LoadFromStream method twice to verify the readers have been reset
+	for i := 0; i < 2; i++ {
+		var data map[string]interface{}
+		err := content.LoadFromStream(&data)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": int64(3)}, data)
+	}
+}
+
+func TestStreamContent_LoadFromStream_MergeError(t *testing.T) {
+	// Create a new StreamContent instance with a broken override reader
+	cfg := NewConfig().SetFileFormat(JSONType).SetReader(strings.NewReader(`{"key1": "value1"}`))
+	cfg.AddReader(strings.NewReader(`{"key1": `), "")
+	content := NewStreamContent(cfg)
+
+	// Call the LoadFromStream method
+	var data map[string]interface{}
+	err := content.LoadFromStream(&data)
+	assert.Error(t, err)
+}
+
 func TestStreamContent_SaveToFile(t *testing.T) {
 	// Create a temporary config file for testing
 	tmpFile, err := os.CreateTemp("", "config_test")
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/shengyanli1982/toolkit/pkg/config"
+)
+
+// AppConfig 是应用的配置结构体
+// AppConfig is the config struct of the application
+type AppConfig struct {
+	Server struct {
+		Port uint16
+	}
+	Database struct {
+		DSN      string
+		Password string
+	}
+}
+
+func main() {
+	// 加载配置文件
+	// Load the config file
+	content := config.NewContent(config.NewConfig().SetFileName("config.yaml").SetFileFormat(config.YAMLType))
+	var cfg AppConfig
+	if err := content.LoadFromFile(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// 把配置检查接口挂载到 /debug/config，database.password 默认隐藏，dsn 额外隐藏
+	// Mount the config inspection endpoint on /debug/config, database.password is hidden by default and dsn is hidden in addition
+	mux := http.NewServeMux()
+	mux.Handle("/debug/config", config.NewInspectHandler(content, "dsn"))
+
+	// 运行服务器
+	// Run the server
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Server.Port), mux); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
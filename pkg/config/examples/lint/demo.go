@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shengyanli1982/toolkit/pkg/command"
+	"github.com/shengyanli1982/toolkit/pkg/config/lint"
+	"github.com/spf13/cobra"
+)
+
+// AppConfig 是应用的配置结构体
+// AppConfig is the config struct of the application
+type AppConfig struct {
+	Server struct {
+		Host string
+		Port int
+	}
+}
+
+func main() {
+	// 创建根命令
+	// Create the root command
+	root := &cobra.Command{Use: "app", Short: "Demo application"}
+	command.PrettyCobraHelpAndUsage(root)
+
+	// 添加 lint 子命令，检查配置文件是否符合 AppConfig
+	// Add the lint subcommand, which checks whether the config file matches AppConfig
+	root.AddCommand(lint.NewCommand(&AppConfig{}))
+
+	// 执行命令，发现问题时以非零状态码退出
+	// Execute the command, exit with a non-zero status code when problems are found
+	if err := root.Execute(); err != nil {
+		if err != lint.ErrLintFailed {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+}
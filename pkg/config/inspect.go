@@ -0,0 +1,202 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RedactedValue 是被隐藏的敏感配置值的替代值
+// RedactedValue is the replacement of the hidden sensitive config values
+const RedactedValue = "******"
+
+// DefaultRedactKeys 是默认被隐藏的配置键片段，键中任何一级包含这些片段（不区分大小写）的值都会被隐藏
+// DefaultRedactKeys are the config key fragments hidden by default, the value is hidden if any level of the key contains one of them (case insensitive)
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "privatekey", "private_key", "credential"}
+
+// InspectReport 是配置检查接口返回的内容
+// InspectReport is the content returned by the config inspection endpoint
+type InspectReport struct {
+	// Values 是当前有效的配置值，敏感值已被隐藏
+	// Values are the current effective config values, with sensitive values hidden
+	Values map[string]any `json:"values" yaml:"values"`
+
+	// Provenance 是每个配置键的值和来源，敏感值已被隐藏
+	// Provenance is the value and source of each config key, with sensitive values hidden
+	Provenance []Provenance `json:"provenance" yaml:"provenance"`
+
+	// LastLoad 是最近一次加载配置文件的状态
+	// LastLoad is the status of the last loading of the config file
+	LastLoad LoadStatus `json:"lastLoad" yaml:"lastLoad"`
+}
+
+// LoadStatus 是一次配置加载的状态
+// LoadStatus is the status of a config loading
+type LoadStatus struct {
+	// Time 是加载的时间，从未加载时为空
+	// Time is the time of the loading, nil if it has never been loaded
+	Time *time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+
+	// Error 是加载的错误信息
+	// Error is the error message of the loading
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// inspectHandler 是配置检查接口的处理器
+// inspectHandler is the handler of the config inspection endpoint
+type inspectHandler struct {
+	// content 是被检查的配置内容
+	// content is the inspected config content
+	content *Content
+
+	// redactKeys 是需要隐藏的配置键片段
+	// redactKeys are the config key fragments to hide
+	redactKeys []string
+}
+
+// NewInspectHandler 创建一个返回当前配置值、每个键的来源和最近一次加载状态的 http.Handler，可以挂载到任意的 HTTP 路由上。
+// 默认返回 JSON，使用查询参数 format=yaml 或 Accept 头包含 yaml 时返回 YAML。匹配 DefaultRedactKeys 和 redactKeys 的值会被隐藏。
+// NewInspectHandler creates an http.Handler returning the current config values, the source of each key and the last loading status, it can be mounted on any HTTP router.
+// JSON is returned by default, YAML is returned when the query parameter format=yaml is given or the Accept header contains yaml. Values matching DefaultRedactKeys and redactKeys are hidden.
+func NewInspectHandler(content *Content, redactKeys ...string) http.Handler {
+	// 合并默认和自定义的隐藏键片段
+	// merge the default and custom redact key fragments
+	keys := make([]string, 0, len(DefaultRedactKeys)+len(redactKeys))
+	for _, key := range append(append([]string{}, DefaultRedactKeys...), redactKeys...) {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return &inspectHandler{content: content, redactKeys: keys}
+}
+
+// ServeHTTP 输出配置检查报告
+// ServeHTTP outputs the config inspection report
+func (h *inspectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 只允许 GET 和 HEAD 请求
+	// Only GET and HEAD requests are allowed
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 生成报告
+	// build the report
+	report := h.report()
+
+	// 根据请求选择输出格式
+	// choose the output format by the request
+	var (
+		body        []byte
+		err         error
+		contentType string
+	)
+	if strings.EqualFold(r.URL.Query().Get("format"), YAMLType) || strings.Contains(r.Header.Get("Accept"), YAMLType) {
+		body, err = yaml.Marshal(report)
+		contentType = "application/yaml; charset=utf-8"
+	} else {
+		body, err = json.MarshalIndent(report, "", "  ")
+		contentType = "application/json; charset=utf-8"
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 输出报告
+	// output the report
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// report 生成隐藏了敏感值的配置检查报告
+// report builds the config inspection report with sensitive values hidden
+func (h *inspectHandler) report() *InspectReport {
+	report := &InspectReport{Values: make(map[string]any)}
+
+	// 获取每个键的值和来源，并隐藏敏感值
+	// get the value and source of each key and hide the sensitive values
+	report.Provenance = h.content.ExplainAll()
+	for i := range report.Provenance {
+		item := &report.Provenance[i]
+		if h.isSensitive(item.Key) {
+			item.Value = RedactedValue
+		} else {
+			item.Value = h.redactValue(item.Value)
+		}
+		setNestedValue(report.Values, item.Key, item.Value)
+	}
+
+	// 获取最近一次加载的状态
+	// get the status of the last loading
+	loadTime, loadErr := h.content.LastLoad()
+	if !loadTime.IsZero() {
+		report.LastLoad.Time = &loadTime
+	}
+	if loadErr != nil {
+		report.LastLoad.Error = loadErr.Error()
+	}
+
+	return report
+}
+
+// isSensitive 检查配置键的任何一级是否包含需要隐藏的片段
+// isSensitive checks whether any level of the config key contains a fragment to hide
+func (h *inspectHandler) isSensitive(key string) bool {
+	for _, part := range strings.Split(strings.ToLower(key), ".") {
+		for _, fragment := range h.redactKeys {
+			if strings.Contains(part, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactValue 隐藏列表和 map 类型的值中的敏感字段
+// redactValue hides the sensitive fields in values of list and map types
+func (h *inspectHandler) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			if h.isSensitive(key) {
+				out[key] = RedactedValue
+			} else {
+				out[key] = h.redactValue(child)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = h.redactValue(child)
+		}
+		return out
+	}
+	return value
+}
+
+// setNestedValue 按照使用 "." 连接的键将值设置到嵌套的 map 中
+// setNestedValue sets the value into the nested map by the key joined with "."
+func setNestedValue(values map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := values[part].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			values[part] = child
+		}
+		values = child
+	}
+	values[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInspectHandler(t *testing.T) {
+	// Create a config file with sensitive values
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `
+server:
+  port: 8080
+database:
+  user: admin
+  password: p@ss
+  dsn: postgres://db
+auth:
+  client_secret: xyz
+users:
+  - name: lee
+    token: abc
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Create a new Content instance and load the config file
+	content := NewContent(NewConfig().SetFileName(fileName).SetFileFormat(YAMLType))
+	var data map[string]any
+	assert.NoError(t, content.LoadFromFile(&data))
+
+	// Request the report in JSON
+	handler := NewInspectHandler(content, "dsn")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	// Verify the values are redacted
+	var report InspectReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, float64(8080), report.Values["server"].(map[string]any)["port"])
+	assert.Equal(t, "admin", report.Values["database"].(map[string]any)["user"])
+	assert.Equal(t, RedactedValue, report.Values["database"].(map[string]any)["password"])
+	assert.Equal(t, RedactedValue, report.Values["database"].(map[string]any)["dsn"])
+	assert.Equal(t, RedactedValue, report.Values["auth"].(map[string]any)["client_secret"])
+	assert.Equal(t, RedactedValue, report.Values["users"].([]any)[0].(map[string]any)["token"])
+	assert.NotContains(t, rec.Body.String(), "p@ss")
+
+	// Verify the provenance and the last loading status
+	assert.Len(t, report.Provenance, 6)
+	assert.Equal(t, "auth.client_secret", report.Provenance[0].Key)
+	assert.Equal(t, Source{Kind: SourceFile, Name: fileName, Line: 9}, report.Provenance[0].Source)
+	assert.NotNil(t, report.LastLoad.Time)
+	assert.Empty(t, report.LastLoad.Error)
+
+	// Request the report in YAML after a failed reload
+	assert.NoError(t, os.Remove(fileName))
+	assert.Error(t, content.LoadFromFile(&data))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config?format=yaml", nil))
+	assert.Equal(t, "application/yaml; charset=utf-8", rec.Header().Get("Content-Type"))
+	report = InspectReport{}
+	assert.NoError(t, yaml.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Contains(t, report.LastLoad.Error, "no such file or directory")
+	assert.Equal(t, RedactedValue, report.Values["database"].(map[string]any)["password"])
+
+	// Other methods are not allowed
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/config", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestInspectHandler_Server(t *testing.T) {
+	// Create and load a config file with a sensitive value
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(fileName, []byte("server:\n  port: 8080\ndatabase:\n  password: p@ss\n"), 0644))
+	content := NewContent(NewConfig().SetFileName(fileName).SetFileFormat(YAMLType))
+	var data map[string]any
+	assert.NoError(t, content.LoadFromFile(&data))
+
+	// Mount the inspection handler on a mux served by a test server
+	mux := http.NewServeMux()
+	mux.Handle("/debug/config", NewInspectHandler(content))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	url := srv.URL + "/debug/config"
+
+	// Request the report in JSON through the server
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var report InspectReport
+	assert.NoError(t, json.Unmarshal(body, &report))
+	assert.Equal(t, float64(8080), report.Values["server"].(map[string]any)["port"])
+	assert.Equal(t, RedactedValue, report.Values["database"].(map[string]any)["password"])
+	assert.NotContains(t, string(body), "p@ss")
+
+	// Request the report in YAML through the server
+	resp, err = http.Get(url + "?format=yaml")
+	assert.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	report = InspectReport{}
+	assert.NoError(t, yaml.Unmarshal(body, &report))
+	assert.Len(t, report.Provenance, 2)
+
+	// Other methods are rejected by the handler
+	resp, err = http.Post(url, "text/plain", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// FindingError 表示检查发现的错误
+// FindingError indicates an error found by the check
+const FindingError = "error"
+
+// Validator 是一个可以校验自身的配置结构体
+// Validator is a config struct that can validate itself
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError 是一个关联到配置键的校验错误
+// ValidationError is a validation error associated with a config key
+type ValidationError struct {
+	// Key 是校验失败的配置键
+	// Key is the config key that failed validation
+	Key string
+
+	// Message 是校验失败的原因
+	// Message is the reason of the validation failure
+	Message string
+}
+
+// Error 返回校验错误的描述
+// Error returns the description of the validation error
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// Finding 是配置检查的一条结果
+// Finding is a result of the config check
+type Finding struct {
+	// Level 是结果的级别，例如 FindingError
+	// Level is the level of the result, such as FindingError
+	Level string `json:"level" yaml:"level"`
+
+	// Key 是相关的配置键，为空表示与整个配置有关
+	// Key is the related config key, empty means it is about the whole config
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+
+	// Message 是结果的描述
+	// Message is the description of the result
+	Message string `json:"message" yaml:"message"`
+
+	// Source 是配置键的来源
+	// Source is the source of the config key
+	Source *Source `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// String 返回结果的可读描述
+// String returns a readable description of the result
+func (f Finding) String() string {
+	var b strings.Builder
+
+	// 输出级别和来源位置
+	// output the level and the source location
+	b.WriteString(f.Level)
+	if f.Source != nil && f.Source.Kind != SourceUnknown {
+		b.WriteString(" [" + f.Source.String() + "]")
+	}
+	b.WriteString(": ")
+
+	// 输出配置键和描述
+	// output the config key and the description
+	if f.Key != "" {
+		b.WriteString(f.Key + ": ")
+	}
+	b.WriteString(f.Message)
+
+	return b.String()
+}
+
+// Lint 读取配置文件并严格检查 data 结构体：文件中未知的键、反序列化错误，以及 Validator 和 validators 返回的校验错误。
+// 只有在配置文件无法读取或解析时才返回错误。
+// Lint reads the config file and strictly checks it against the data struct: unknown keys in the file, unmarshal errors,
+// and validation errors returned by Validator and validators. An error is returned only if the config file cannot be read or parsed.
+func (c *Content) Lint(data any, validators ...func(any) error) ([]Finding, error) {
+	// 获取结构体的类型
+	// get the type of the struct
+	t := reflect.TypeOf(data)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: lint requires a pointer to a struct, got %T", data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 读取配置文件
+	// read config file
+	if err := c.readFile(); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+
+	// 检查文件中结构体未定义的键
+	// check the keys in the file that are not defined by the struct
+	known, prefixes := structKeys(t.Elem())
+	reported := make(map[string]struct{})
+	for key := range c.prov.values {
+		if !isKnownKey(key, known, prefixes) {
+			findings = append(findings, c.newFinding(FindingError, key, "unknown key"))
+			reported[key] = struct{}{}
+		}
+	}
+
+	// 严格地反序列化配置数据，不做宽松的类型转换，例如把 "8080" 转换为 int，记录类型错误
+	// unmarshal the config data strictly without loose type conversions, such as "8080" to int, and record type errors
+	if err := c.viper.Unmarshal(data, strictDecoding); err != nil {
+		for _, err := range splitErrors(err) {
+			if keys, ok := unusedKeys(err.Error()); ok {
+				// 跳过已经作为未知的键报告的键，其余的键（例如列表元素中的键）在这里报告
+				// skip the keys already reported as unknown keys, the other keys (such as keys in list elements) are reported here
+				for _, key := range keys {
+					if _, ok := reported[key]; !ok {
+						findings = append(findings, c.newElementFinding(FindingError, key, "unknown key"))
+					}
+				}
+			} else if key, message, ok := decodeErrorKey(err.Error()); ok {
+				findings = append(findings, c.newElementFinding(FindingError, key, message))
+			} else {
+				findings = append(findings, c.newFinding(FindingError, "", err.Error()))
+			}
+		}
+	}
+
+	// 执行结构体自身和额外的校验
+	// run the validation of the struct itself and the extra validators
+	if v, ok := data.(Validator); ok {
+		validators = append([]func(any) error{func(any) error { return v.Validate() }}, validators...)
+	}
+	for _, validate := range validators {
+		for _, err := range splitErrors(validate(data)) {
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				findings = append(findings, c.newFinding(FindingError, strings.ToLower(verr.Key), verr.Message))
+			} else {
+				findings = append(findings, c.newFinding(FindingError, "", err.Error()))
+			}
+		}
+	}
+
+	// 按照键排序，保证输出稳定
+	// sort by key to keep the output stable
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Key < findings[j].Key })
+
+	// 返回检查结果
+	// return the findings
+	return findings, nil
+}
+
+// strictDecoding 关闭宽松的类型转换并拒绝未使用的键，保留 viper 默认的时间间隔和切片转换
+// strictDecoding disables the loose type conversions and rejects unused keys, keeping the default duration and slice conversions of viper
+func strictDecoding(dc *mapstructure.DecoderConfig) {
+	dc.WeaklyTypedInput = false
+	dc.ErrorUnused = true
+}
+
+// decodeErrorKey 从 "'Server.Port' expected type 'int', ..." 形式的反序列化错误中取出配置键和描述
+// decodeErrorKey extracts the config key and the description from an unmarshal error in the form of "'Server.Port' expected type 'int', ..."
+func decodeErrorKey(msg string) (string, string, bool) {
+	if !strings.HasPrefix(msg, "'") {
+		return "", "", false
+	}
+	key, message, ok := strings.Cut(msg[1:], "' ")
+	if !ok || key == "" || strings.Contains(message, "has invalid keys") {
+		return "", "", false
+	}
+	return strings.ToLower(key), message, true
+}
+
+// unusedKeys 从 "'Server' has invalid keys: hots, prot" 形式的反序列化错误中取出未使用的配置键
+// unusedKeys extracts the unused config keys from an unmarshal error in the form of "'Server' has invalid keys: hots, prot"
+func unusedKeys(msg string) ([]string, bool) {
+	if !strings.HasPrefix(msg, "'") {
+		return nil, false
+	}
+	name, list, ok := strings.Cut(msg[1:], "' has invalid keys: ")
+	if !ok {
+		return nil, false
+	}
+	var keys []string
+	for _, key := range strings.Split(list, ", ") {
+		if name != "" {
+			key = name + "." + key
+		}
+		keys = append(keys, strings.ToLower(key))
+	}
+	return keys, true
+}
+
+// newElementFinding 创建一条检查结果，列表元素中的键（例如 "items[0].name"）没有被跟踪时使用列表的来源，调用者必须持有锁
+// newElementFinding creates a finding, the source of the list is used when a key in a list element (such as "items[0].name") is not tracked, the caller must hold the lock
+func (c *Content) newElementFinding(level, key, message string) Finding {
+	finding := c.newFinding(level, key, message)
+	if idx := strings.Index(key, "["); idx > 0 && finding.Source.Kind == SourceUnknown {
+		source := c.resolveSource(key[:idx])
+		finding.Source = &source
+	}
+	return finding
+}
+
+// newFinding 创建一条检查结果，并附加配置键的来源，调用者必须持有锁
+// newFinding creates a finding and attaches the source of the config key, the caller must hold the lock
+func (c *Content) newFinding(level, key, message string) Finding {
+	finding := Finding{Level: level, Key: key, Message: message}
+	if key != "" {
+		source := c.resolveSource(key)
+		finding.Source = &source
+	}
+	return finding
+}
+
+// structKeys 返回结构体定义的所有叶子键，以及可以包含任意子键的前缀（map 和 interface 字段）
+// structKeys returns all leaf keys defined by the struct, and the prefixes that can contain any sub key (map and interface fields)
+func structKeys(t reflect.Type) (map[string]struct{}, []string) {
+	known := make(map[string]struct{})
+	var prefixes []string
+
+	walkStructKeys(t, "", "", func(key, _ string, field reflect.StructField) {
+		known[key] = struct{}{}
+
+		// 父级键也是已知的键
+		// the parent keys are also known keys
+		for idx := strings.LastIndex(key, "."); idx > 0; idx = strings.LastIndex(key[:idx], ".") {
+			known[key[:idx]] = struct{}{}
+		}
+
+		// map 和 interface 字段可以包含任意子键
+		// map and interface fields can contain any sub key
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Map || ft.Kind() == reflect.Interface {
+			prefixes = append(prefixes, key+".")
+		}
+	})
+
+	return known, prefixes
+}
+
+// isKnownKey 检查键是否被结构体定义
+// isKnownKey checks whether the key is defined by the struct
+func isKnownKey(key string, known map[string]struct{}, prefixes []string) bool {
+	if _, ok := known[key]; ok {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitErrors 将包含多个错误的错误拆分为单个错误
+// splitErrors splits an error that contains multiple errors into single errors
+func splitErrors(err error) []error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	case interface{ WrappedErrors() []error }:
+		return e.WrappedErrors()
+	}
+	return []error{err}
+}
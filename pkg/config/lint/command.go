@@ -0,0 +1,190 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/shengyanli1982/toolkit/pkg/command"
+	"github.com/shengyanli1982/toolkit/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// TextOutput 是人类可读的输出格式
+	// TextOutput is the human-readable output format
+	TextOutput = "text"
+
+	// JSONOutput 是机器可读的输出格式
+	// JSONOutput is the machine-readable output format
+	JSONOutput = "json"
+)
+
+// ErrLintFailed 在检查发现问题时由命令返回，调用者应该以非零状态码退出
+// ErrLintFailed is returned by the command when the check finds problems, the caller should exit with a non-zero status code
+var ErrLintFailed = errors.New("config lint failed")
+
+// Report 是一次配置检查的报告
+// Report is the report of a config check
+type Report struct {
+	// File 是被检查的配置文件
+	// File is the checked config file
+	File string `json:"file" yaml:"file"`
+
+	// Valid 表示配置文件是否通过检查
+	// Valid indicates whether the config file passed the check
+	Valid bool `json:"valid" yaml:"valid"`
+
+	// Findings 是检查发现的问题
+	// Findings are the problems found by the check
+	Findings []config.Finding `json:"findings" yaml:"findings"`
+}
+
+// NewCommand 创建一个 lint 子命令，它使用 config.Content 加载配置文件，并严格检查 target 结构体。
+// target 必须是结构体指针，每次执行都会创建一个新的实例。发现问题时命令返回 ErrLintFailed。
+// NewCommand creates a lint subcommand, which loads a config file through config.Content and strictly checks it against the target struct.
+// target must be a pointer to a struct, a new instance is created for each run. The command returns ErrLintFailed when problems are found.
+func NewCommand(target any, validators ...func(any) error) *cobra.Command {
+	var fileName, fileFormat, output string
+
+	// 创建 lint 子命令
+	// Create the lint subcommand
+	cmd := &cobra.Command{
+		Use:           "lint",
+		Short:         "Check a config file against the registered struct",
+		Example:       "lint --config config.yaml --output json",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd.OutOrStdout(), target, validators, fileName, fileFormat, output)
+		},
+	}
+
+	// 添加命令行标志
+	// Add the command line flags
+	cmd.Flags().StringVarP(&fileName, "config", "c", "", "Path of the config file to check")
+	cmd.Flags().StringVarP(&fileFormat, "format", "f", "", "Format of the config file (json, yaml, toml), detected from the extension by default")
+	cmd.Flags().StringVarP(&output, "output", "o", TextOutput, "Output format of the findings (text, json)")
+
+	// 使用美化后的帮助信息和使用说明
+	// Use the beautified help message and usage
+	command.PrettyCobraHelpAndUsage(cmd)
+
+	return cmd
+}
+
+// run 执行一次配置检查并输出报告
+// run performs a config check and outputs the report
+func run(w io.Writer, target any, validators []func(any) error, fileName, fileFormat, output string) error {
+	// 检查输出格式
+	// Check the output format
+	if output != TextOutput && output != JSONOutput {
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+
+	// 检查配置文件名
+	// Check the config file name
+	fileName = strings.TrimSpace(fileName)
+	if fileName == "" {
+		return errors.New("the config file is required")
+	}
+
+	// 未指定格式时根据扩展名检测
+	// Detect the format from the extension when it is not given
+	fileFormat, err := detectFormat(fileName, fileFormat)
+	if err != nil {
+		return err
+	}
+
+	// 检查目标是否是结构体指针
+	// Check whether the target is a pointer to a struct
+	t := reflect.TypeOf(target)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("the registered target must be a pointer to a struct, got %T", target)
+	}
+
+	// 使用新的实例检查配置文件
+	// Check the config file with a new instance
+	content := config.NewContent(config.NewConfig().SetFileName(fileName).SetFileFormat(fileFormat))
+	findings, err := content.Lint(reflect.New(t.Elem()).Interface(), validators...)
+	if err != nil {
+		findings = []config.Finding{{Level: config.FindingError, Message: err.Error()}}
+	}
+
+	// 输出报告
+	// Output the report
+	report := Report{File: fileName, Valid: len(findings) == 0, Findings: findings}
+	if report.Findings == nil {
+		report.Findings = []config.Finding{}
+	}
+	if err := writeReport(w, &report, output); err != nil {
+		return err
+	}
+
+	// 发现问题时返回错误
+	// Return an error when problems are found
+	if !report.Valid {
+		return ErrLintFailed
+	}
+
+	// 成功
+	// success
+	return nil
+}
+
+// detectFormat 返回配置文件的格式，未指定时根据扩展名检测
+// detectFormat returns the format of the config file, it is detected from the extension when not given
+func detectFormat(fileName, fileFormat string) (string, error) {
+	fileFormat = strings.ToLower(strings.TrimSpace(fileFormat))
+
+	// 未指定时使用扩展名
+	// Use the extension when not given
+	if fileFormat == "" {
+		fileFormat = strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+		if fileFormat == "yml" {
+			fileFormat = config.YAMLType
+		}
+	}
+
+	// 检查格式是否被支持
+	// Check whether the format is supported
+	switch fileFormat {
+	case config.JSONType, config.YAMLType, config.TOMLType:
+		return fileFormat, nil
+	}
+	return "", fmt.Errorf("unsupported config format %q", fileFormat)
+}
+
+// writeReport 以指定的格式输出报告
+// writeReport outputs the report in the given format
+func writeReport(w io.Writer, report *Report, output string) error {
+	// 输出 JSON 格式的报告
+	// Output the report in JSON format
+	if output == JSONOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	// 输出每一条问题
+	// Output each problem
+	for _, finding := range report.Findings {
+		if _, err := fmt.Fprintln(w, finding.String()); err != nil {
+			return err
+		}
+	}
+
+	// 输出汇总
+	// Output the summary
+	if report.Valid {
+		_, err := fmt.Fprintf(w, "%s: ok\n", report.File)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s: %d problem(s) found\n", report.File, len(report.Findings))
+	return err
+}
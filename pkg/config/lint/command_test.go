@@ -0,0 +1,149 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shengyanli1982/toolkit/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	Server struct {
+		Host string
+		Port int
+	}
+	Labels map[string]string
+	Items  []struct {
+		Name string
+	}
+}
+
+func (c *testConfig) Validate() error {
+	if c.Server.Port <= 0 {
+		return &config.ValidationError{Key: "server.port", Message: "must be positive"}
+	}
+	return nil
+}
+
+func TestCommand_Valid(t *testing.T) {
+	// Create a valid config file
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `
+server:
+  host: localhost
+  port: 8080
+labels:
+  team: infra
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Run the lint command
+	var buf bytes.Buffer
+	cmd := NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"--config", fileName})
+	assert.NoError(t, cmd.Execute())
+
+	// Verify the output
+	assert.Equal(t, fileName+": ok\n", buf.String())
+}
+
+func TestCommand_Findings(t *testing.T) {
+	// Create a config file with an unknown key and an invalid value
+	fileName := filepath.Join(t.TempDir(), "config.yml")
+	testData := `
+server:
+  host: localhost
+  port: -1
+  hots: typo
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Run the lint command with text output
+	var buf bytes.Buffer
+	cmd := NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-c", fileName})
+	assert.ErrorIs(t, cmd.Execute(), ErrLintFailed)
+	assert.Contains(t, buf.String(), "error [file "+fileName+":5]: server.hots: unknown key")
+	assert.Contains(t, buf.String(), "error [file "+fileName+":4]: server.port: must be positive")
+	assert.Contains(t, buf.String(), "2 problem(s) found")
+
+	// Run the lint command with JSON output
+	buf.Reset()
+	cmd = NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-c", fileName, "-o", "json"})
+	assert.ErrorIs(t, cmd.Execute(), ErrLintFailed)
+
+	// Verify the JSON report
+	var report Report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.False(t, report.Valid)
+	assert.Len(t, report.Findings, 2)
+	assert.Equal(t, "server.hots", report.Findings[0].Key)
+	assert.Equal(t, 5, report.Findings[0].Source.Line)
+}
+
+func TestCommand_TypeMismatch(t *testing.T) {
+	// Create a config file with a string for an int field
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `
+server:
+  host: localhost
+  port: "8080"
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Run the lint command, the string is not converted to an int
+	var buf bytes.Buffer
+	cmd := NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-c", fileName})
+	assert.ErrorIs(t, cmd.Execute(), ErrLintFailed)
+	assert.Contains(t, buf.String(), "error [file "+fileName+":4]: server.port: expected type 'int', got unconvertible type 'string'")
+}
+
+func TestCommand_ListElementKeys(t *testing.T) {
+	// Create a config file with a typo inside a list element
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `
+server:
+  port: 8080
+  hots: typo
+items:
+  - name: a
+  - nmae: b
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Run the lint command, the typo is reported with the source of the list and the other unknown key is reported once
+	var buf bytes.Buffer
+	cmd := NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-c", fileName})
+	assert.ErrorIs(t, cmd.Execute(), ErrLintFailed)
+	assert.Contains(t, buf.String(), "error [file "+fileName+":5]: items[1].nmae: unknown key")
+	assert.Contains(t, buf.String(), "error [file "+fileName+":4]: server.hots: unknown key")
+	assert.Contains(t, buf.String(), "2 problem(s) found")
+}
+
+func TestCommand_Errors(t *testing.T) {
+	// Run the lint command with a missing file
+	var buf bytes.Buffer
+	cmd := NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-c", filepath.Join(t.TempDir(), "missing.json")})
+	assert.ErrorIs(t, cmd.Execute(), ErrLintFailed)
+	assert.Contains(t, buf.String(), "1 problem(s) found")
+
+	// Run the lint command with an unsupported format
+	cmd = NewCommand(&testConfig{})
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-c", "config.ini"})
+	assert.EqualError(t, cmd.Execute(), `unsupported config format "ini"`)
+}
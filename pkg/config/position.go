@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// locateKeyLines 返回配置内容中每个键所在的行号，键使用小写并以 "." 连接
+// locateKeyLines returns the line number of each key in the config content, the keys are lowercased and joined with "."
+func locateKeyLines(content []byte, fileType string) map[string]int {
+	switch strings.ToLower(fileType) {
+	case JSONType:
+		return locateJSONKeyLines(content)
+	case YAMLType:
+		return locateYAMLKeyLines(content)
+	case TOMLType:
+		return locateTOMLKeyLines(content)
+	}
+	return map[string]int{}
+}
+
+// lookupKeyLine 返回键所在的行号，如果键本身没有被定位，使用最近的父级键的行号
+// lookupKeyLine returns the line number of the key, the line of the nearest parent key is used if the key itself is not located
+func lookupKeyLine(lines map[string]int, key string) int {
+	for {
+		if line, ok := lines[key]; ok {
+			return line
+		}
+
+		// 退回到父级键
+		// fall back to the parent key
+		idx := strings.LastIndex(key, ".")
+		if idx < 0 {
+			return 0
+		}
+		key = key[:idx]
+	}
+}
+
+// jsonFrame 是 JSON 解析过程中的一层对象或数组
+// jsonFrame is a level of object or array while scanning JSON
+type jsonFrame struct {
+	// prefix 是当前对象的键前缀
+	// prefix is the key prefix of the current object
+	prefix string
+
+	// key 是当前对象中最近读取的键
+	// key is the most recently read key in the current object
+	key string
+
+	// object 表示当前层是否是对象
+	// object indicates whether the current level is an object
+	object bool
+
+	// expectKey 表示下一个 token 是否是键
+	// expectKey indicates whether the next token is a key
+	expectKey bool
+
+	// skip 表示当前层位于数组中，不记录其中的键
+	// skip indicates the current level is inside an array, the keys in it are not recorded
+	skip bool
+}
+
+// locateJSONKeyLines 扫描 JSON 内容的 token，记录每个对象键所在的行号
+// locateJSONKeyLines scans the tokens of the JSON content and records the line number of each object key
+func locateJSONKeyLines(content []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(content))
+	var stack []*jsonFrame
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+
+		// 获取当前层
+		// get the current level
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		// 读取对象中的键
+		// read the key in an object
+		if top != nil && top.object && top.expectKey {
+			if name, ok := tok.(string); ok {
+				top.key = joinKey(top.prefix, strings.ToLower(name))
+				top.expectKey = false
+				if !top.skip {
+					lines[top.key] = 1 + bytes.Count(content[:dec.InputOffset()], []byte{'\n'})
+				}
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			// 进入新的对象或数组
+			// enter a new object or array
+			frame := &jsonFrame{object: tok == json.Delim('{'), expectKey: tok == json.Delim('{')}
+			if top != nil {
+				frame.prefix = top.key
+				frame.skip = top.skip || !top.object
+			}
+			stack = append(stack, frame)
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			// 离开当前对象或数组
+			// leave the current object or array
+			stack = stack[:len(stack)-1]
+		}
+
+		// 一个值读取完成后，父级对象期待下一个键
+		// after a value is read, the parent object expects the next key
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+}
+
+// locateYAMLKeyLines 解析 YAML 节点树，记录每个映射键所在的行号
+// locateYAMLKeyLines parses the YAML node tree and records the line number of each mapping key
+func locateYAMLKeyLines(content []byte) map[string]int {
+	lines := make(map[string]int)
+
+	// 解析 YAML 节点树
+	// parse the YAML node tree
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return lines
+	}
+
+	// 递归遍历映射节点
+	// walk the mapping nodes recursively
+	var walk func(node *yaml.Node, prefix string)
+	walk = func(node *yaml.Node, prefix string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, prefix)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := joinKey(prefix, strings.ToLower(node.Content[i].Value))
+				lines[key] = node.Content[i].Line
+				walk(node.Content[i+1], key)
+			}
+		}
+	}
+	walk(&root, "")
+
+	return lines
+}
+
+// locateTOMLKeyLines 逐行扫描 TOML 内容，记录表头和键值对所在的行号，数组表中的键不被记录
+// locateTOMLKeyLines scans the TOML content line by line and records the line number of table headers and key/value pairs, keys in array tables are not recorded
+func locateTOMLKeyLines(content []byte) map[string]int {
+	lines := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	table, skip := "", false
+
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			// 跳过空行和注释
+			// skip empty lines and comments
+			continue
+		case strings.HasPrefix(line, "[["):
+			// 数组表中的键不被记录
+			// keys in array tables are not recorded
+			skip = true
+		case strings.HasPrefix(line, "["):
+			// 记录表头
+			// record the table header
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			table, skip = normalizeTOMLKey(line[1:end]), false
+			lines[table] = number
+		case !skip:
+			// 记录键值对
+			// record the key/value pair
+			idx := strings.Index(line, "=")
+			if idx <= 0 {
+				continue
+			}
+			lines[joinKey(table, normalizeTOMLKey(line[:idx]))] = number
+		}
+	}
+
+	return lines
+}
+
+// normalizeTOMLKey 去除 TOML 键中各部分的引号和空格，并转换为小写
+// normalizeTOMLKey removes the quotes and spaces of each part of a TOML key and converts it to lowercase
+func normalizeTOMLKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// SourceKind 是配置值来源的类型
+// SourceKind is the kind of the source of a config value
+type SourceKind string
+
+const (
+	// SourceUnknown 表示来源未被跟踪，例如直接通过 viper 设置的值
+	// SourceUnknown means the source is not tracked, such as a value set directly through viper
+	SourceUnknown SourceKind = "unknown"
+
+	// SourceDefault 表示值来自结构体的 default 标签
+	// SourceDefault means the value comes from the default tag of a struct
+	SourceDefault SourceKind = "default"
+
+	// SourceFile 表示值来自配置文件
+	// SourceFile means the value comes from the config file
+	SourceFile SourceKind = "file"
+
+	// SourceEnv 表示值来自环境变量
+	// SourceEnv means the value comes from an environment variable
+	SourceEnv SourceKind = "env"
+
+	// SourceFlag 表示值来自命令行标志
+	// SourceFlag means the value comes from a command line flag
+	SourceFlag SourceKind = "flag"
+
+	// SourceFlagDefault 表示值来自命令行标志的默认值
+	// SourceFlagDefault means the value comes from the default value of a command line flag
+	SourceFlagDefault SourceKind = "flag-default"
+
+	// SourceRemote 表示值来自远程配置源
+	// SourceRemote means the value comes from a remote config source
+	SourceRemote SourceKind = "remote"
+)
+
+// defaultTagName 是结构体中默认值标签的名称
+// defaultTagName is the name of the default value tag in structs
+const defaultTagName = "default"
+
+// Source 描述了一个配置值的来源
+// Source describes where a config value comes from
+type Source struct {
+	// Kind 是来源的类型
+	// Kind is the kind of the source
+	Kind SourceKind `json:"kind" yaml:"kind"`
+
+	// Name 是来源的名称，例如文件路径、环境变量名、标志名或字段路径
+	// Name is the name of the source, such as the file path, env var name, flag name or field path
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Line 是值在配置文件中的行号，未知时为 0
+	// Line is the line number of the value in the config file, 0 when unknown
+	Line int `json:"line,omitempty" yaml:"line,omitempty"`
+}
+
+// String 返回来源的可读描述
+// String returns a readable description of the source
+func (s Source) String() string {
+	switch s.Kind {
+	case SourceFile:
+		// 文件来源包含行号
+		// The file source includes the line number
+		if s.Line > 0 {
+			return fmt.Sprintf("file %s:%d", s.Name, s.Line)
+		}
+		return "file " + s.Name
+	case SourceFlag, SourceFlagDefault:
+		return fmt.Sprintf("%s --%s", s.Kind, s.Name)
+	case SourceUnknown:
+		return string(s.Kind)
+	default:
+		return fmt.Sprintf("%s %s", s.Kind, s.Name)
+	}
+}
+
+// Provenance 是一个已解析配置键的值和来源
+// Provenance is the value and source of a resolved config key
+type Provenance struct {
+	// Key 是配置键
+	// Key is the config key
+	Key string `json:"key" yaml:"key"`
+
+	// Value 是配置键的有效值
+	// Value is the effective value of the config key
+	Value any `json:"value" yaml:"value"`
+
+	// Source 是有效值的来源
+	// Source is the source of the effective value
+	Source Source `json:"source" yaml:"source"`
+}
+
+// provenance 记录了每个配置层中键的来源
+// provenance records the source of the keys in each config layer
+type provenance struct {
+	// defaults 是默认值层中键的来源
+	// defaults is the source of the keys in the default layer
+	defaults map[string]Source
+
+	// values 是配置文件和远程配置层中键的来源
+	// values is the source of the keys in the config file and remote layers
+	values map[string]Source
+
+	// envs 是键绑定的环境变量名
+	// envs is the env var names bound to the keys
+	envs map[string][]string
+
+	// flags 是键绑定的命令行标志
+	// flags is the command line flags bound to the keys
+	flags map[string]*pflag.Flag
+}
+
+// newProvenance 创建一个新的 provenance 实例
+// newProvenance creates a new provenance instance
+func newProvenance() *provenance {
+	return &provenance{
+		defaults: make(map[string]Source),
+		values:   make(map[string]Source),
+		envs:     make(map[string][]string),
+		flags:    make(map[string]*pflag.Flag),
+	}
+}
+
+// SetDefaults 读取结构体字段的 default 标签并设置为默认值，data 必须是结构体或结构体指针
+// SetDefaults reads the default tags of the struct fields and sets them as default values, data must be a struct or a pointer to a struct
+func (c *Content) SetDefaults(data any) error {
+	// 获取结构体的类型
+	// get the type of the struct
+	t := reflect.TypeOf(data)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("config: defaults require a struct, got %T", data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 遍历结构体字段，设置默认值
+	// walk the struct fields and set the default values
+	walkStructKeys(t, "", "", func(key, fieldPath string, field reflect.StructField) {
+		if value, ok := field.Tag.Lookup(defaultTagName); ok {
+			c.viper.SetDefault(key, value)
+			c.prov.defaults[key] = Source{Kind: SourceDefault, Name: fieldPath}
+		}
+	})
+
+	// 成功
+	// success
+	return nil
+}
+
+// BindEnv 将配置键绑定到环境变量，未指定环境变量名时使用大写的键名，其中的 "." 替换为 "_"
+// BindEnv binds a config key to env vars, the uppercased key with "." replaced by "_" is used when no env var name is given
+func (c *Content) BindEnv(key string, envNames ...string) error {
+	key = strings.ToLower(strings.TrimSpace(key))
+
+	// 如果没有指定环境变量名，根据键名生成
+	// If no env var name is given, generate it from the key
+	if len(envNames) == 0 {
+		envNames = []string{strings.ToUpper(strings.ReplaceAll(key, ".", "_"))}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 绑定环境变量
+	// bind the env vars
+	if err := c.viper.BindEnv(append([]string{key}, envNames...)...); err != nil {
+		return err
+	}
+	c.prov.envs[key] = append(c.prov.envs[key], envNames...)
+
+	// 成功
+	// success
+	return nil
+}
+
+// BindFlag 将配置键绑定到命令行标志
+// BindFlag binds a config key to a command line flag
+func (c *Content) BindFlag(key string, flag *pflag.Flag) error {
+	key = strings.ToLower(strings.TrimSpace(key))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 绑定命令行标志
+	// bind the command line flag
+	if err := c.viper.BindPFlag(key, flag); err != nil {
+		return err
+	}
+	c.prov.flags[key] = flag
+
+	// 成功
+	// success
+	return nil
+}
+
+// MergeFromSource 将给定来源的配置值合并到当前配置中，例如从远程配置中心获取的值
+// MergeFromSource merges the config values of the given source into the current config, such as values fetched from a remote config center
+func (c *Content) MergeFromSource(source Source, values map[string]any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 合并配置值
+	// merge the config values
+	if err := c.viper.MergeConfigMap(values); err != nil {
+		return err
+	}
+
+	// 记录每个叶子键的来源
+	// record the source of each leaf key
+	tmp := viper.New()
+	if err := tmp.MergeConfigMap(values); err != nil {
+		return err
+	}
+	for _, key := range tmp.AllKeys() {
+		c.prov.values[key] = source
+	}
+
+	// 成功
+	// success
+	return nil
+}
+
+// Explain 返回配置键的有效值和来源，如果键不存在，返回 false
+// Explain returns the effective value and source of a config key, it returns false if the key does not exist
+func (c *Content) Explain(key string) (Provenance, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 如果键没有被设置，返回 false
+	// If the key is not set, return false
+	if !c.viper.IsSet(key) {
+		return Provenance{Key: key}, false
+	}
+
+	// 返回键的值和来源
+	// return the value and source of the key
+	return Provenance{Key: key, Value: c.viper.Get(key), Source: c.resolveSource(key)}, true
+}
+
+// ExplainAll 返回所有配置键的有效值和来源，按键排序
+// ExplainAll returns the effective values and sources of all config keys, sorted by key
+func (c *Content) ExplainAll() []Provenance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 获取所有的键并排序
+	// get all keys and sort them
+	keys := c.viper.AllKeys()
+	sort.Strings(keys)
+
+	// 解析每个键的来源
+	// resolve the source of each key
+	items := make([]Provenance, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, Provenance{Key: key, Value: c.viper.Get(key), Source: c.resolveSource(key)})
+	}
+
+	// 返回结果
+	// return the result
+	return items
+}
+
+// WriteExplainTable 将所有配置键的值和来源以表格形式写入 w，适用于命令行子命令的输出
+// WriteExplainTable writes the values and sources of all config keys to w as a table, suitable for the output of a command line subcommand
+func (c *Content) WriteExplainTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	// 输出表头
+	// output the table header
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+
+	// 输出每个键
+	// output each key
+	for _, item := range c.ExplainAll() {
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", item.Key, item.Value, item.Source)
+	}
+
+	// 刷新输出
+	// flush the output
+	return tw.Flush()
+}
+
+// resolveSource 按照 viper 的优先级解析键的来源：标志、环境变量、配置文件/远程、默认值、标志默认值
+// resolveSource resolves the source of a key by the priority of viper: flag, env, config file/remote, default, flag default
+func (c *Content) resolveSource(key string) Source {
+	// 被修改过的命令行标志优先级最高
+	// A changed command line flag has the highest priority
+	flag := c.prov.flags[key]
+	if flag != nil && flag.Changed {
+		return Source{Kind: SourceFlag, Name: flag.Name}
+	}
+
+	// 其次是非空的环境变量
+	// Then a non-empty env var
+	for _, name := range c.prov.envs[key] {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			return Source{Kind: SourceEnv, Name: name}
+		}
+	}
+
+	// 然后是配置文件或远程配置
+	// Then the config file or remote config
+	if source, ok := c.prov.values[key]; ok {
+		return source
+	}
+
+	// 然后是结构体的默认值
+	// Then the default value of the struct
+	if source, ok := c.prov.defaults[key]; ok {
+		return source
+	}
+
+	// 最后是命令行标志的默认值
+	// Finally the default value of the command line flag
+	if flag != nil {
+		return Source{Kind: SourceFlagDefault, Name: flag.Name}
+	}
+
+	// 来源未被跟踪
+	// The source is not tracked
+	return Source{Kind: SourceUnknown}
+}
+
+// recordFile 记录配置文件中所有键的来源和行号，替换之前记录的配置文件和远程来源。
+// sourceLines 是渲染后每一行对应的模板行号，使行号指向用户编辑的文件，为 nil 表示内容没有经过渲染
+// recordFile records the source and line number of all keys in the config file, replacing the previously recorded file and remote sources.
+// sourceLines are the template line numbers of each rendered line so that the line numbers point to the file the user edits, nil means the content is not rendered
+func (c *Content) recordFile(fileName string, content []byte, sourceLines []int) {
+	// 使用临时的 viper 实例解析配置文件中的键
+	// parse the keys in the config file with a temporary viper instance
+	tmp := viper.New()
+	tmp.SetConfigType(c.config.fileType)
+	if err := tmp.ReadConfig(strings.NewReader(string(content))); err != nil {
+		return
+	}
+
+	// 定位每个键所在的行
+	// locate the line of each key
+	lines := locateKeyLines(content, c.config.fileType)
+
+	// 重新记录配置文件中的键
+	// re-record the keys in the config file
+	c.prov.values = make(map[string]Source)
+	for _, key := range tmp.AllKeys() {
+		line := lookupKeyLine(lines, key)
+		if line > 0 && line <= len(sourceLines) {
+			line = sourceLines[line-1]
+		}
+		c.prov.values[key] = Source{Kind: SourceFile, Name: fileName, Line: line}
+	}
+}
+
+// walkStructKeys 遍历结构体的字段，使用 mapstructure 标签或小写的字段名作为配置键，对每个叶子字段调用 fn
+// walkStructKeys walks the fields of a struct, using the mapstructure tag or the lowercased field name as the config key, and calls fn for each leaf field
+func walkStructKeys(t reflect.Type, prefix, fieldPrefix string, fn func(key, fieldPath string, field reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// 跳过未导出的字段
+		// skip unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		// 获取字段对应的配置键名
+		// get the config key name of the field
+		name, squash := fieldKeyName(field)
+		if name == "-" {
+			continue
+		}
+
+		// 计算配置键和字段路径
+		// compute the config key and the field path
+		key, fieldPath := joinKey(prefix, name), joinKey(fieldPrefix, field.Name)
+		if squash {
+			key = prefix
+		}
+
+		// 获取字段的类型，指针字段使用其元素类型
+		// get the type of the field, the element type is used for pointer fields
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// 嵌套的结构体递归遍历
+		// nested structs are walked recursively
+		if ft.Kind() == reflect.Struct && field.Tag.Get(defaultTagName) == "" {
+			walkStructKeys(ft, key, fieldPath, fn)
+			continue
+		}
+
+		fn(key, fieldPath, field)
+	}
+}
+
+// fieldKeyName 返回字段的配置键名以及是否需要展开到父级
+// fieldKeyName returns the config key name of the field and whether it is squashed into the parent
+func fieldKeyName(field reflect.StructField) (string, bool) {
+	// 解析 mapstructure 标签
+	// parse the mapstructure tag
+	tag := field.Tag.Get("mapstructure")
+	parts := strings.Split(tag, ",")
+	name := strings.TrimSpace(parts[0])
+
+	// 检查是否需要展开
+	// check whether it is squashed
+	squash := false
+	for _, opt := range parts[1:] {
+		if strings.TrimSpace(opt) == "squash" {
+			squash = true
+		}
+	}
+
+	// 没有标签时使用小写的字段名
+	// use the lowercased field name when there is no tag
+	if name == "" {
+		name = field.Name
+	}
+
+	return strings.ToLower(name), squash
+}
+
+// joinKey 使用 "." 连接父级键和子键
+// joinKey joins the parent key and the child key with "."
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContent_Explain(t *testing.T) {
+	// Create a temporary config file for testing
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `
+server:
+  host: example.com
+  port: 9090
+log:
+  level: debug
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Create a new Content instance
+	content := NewContent(NewConfig().SetFileName(fileName).SetFileFormat(YAMLType))
+
+	// Define the data structure with default tags
+	var data struct {
+		Server struct {
+			Host    string `default:"localhost"`
+			Port    int    `default:"8080"`
+			Timeout int    `default:"30"`
+		}
+		Log struct {
+			Level  string `default:"info"`
+			Format string `mapstructure:"fmt" default:"text"`
+		}
+		Region string
+	}
+	assert.NoError(t, content.SetDefaults(&data))
+
+	// Bind an env var and a flag
+	t.Setenv("APP_LOG_LEVEL", "warn")
+	assert.NoError(t, content.BindEnv("log.level", "APP_LOG_LEVEL"))
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("port", 1234, "port")
+	assert.NoError(t, content.BindFlag("server.port", flags.Lookup("port")))
+	assert.NoError(t, flags.Parse([]string{"--port", "7070"}))
+
+	// Load the config file
+	assert.NoError(t, content.LoadFromFile(&data))
+
+	// Merge a remote source
+	assert.NoError(t, content.MergeFromSource(Source{Kind: SourceRemote, Name: "etcd://config/app"}, map[string]any{"region": "eu"}))
+
+	// Verify the sources of the keys
+	item, ok := content.Explain("server.host")
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", item.Value)
+	assert.Equal(t, Source{Kind: SourceFile, Name: fileName, Line: 3}, item.Source)
+
+	item, ok = content.Explain("Server.Port")
+	assert.True(t, ok)
+	assert.Equal(t, Source{Kind: SourceFlag, Name: "port"}, item.Source)
+
+	item, ok = content.Explain("server.timeout")
+	assert.True(t, ok)
+	assert.Equal(t, Source{Kind: SourceDefault, Name: "Server.Timeout"}, item.Source)
+
+	item, ok = content.Explain("log.level")
+	assert.True(t, ok)
+	assert.Equal(t, "warn", item.Value)
+	assert.Equal(t, Source{Kind: SourceEnv, Name: "APP_LOG_LEVEL"}, item.Source)
+
+	item, ok = content.Explain("log.fmt")
+	assert.True(t, ok)
+	assert.Equal(t, "default Log.Format", item.Source.String())
+
+	item, ok = content.Explain("region")
+	assert.True(t, ok)
+	assert.Equal(t, "remote etcd://config/app", item.Source.String())
+
+	_, ok = content.Explain("missing")
+	assert.False(t, ok)
+
+	// Verify the table dump
+	var buf bytes.Buffer
+	assert.NoError(t, content.WriteExplainTable(&buf))
+	assert.Contains(t, buf.String(), "KEY")
+	assert.Contains(t, buf.String(), "file "+fileName+":3")
+	assert.Len(t, content.ExplainAll(), 6)
+}
+
+func TestLocateKeyLines(t *testing.T) {
+	// Locate the keys in JSON content
+	jsonData := `{
+	"key1": "value1",
+	"nested": {
+		"Key2": [1, 2, {"ignored": true}],
+		"key3": "value3"
+	}
+}`
+	assert.Equal(t, map[string]int{"key1": 2, "nested": 3, "nested.key2": 4, "nested.key3": 5}, locateKeyLines([]byte(jsonData), JSONType))
+
+	// Locate the keys in TOML content
+	tomlData := `
+key1 = "value1"
+# comment
+[nested]
+"key2" = 2
+[[items]]
+name = "ignored"
+`
+	lines := locateKeyLines([]byte(tomlData), TOMLType)
+	assert.Equal(t, map[string]int{"key1": 2, "nested": 4, "nested.key2": 5}, lines)
+
+	// Fall back to the line of the parent key
+	assert.Equal(t, 4, lookupKeyLine(lines, "nested.unknown.key"))
+	assert.Equal(t, 0, lookupKeyLine(lines, "unknown"))
+}
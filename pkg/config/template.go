@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateOptions 是配置模板渲染的选项
+// templateOptions are the options for rendering config templates
+type templateOptions struct {
+	// funcs 是模板中可用的函数，会覆盖同名的默认函数
+	// funcs are the functions available in the template, overriding the default functions with the same name
+	funcs template.FuncMap
+
+	// data 是渲染模板时使用的数据
+	// data is the data used when rendering the template
+	data any
+}
+
+// DefaultTemplateFuncs 返回配置模板中默认可用的函数
+// DefaultTemplateFuncs returns the functions available in config templates by default
+func DefaultTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// 环境和主机信息
+		// environment and host information
+		"env":      os.Getenv,
+		"envOr":    envOr,
+		"hostname": hostname,
+		"numCPU":   runtime.NumCPU,
+
+		// 默认值和必填检查
+		// default values and required checks
+		"default":  defaultValue,
+		"required": required,
+
+		// 字符串处理
+		// string processing
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+		"trim":      strings.TrimSpace,
+		"quote":     func(s string) string { return fmt.Sprintf("%q", s) },
+		"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":      func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+
+		// 整数运算
+		// integer arithmetic
+		"add": func(a, b int) int { return a + b },
+		"sub": func(a, b int) int { return a - b },
+		"mul": func(a, b int) int { return a * b },
+		"div": div,
+	}
+}
+
+// SetTemplate 开启配置内容的模板预处理，在解析之前使用 text/template 渲染原始内容。
+// data 是渲染时使用的数据，funcs 会追加到 DefaultTemplateFuncs 中并覆盖同名的函数。
+// SetTemplate enables template pre-processing of the config content, rendering the raw content with text/template before parsing.
+// data is the data used when rendering, funcs are added to DefaultTemplateFuncs and override the functions with the same name.
+func (c *Config) SetTemplate(data any, funcs template.FuncMap) *Config {
+	// 设置模板选项
+	// Set the template options
+	c.template = &templateOptions{funcs: funcs, data: data}
+	return c
+}
+
+// renderTemplate 如果开启了模板预处理，使用配置的函数和数据渲染内容，否则原样返回内容
+// renderTemplate renders the content with the configured functions and data if template pre-processing is enabled, otherwise it returns the content as is
+func renderTemplate(conf *Config, name string, content []byte) ([]byte, error) {
+	rendered, _, err := renderTemplateLines(conf, name, content)
+	return rendered, err
+}
+
+// renderTemplateLines 与 renderTemplate 相同，同时返回渲染结果的每一行对应的模板行号，没有开启模板预处理时行号为 nil，表示行号不变
+// renderTemplateLines is the same as renderTemplate, and also returns the template line number of each line of the rendered content, the line numbers are nil when template pre-processing is not enabled, which means the lines are unchanged
+func renderTemplateLines(conf *Config, name string, content []byte) ([]byte, []int, error) {
+	// 如果没有开启模板预处理，直接返回
+	// If template pre-processing is not enabled, return directly
+	if conf.template == nil {
+		return content, nil, nil
+	}
+
+	// 合并默认函数和自定义函数
+	// merge the default functions and the custom functions
+	funcs := DefaultTemplateFuncs()
+	for key, fn := range conf.template.funcs {
+		funcs[key] = fn
+	}
+
+	// 解析模板，并在每个节点之前插入标记其模板行号的文本
+	// parse the template and insert the text marking the template line number before each node
+	tmpl, err := template.New(name).Funcs(funcs).Parse(string(content))
+	if err != nil {
+		return nil, nil, err
+	}
+	markTemplateLines(tmpl.Tree.Root, content)
+
+	// 渲染模板
+	// render the template
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, conf.template.data); err != nil {
+		return nil, nil, err
+	}
+
+	// 去掉行号标记，返回渲染后的内容和行号
+	// strip the line markers and return the rendered content and the line numbers
+	rendered, lines := stripLineMarkers(buf.Bytes())
+	return rendered, lines, nil
+}
+
+// lineMarker 包围插入到渲染结果中的模板行号
+// lineMarker surrounds the template line numbers inserted into the rendered content
+const lineMarker = '\x00'
+
+// markTemplateLines 在列表的每个节点之前插入行号标记，多行的文本按行拆分，因此一个动作展开的所有行都对应动作所在的行，文本的每一行对应它自己的行
+// markTemplateLines inserts a line marker before each node of the list, multi-line texts are split by lines, so all lines expanded from an action map to the line of the action, and each line of a text maps to its own line
+func markTemplateLines(list *parse.ListNode, src []byte) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, len(list.Nodes)*2)
+	for _, node := range list.Nodes {
+		line := 1 + bytes.Count(src[:int(node.Position())], []byte("\n"))
+
+		// 递归处理条件和循环中的节点
+		// handle the nodes in conditions and loops recursively
+		switch n := node.(type) {
+		case *parse.TextNode:
+			for i, part := range bytes.SplitAfter(n.Text, []byte("\n")) {
+				if len(part) > 0 {
+					nodes = append(nodes, lineMarkerNode(line+i), &parse.TextNode{NodeType: parse.NodeText, Pos: n.Pos, Text: part})
+				}
+			}
+			continue
+		case *parse.IfNode:
+			markTemplateLines(n.List, src)
+			markTemplateLines(n.ElseList, src)
+		case *parse.RangeNode:
+			markTemplateLines(n.List, src)
+			markTemplateLines(n.ElseList, src)
+		case *parse.WithNode:
+			markTemplateLines(n.List, src)
+			markTemplateLines(n.ElseList, src)
+		}
+		nodes = append(nodes, lineMarkerNode(line), node)
+	}
+	list.Nodes = nodes
+}
+
+// lineMarkerNode 返回标记模板行号的文本节点
+// lineMarkerNode returns the text node marking the template line number
+func lineMarkerNode(line int) *parse.TextNode {
+	return &parse.TextNode{NodeType: parse.NodeText, Text: []byte(string(lineMarker) + strconv.Itoa(line) + string(lineMarker))}
+}
+
+// stripLineMarkers 去掉渲染结果中的行号标记，返回内容和每一行开始时所在的模板行号
+// stripLineMarkers strips the line markers from the rendered content, returning the content and the template line number at the start of each line
+func stripLineMarkers(marked []byte) ([]byte, []int) {
+	content := make([]byte, 0, len(marked))
+	lines := []int{0}
+	current, lineStart := 0, true
+	for i := 0; i < len(marked); i++ {
+		// 读取行号标记，未闭合或不是行号的标记字节作为普通内容保留
+		// read the line marker, a marker byte that is unterminated or does not hold a line number is kept as normal content
+		if marked[i] == lineMarker {
+			if end := bytes.IndexByte(marked[i+1:], lineMarker); end >= 0 {
+				if line, err := strconv.Atoi(string(marked[i+1 : i+1+end])); err == nil {
+					current = line
+					i += end + 1
+					continue
+				}
+			}
+		}
+
+		// 记录每一行第一个字符所在的模板行号
+		// record the template line number of the first character of each line
+		if lineStart {
+			lines[len(lines)-1], lineStart = current, false
+		}
+		content = append(content, marked[i])
+		if marked[i] == '\n' {
+			lines, lineStart = append(lines, current), true
+		}
+	}
+	return content, lines
+}
+
+// envOr 返回环境变量的值，如果环境变量不存在或为空，返回默认值
+// envOr returns the value of the env var, or the default value if the env var does not exist or is empty
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// hostname 返回主机名，获取失败时返回空字符串
+// hostname returns the host name, or an empty string if it cannot be obtained
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// defaultValue 如果 value 是空值，返回 def，否则返回 value，用法与 sprig 的 default 相同：{{ .Port | default 8080 }}
+// defaultValue returns def if value is empty, otherwise value, it is used the same way as the default of sprig: {{ .Port | default 8080 }}
+func defaultValue(def any, value ...any) any {
+	if len(value) == 0 || isEmptyValue(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// required 如果 value 是空值，返回带有 message 的错误，否则返回 value
+// required returns an error with message if value is empty, otherwise value
+func required(message string, value any) (any, error) {
+	if isEmptyValue(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+// div 返回 a 除以 b 的结果，b 为 0 时返回错误
+// div returns a divided by b, or an error if b is 0
+func div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return a / b, nil
+}
+
+// isEmptyValue 检查值是否是空值
+// isEmptyValue checks whether the value is empty
+func isEmptyValue(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
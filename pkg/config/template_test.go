@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContent_LoadFromFile_Template(t *testing.T) {
+	// Create a config template file for testing
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `
+host: {{ hostname }}
+port: {{ .Port }}
+workers: {{ mul numCPU 2 }}
+region: {{ env "TEST_CONFIG_REGION" | default "us" }}
+zone: {{ envOr "TEST_CONFIG_ZONE" "a" | upper }}
+name: {{ greet .Name }}
+timeout: {{ .Timeout | default 30 }}
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+	t.Setenv("TEST_CONFIG_REGION", "")
+
+	// Create a new Content instance with template pre-processing
+	funcs := template.FuncMap{"greet": func(name string) string { return "hello-" + name }}
+	cfg := NewConfig().SetFileName(fileName).SetFileFormat(YAMLType).SetTemplate(map[string]any{"Port": 9090, "Name": "lee"}, funcs)
+	content := NewContent(cfg)
+
+	// Define the expected data structure for unmarshaling
+	var data struct {
+		Host    string
+		Port    int
+		Workers int
+		Region  string
+		Zone    string
+		Name    string
+		Timeout int
+	}
+
+	// Call the LoadFromFile method
+	err := content.LoadFromFile(&data)
+	assert.NoError(t, err)
+
+	// Verify the loaded data
+	host, _ := os.Hostname()
+	assert.Equal(t, host, data.Host)
+	assert.Equal(t, 9090, data.Port)
+	assert.Equal(t, runtime.NumCPU()*2, data.Workers)
+	assert.Equal(t, "us", data.Region)
+	assert.Equal(t, "A", data.Zone)
+	assert.Equal(t, "hello-lee", data.Name)
+	assert.Equal(t, 30, data.Timeout)
+
+	// Verify the provenance refers to the line in the template file
+	item, ok := content.Explain("port")
+	assert.True(t, ok)
+	assert.Equal(t, 3, item.Source.Line)
+}
+
+func TestContent_LoadFromFile_TemplateLines(t *testing.T) {
+	// Create a config template file whose actions expand to several lines
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	testData := `labels:
+{{ .Labels }}
+servers:
+{{- range .Servers }}
+  {{ . }}:
+    enabled: true
+{{- end }}
+port: 8080
+`
+	assert.NoError(t, os.WriteFile(fileName, []byte(testData), 0644))
+
+	// Load the config file rendered with the data
+	labels := "  a: 1\n  b: 2\n  c: 3"
+	cfg := NewConfig().SetFileName(fileName).SetFileFormat(YAMLType).SetTemplate(map[string]any{"Labels": labels, "Servers": []string{"one", "two"}}, nil)
+	content := NewContent(cfg)
+	var data map[string]any
+	assert.NoError(t, content.LoadFromFile(&data))
+
+	// Verify the lines refer to the template file instead of the rendered content
+	tests := map[string]int{
+		"labels.a":            2,
+		"labels.c":            2,
+		"servers.one.enabled": 6,
+		"servers.two.enabled": 6,
+		"port":                8,
+	}
+	for key, line := range tests {
+		item, ok := content.Explain(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, line, item.Source.Line, key)
+	}
+}
+
+func TestStreamContent_LoadFromStream_Template(t *testing.T) {
+	// Create a new StreamContent instance with template pre-processing
+	cfg := NewConfig().SetFileFormat(JSONType).SetReader(strings.NewReader(`{"key1": "{{ .Key1 }}"}`)).SetTemplate(struct{ Key1 string }{"value1"}, nil)
+	cfg.AddReader(strings.NewReader(`key2 = "{{ lower "VALUE2" }}"`), TOMLType)
+	content := NewStreamContent(cfg)
+
+	// Define the expected data structure for unmarshaling
+	var data struct {
+		Key1 string `json:"key1"`
+		Key2 string `json:"key2"`
+	}
+
+	// Call the LoadFromStream method
+	err := content.LoadFromStream(&data)
+	assert.NoError(t, err)
+
+	// Verify the loaded data
+	assert.Equal(t, "value1", data.Key1)
+	assert.Equal(t, "value2", data.Key2)
+}
+
+func TestRenderTemplate_Errors(t *testing.T) {
+	// A broken template fails to parse
+	_, err := renderTemplate(NewConfig().SetTemplate(nil, nil), "broken", []byte(`{{ .Key `))
+	assert.Error(t, err)
+
+	// A missing required value fails to render
+	_, err = renderTemplate(NewConfig().SetTemplate(map[string]any{}, nil), "required", []byte(`{{ required "key is required" .Key }}`))
+	assert.EqualError(t, err, `template: required:1:3: executing "required" at <required "key is required" .Key>: error calling required: key is required`)
+
+	// The content is returned as is when template pre-processing is not enabled
+	content, err := renderTemplate(NewConfig(), "plain", []byte(`{{ .Key }}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{{ .Key }}`, string(content))
+}
+
+func TestStripLineMarkers(t *testing.T) {
+	// The markers are removed and the lines keep their template line numbers
+	content, lines := stripLineMarkers([]byte("\x001\x00a: 1\n\x003\x00b: 2\n"))
+	assert.Equal(t, "a: 1\nb: 2\n", string(content))
+	assert.Equal(t, []int{1, 3, 3}, lines)
+
+	// Unterminated markers and markers without a line number are kept, the rest of the content is not cut off
+	content, lines = stripLineMarkers([]byte("\x001\x00a: \x00x\x00\nb: \x002"))
+	assert.Equal(t, "a: \x00x\x00\nb: \x002", string(content))
+	assert.Equal(t, []int{1, 1}, lines)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat 是访问日志的格式
+// AccessLogFormat is the format of the access log
+type AccessLogFormat int
+
+const (
+	// AccessLogText 是一行空格分隔的文本：时间、远程地址、方法、URI、状态码、字节数、耗时和请求 ID
+	// AccessLogText is a line of space separated text: time, remote address, method, URI, status code, bytes, latency and request ID
+	AccessLogText AccessLogFormat = iota
+
+	// AccessLogJSON 是一行 JSON 对象
+	// AccessLogJSON is a line of JSON object
+	AccessLogJSON
+)
+
+// AccessEntry 是一条访问日志
+// AccessEntry is an access log entry
+type AccessEntry struct {
+	// Time 是请求开始的时间
+	// Time is the time the request started
+	Time time.Time `json:"time"`
+
+	// RemoteAddr 是客户端的地址
+	// RemoteAddr is the address of the client
+	RemoteAddr string `json:"remote_addr"`
+
+	// Method 是请求的方法
+	// Method is the method of the request
+	Method string `json:"method"`
+
+	// Path 是请求的 URI，包含查询参数
+	// Path is the URI of the request, including the query parameters
+	Path string `json:"path"`
+
+	// Status 是响应的状态码
+	// Status is the status code of the response
+	Status int `json:"status"`
+
+	// Bytes 是响应体的字节数
+	// Bytes is the number of bytes of the response body
+	Bytes int64 `json:"bytes"`
+
+	// Latency 是处理请求花费的时间
+	// Latency is the time spent handling the request
+	Latency time.Duration `json:"-"`
+
+	// LatencyMs 是以毫秒表示的耗时，用于 JSON 输出
+	// LatencyMs is the latency in milliseconds, used by the JSON output
+	LatencyMs float64 `json:"latency_ms"`
+
+	// RequestID 是请求 ID，没有时为空
+	// RequestID is the request ID, it is empty if there is none
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// fields 返回访问日志的键值对，用于带级别的日志记录器
+// fields returns the key-value pairs of the access log, used by leveled loggers
+func (e *AccessEntry) fields() []interface{} {
+	return []interface{}{
+		"method", e.Method,
+		"path", e.Path,
+		"status", e.Status,
+		"bytes", e.Bytes,
+		"latency", e.Latency,
+		"remote_addr", e.RemoteAddr,
+		"request_id", e.RequestID,
+	}
+}
+
+// accessLog 返回一个在每个请求完成后调用 emit 的中间件
+// accessLog returns a middleware calling emit after each request completes
+func accessLog(emit func(*AccessEntry)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			// 请求 ID 可能由外层的中间件放入上下文，或者由内层的中间件写入响应头
+			// The request ID may be put into the context by an outer middleware or written to the response header by an inner middleware
+			id := RequestIDFromContext(r.Context())
+			if id == "" {
+				id = rec.Header().Get(RequestIDHeader)
+			}
+
+			latency := time.Since(start)
+			emit(&AccessEntry{
+				Time:       start,
+				RemoteAddr: r.RemoteAddr,
+				Method:     r.Method,
+				Path:       r.URL.RequestURI(),
+				Status:     rec.Status(),
+				Bytes:      rec.bytes,
+				Latency:    latency,
+				LatencyMs:  float64(latency.Microseconds()) / 1000,
+				RequestID:  id,
+			})
+		})
+	}
+}
+
+// AccessLog 返回一个访问日志中间件，每个请求完成后向 w 写入一行文本，格式见 AccessLogText
+// AccessLog returns an access log middleware, a line of text is written to w after each request completes, see AccessLogText for the format
+func AccessLog(w io.Writer) Middleware {
+	return AccessLogWithFormat(w, AccessLogText)
+}
+
+// AccessLogWithFormat 返回一个访问日志中间件，每个请求完成后按照指定的格式向 w 写入一行，并发的写入是串行的
+// AccessLogWithFormat returns an access log middleware, a line in the given format is written to w after each request completes, concurrent writes are serialized
+func AccessLogWithFormat(w io.Writer, format AccessLogFormat) Middleware {
+	mu := sync.Mutex{}
+	return accessLog(func(e *AccessEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// 按照格式写入一行
+		// Write a line in the format
+		if format == AccessLogJSON {
+			_ = json.NewEncoder(w).Encode(e)
+			return
+		}
+		id := e.RequestID
+		if id == "" {
+			id = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s %s %s %q %d %d %s %s\n",
+			e.Time.Format(time.RFC3339), e.RemoteAddr, e.Method, e.Path, e.Status, e.Bytes, e.Latency, id)
+	})
+}
+
+// AccessLogToLogger 返回一个访问日志中间件，每个请求完成后以信息级别和键值对字段记录到日志记录器
+// AccessLogToLogger returns an access log middleware, each request is recorded to the logger at info level with key-value fields after it completes
+func AccessLogToLogger(logger LeveledLogger) Middleware {
+	if logger == nil {
+		logger = &defaultLogger{}
+	}
+	return accessLog(func(e *AccessEntry) {
+		logger.Info("http request", e.fields()...)
+	})
+}
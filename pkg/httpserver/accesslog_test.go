@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// created is a handler answering 201 with a body of 5 bytes
+var created = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusCreated)
+	_, _ = io.WriteString(w, "hello")
+})
+
+// leveledRecorder is a LeveledLogger recording the info logs
+type leveledRecorder struct {
+	recordLogger
+	infos [][]interface{}
+}
+
+func (l *leveledRecorder) Debug(string, ...interface{}) {}
+func (l *leveledRecorder) Warn(string, ...interface{})  {}
+func (l *leveledRecorder) Error(string, ...interface{}) {}
+func (l *leveledRecorder) Info(msg string, keysAndValues ...interface{}) {
+	l.infos = append(l.infos, append([]interface{}{msg}, keysAndValues...))
+}
+
+// accessRequest returns a request with a request ID
+func accessRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/items?x=1", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	return req
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := Chain(created, RequestID(), AccessLog(buf))
+
+	// The line contains the request and response details
+	handler.ServeHTTP(httptest.NewRecorder(), accessRequest())
+	fields := strings.Fields(buf.String())
+	if assert.Len(t, fields, 8) {
+		assert.Equal(t, []string{"192.0.2.1:1234", "POST", `"/items?x=1"`, "201", "5"}, fields[1:6])
+		assert.Equal(t, "req-1", fields[7])
+	}
+}
+
+func TestAccessLogWithFormat_JSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := Chain(created, RequestID(), AccessLogWithFormat(buf, AccessLogJSON))
+
+	// The line is a JSON object
+	handler.ServeHTTP(httptest.NewRecorder(), accessRequest())
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/items?x=1", entry["path"])
+	assert.Equal(t, float64(201), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes"])
+	assert.Equal(t, "192.0.2.1:1234", entry["remote_addr"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Contains(t, entry, "latency_ms")
+	assert.Contains(t, entry, "time")
+}
+
+func TestAccessLogToLogger(t *testing.T) {
+	logger := &leveledRecorder{}
+	handler := Chain(created, RequestID(), AccessLogToLogger(logger))
+
+	// The request is recorded at info level with fields
+	handler.ServeHTTP(httptest.NewRecorder(), accessRequest())
+	if assert.Len(t, logger.infos, 1) {
+		info := logger.infos[0]
+		assert.Equal(t, []interface{}{"http request", "method", "POST", "path", "/items?x=1", "status", 201, "bytes", int64(5)}, info[:9])
+		assert.Equal(t, []interface{}{"remote_addr", "192.0.2.1:1234", "request_id", "req-1"}, info[11:])
+	}
+}
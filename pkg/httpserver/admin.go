@@ -0,0 +1,188 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+)
+
+const (
+	// adminSocketMode 是管理端 Unix 域套接字文件的权限，只有所有者可以连接
+	// adminSocketMode is the permission of the admin Unix domain socket file, only the owner can connect
+	adminSocketMode os.FileMode = 0o600
+)
+
+// adminOptions 是管理端的配置
+// adminOptions is the configuration of the admin endpoint
+type adminOptions struct {
+	// address 是管理端监听的地址，可以是 TCP 地址或者 unix: 开头的 Unix 域套接字路径
+	// address is the address the admin endpoint listens on, it can be a TCP address or a Unix domain socket path starting with unix:
+	address string
+
+	// token 是访问管理端需要的令牌，为空表示不需要令牌
+	// token is the token required to access the admin endpoint, empty means no token is required
+	token string
+}
+
+// WithAdmin 在独立的监听器上开启管理端，提供 pprof、expvar、goroutine 转储和构建信息，永远不会与公开的端口共享。
+// 地址可以是 TCP 地址，例如 "127.0.0.1:6060"，或者 Unix 域套接字，例如 "unix:/run/app/admin.sock"
+// WithAdmin enables the admin endpoint on a separate listener, serving pprof, expvar, goroutine dumps and build info, it never shares the public port.
+// The address can be a TCP address, such as "127.0.0.1:6060", or a Unix domain socket, such as "unix:/run/app/admin.sock"
+func WithAdmin(address string) Option {
+	return func(o *options) {
+		o.adminOpts().address = address
+	}
+}
+
+// WithAdminToken 设置访问管理端需要的令牌，请求必须带有 Authorization: Bearer <token> 请求头
+// WithAdminToken sets the token required to access the admin endpoint, requests must carry the Authorization: Bearer <token> header
+func WithAdminToken(token string) Option {
+	return func(o *options) {
+		o.adminOpts().token = token
+	}
+}
+
+// adminOpts 返回管理端的配置，不存在时创建一个
+// adminOpts returns the configuration of the admin endpoint, creating one if it does not exist
+func (o *options) adminOpts() *adminOptions {
+	if o.admin == nil {
+		o.admin = &adminOptions{}
+	}
+	return o.admin
+}
+
+// validate 检查管理端的配置是否有效，addr 是公开的监听地址
+// validate checks whether the configuration of the admin endpoint is valid, addr is the public listening address
+func (a *adminOptions) validate(addr string) error {
+	switch {
+	case a.address == "" || a.address == unixPrefix:
+		return fmt.Errorf("%w: admin address is required", ErrInvalidOption)
+	case a.address == addr && !strings.HasSuffix(addr, ":0"):
+		return fmt.Errorf("%w: admin address %q must differ from the public address", ErrInvalidOption, a.address)
+	}
+	return nil
+}
+
+// newAdminHandler 创建管理端的处理器
+// newAdminHandler creates the handler of the admin endpoint
+func newAdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+
+	// pprof 性能分析
+	// pprof profiling
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// expvar 变量、goroutine 转储和构建信息
+	// expvar variables, goroutine dumps and build info
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutinesHandler)
+	mux.HandleFunc("/debug/buildinfo", buildInfoHandler)
+
+	if token == "" {
+		return mux
+	}
+	return requireToken(token, mux)
+}
+
+// requireToken 返回要求 Bearer 令牌的处理器，令牌使用常量时间比较
+// requireToken returns the handler requiring the bearer token, the token is compared in constant time
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+		if given == auth || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// goroutinesHandler 以文本格式输出所有 goroutine 的调用栈
+// goroutinesHandler writes the stacks of all goroutines in text format
+func goroutinesHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// BuildInfo 是管理端输出的构建信息
+// BuildInfo is the build info written by the admin endpoint
+type BuildInfo struct {
+	// GoVersion 是构建使用的 Go 版本
+	// GoVersion is the Go version used for the build
+	GoVersion string `json:"go_version"`
+
+	// Path 是主包的路径
+	// Path is the path of the main package
+	Path string `json:"path"`
+
+	// Main 是主模块
+	// Main is the main module
+	Main debug.Module `json:"main"`
+
+	// Deps 是依赖的模块
+	// Deps are the dependency modules
+	Deps []*debug.Module `json:"deps"`
+
+	// Settings 是构建设置，例如 vcs.revision
+	// Settings are the build settings, such as vcs.revision
+	Settings map[string]string `json:"settings"`
+
+	// NumGoroutine 是当前的 goroutine 数量
+	// NumGoroutine is the current number of goroutines
+	NumGoroutine int `json:"num_goroutine"`
+}
+
+// buildInfoHandler 以 JSON 格式输出构建信息
+// buildInfoHandler writes the build info in JSON format
+func buildInfoHandler(w http.ResponseWriter, _ *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info is not available", http.StatusNotFound)
+		return
+	}
+
+	// 转换构建信息
+	// Convert the build info
+	result := BuildInfo{
+		GoVersion:    info.GoVersion,
+		Path:         info.Path,
+		Main:         info.Main,
+		Deps:         info.Deps,
+		Settings:     make(map[string]string, len(info.Settings)),
+		NumGoroutine: runtime.NumGoroutine(),
+	}
+	for _, setting := range info.Settings {
+		result.Settings[setting.Key] = setting.Value
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// AdminAddr 返回管理端实际监听的地址，没有开启管理端或者服务器未启动时返回 nil
+// AdminAddr returns the address the admin endpoint actually listens on, nil is returned if the admin endpoint is disabled or the server is not started
+func (s *TinyHttpServer) AdminAddr() net.Addr {
+	select {
+	case <-s.ready:
+		if s.adminListener != nil {
+			return s.adminListener.Addr()
+		}
+	default:
+	}
+	return nil
+}
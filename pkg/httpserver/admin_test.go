@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// adminGet sends a GET request with the token and returns the status code and body
+func adminGet(t *testing.T, client *http.Client, url, token string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if !assert.NoError(t, err) {
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestTinyHttpServer_Admin(t *testing.T) {
+	// Start a server with the admin endpoint protected by a token
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithAdmin("127.0.0.1:0"), WithAdminToken("secret"))
+	assert.NoError(t, err)
+	assert.Nil(t, srv.AdminAddr())
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	admin := fmt.Sprintf("http://%s", srv.AdminAddr())
+	assert.NotEqual(t, srv.Addr().String(), srv.AdminAddr().String())
+
+	// Requests without the right token are rejected
+	code, _ := adminGet(t, http.DefaultClient, admin+"/debug/pprof/", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = adminGet(t, http.DefaultClient, admin+"/debug/pprof/", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// The debug endpoints are served with the token
+	code, body := adminGet(t, http.DefaultClient, admin+"/debug/pprof/", "secret")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "goroutine")
+	code, body = adminGet(t, http.DefaultClient, admin+"/debug/goroutines", "secret")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "goroutine 1 [")
+	code, body = adminGet(t, http.DefaultClient, admin+"/debug/vars", "secret")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "memstats")
+	code, body = adminGet(t, http.DefaultClient, admin+"/debug/buildinfo", "secret")
+	assert.Equal(t, http.StatusOK, code)
+	info := BuildInfo{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &info))
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+
+	// The public port does not serve the debug endpoints
+	code, _ = get(t, fmt.Sprintf("http://%s/debug/pprof/", srv.Addr()))
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestTinyHttpServer_AdminUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix domain sockets are not tested on windows")
+	}
+
+	// Leave a stale socket file at the path
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	stale, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.NoError(t, stale.Close())
+
+	// Start a server with the admin endpoint on the socket
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithAdmin("unix:"+path))
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+
+	// The socket is only accessible by the owner
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// The debug endpoints are served on the socket
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	code, _ := adminGet(t, client, "http://admin/debug/goroutines", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	// The socket file is removed after the server stops
+	srv.Stop()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewWithOptions_InvalidAdmin(t *testing.T) {
+	tests := map[string][]Option{
+		"missing address": {WithAdminToken("secret")},
+		"empty socket":    {WithAdmin("unix:")},
+		"public address":  {WithAddress("127.0.0.1:9000"), WithAdmin("127.0.0.1:9000")},
+	}
+	for name, opts := range tests {
+		srv, err := NewWithOptions(opts...)
+		assert.ErrorIs(t, err, ErrInvalidOption, name)
+		assert.Nil(t, srv, name)
+	}
+}
+
+func TestTinyHttpServer_AdminBindError(t *testing.T) {
+	// Occupy a port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	// The server fails to start and releases the public port
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithAdmin(ln.Addr().String()))
+	assert.NoError(t, err)
+	assert.Error(t, srv.Start())
+	assert.Nil(t, srv.Addr())
+}
@@ -0,0 +1,385 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SchemeBasic 是 HTTP Basic 认证的方案名称
+	// SchemeBasic is the scheme name of the HTTP Basic authentication
+	SchemeBasic = "basic"
+
+	// SchemeBearer 是 Bearer 令牌认证的方案名称
+	// SchemeBearer is the scheme name of the bearer token authentication
+	SchemeBearer = "bearer"
+
+	// SchemeHMAC 是 HMAC 请求签名认证的方案名称
+	// SchemeHMAC is the scheme name of the HMAC request signing authentication
+	SchemeHMAC = "hmac"
+
+	// HMACKeyHeader 是携带签名密钥 ID 的请求头
+	// HMACKeyHeader is the header carrying the ID of the signing key
+	HMACKeyHeader = "X-Auth-Key"
+
+	// HMACTimestampHeader 是携带签名时间的请求头，值是 Unix 秒
+	// HMACTimestampHeader is the header carrying the signing time, the value is in Unix seconds
+	HMACTimestampHeader = "X-Auth-Timestamp"
+
+	// HMACSignatureHeader 是携带十六进制 HMAC-SHA256 签名的请求头
+	// HMACSignatureHeader is the header carrying the hexadecimal HMAC-SHA256 signature
+	HMACSignatureHeader = "X-Auth-Signature"
+
+	// defaultClockSkew 是默认允许的签名时间与服务器时间的偏差（秒）
+	// defaultClockSkew is the default allowed skew between the signing time and the server time in seconds
+	defaultClockSkew = 300
+)
+
+// placeholderSecret 是未知的密钥 ID 计算签名时使用的占位密钥，使未知密钥的请求与错误签名的请求花费相同的时间
+// placeholderSecret is the placeholder secret used to compute the signature for unknown key IDs, so that requests with unknown keys take the same time as requests with wrong signatures
+var placeholderSecret = make([]byte, sha256.Size)
+
+// Principal 是认证通过的主体
+// Principal is the authenticated principal
+type Principal struct {
+	// Name 是主体的名称，例如用户名、令牌的所有者或者签名密钥的 ID
+	// Name is the name of the principal, such as the username, the owner of the token or the ID of the signing key
+	Name string
+
+	// Scheme 是认证使用的方案，例如 SchemeBasic
+	// Scheme is the scheme used for the authentication, such as SchemeBasic
+	Scheme string
+}
+
+// PrincipalFromContext 返回上下文中认证通过的主体，请求没有经过认证中间件时返回 nil 和 false
+// PrincipalFromContext returns the authenticated principal in the context, nil and false are returned if the request did not pass an authentication middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey).(*Principal)
+	return p, ok
+}
+
+// withPrincipal 返回带有认证主体的请求
+// withPrincipal returns the request carrying the authenticated principal
+func withPrincipal(r *http.Request, name, scheme string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey, &Principal{Name: name, Scheme: scheme}))
+}
+
+// UserStore 是 HTTP Basic 认证使用的用户存储
+// UserStore is the user store used by the HTTP Basic authentication
+type UserStore interface {
+	// Password 返回用户的密码，用户不存在时返回 false
+	// Password returns the password of the user, false is returned if the user does not exist
+	Password(username string) (string, bool)
+}
+
+// StaticUsers 是用户名到密码的固定映射
+// StaticUsers is a fixed map from usernames to passwords
+type StaticUsers map[string]string
+
+// Password 返回用户的密码
+// Password returns the password of the user
+func (u StaticUsers) Password(username string) (string, bool) {
+	password, ok := u[username]
+	return password, ok
+}
+
+// BasicAuth 返回一个要求 HTTP Basic 认证的中间件，realm 是提示给客户端的保护域。密码使用常量时间比较，用户不存在时也进行同样的比较，
+// 认证失败时返回 401、WWW-Authenticate 响应头和 httptool.BaseHttpResponse 格式的 JSON 响应体。users 为 nil 时会 panic
+// BasicAuth returns a middleware requiring the HTTP Basic authentication, realm is the protection space shown to clients. Passwords are compared in constant time, the same comparison is done even if the user does not exist,
+// 401, the WWW-Authenticate header and a JSON body in the format of httptool.BaseHttpResponse are returned on failure. It panics if users is nil
+func BasicAuth(realm string, users UserStore) Middleware {
+	if users == nil {
+		panic("server: nil user store")
+	}
+	challenge := `Basic realm=` + strconv.Quote(realm) + `, charset="UTF-8"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if ok {
+				expected, found := users.Password(username)
+				ok = constantTimeEqual(password, expected) && found
+			}
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge)
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, username, SchemeBasic))
+		})
+	}
+}
+
+// constantTimeEqual 以常量时间比较两个字符串，先计算摘要以免泄露长度
+// constantTimeEqual compares two strings in constant time, the digests are computed first so that the lengths are not leaked
+func constantTimeEqual(a, b string) bool {
+	da, db := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(da[:], db[:]) == 1
+}
+
+// TokenStore 是 Bearer 令牌认证使用的令牌存储
+// TokenStore is the token store used by the bearer token authentication
+type TokenStore interface {
+	// Lookup 返回令牌所属主体的名称，令牌无效时返回 false
+	// Lookup returns the name of the principal owning the token, false is returned if the token is invalid
+	Lookup(token string) (string, bool)
+}
+
+// Tokens 是可以在运行时轮换的令牌存储，令牌只以 SHA-256 摘要的形式保存，可以安全地并发使用。零值是可以直接使用的空存储
+// Tokens is a token store which can be rotated at runtime, tokens are only kept as SHA-256 digests, it is safe for concurrent use. The zero value is an empty store ready to use
+type Tokens struct {
+	// mu 保护 digests
+	// mu protects digests
+	mu sync.RWMutex
+
+	// digests 是令牌摘要到主体名称的映射
+	// digests is the map from token digests to principal names
+	digests map[[sha256.Size]byte]string
+}
+
+// NewTokens 创建令牌存储，tokens 是令牌到主体名称的映射
+// NewTokens creates a token store, tokens is the map from tokens to principal names
+func NewTokens(tokens map[string]string) *Tokens {
+	t := &Tokens{}
+	t.Replace(tokens)
+	return t
+}
+
+// Lookup 返回令牌所属主体的名称
+// Lookup returns the name of the principal owning the token
+func (t *Tokens) Lookup(token string) (string, bool) {
+	digest := sha256.Sum256([]byte(token))
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	name, ok := t.digests[digest]
+	return name, ok
+}
+
+// Add 添加一个令牌，轮换时先添加新令牌，客户端切换后再撤销旧令牌
+// Add adds a token, when rotating add the new token first and revoke the old one after clients switched
+func (t *Tokens) Add(token, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.digests == nil {
+		t.digests = make(map[[sha256.Size]byte]string)
+	}
+	t.digests[sha256.Sum256([]byte(token))] = name
+}
+
+// Revoke 撤销一个令牌
+// Revoke revokes a token
+func (t *Tokens) Revoke(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.digests, sha256.Sum256([]byte(token)))
+}
+
+// Replace 用新的令牌替换所有的令牌
+// Replace replaces all tokens with the new tokens
+func (t *Tokens) Replace(tokens map[string]string) {
+	digests := make(map[[sha256.Size]byte]string, len(tokens))
+	for token, name := range tokens {
+		digests[sha256.Sum256([]byte(token))] = name
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.digests = digests
+}
+
+// BearerAuth 返回一个要求 Authorization: Bearer <token> 请求头的中间件，令牌通过 tokens 查找。
+// 认证失败时返回 401、WWW-Authenticate 响应头和 httptool.BaseHttpResponse 格式的 JSON 响应体。tokens 为 nil 时会 panic
+// BearerAuth returns a middleware requiring the Authorization: Bearer <token> header, tokens are looked up with tokens.
+// 401, the WWW-Authenticate header and a JSON body in the format of httptool.BaseHttpResponse are returned on failure. It panics if tokens is nil
+func BearerAuth(tokens TokenStore) Middleware {
+	if tokens == nil {
+		panic("server: nil token store")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 没有令牌时只返回质询，令牌无效时附带错误码
+			// Only the challenge is returned without a token, the error code is added when the token is invalid
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			name, ok := tokens.Lookup(token)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, name, SchemeBearer))
+		})
+	}
+}
+
+// bearerToken 返回 Authorization 请求头中的 Bearer 令牌，方案名称不区分大小写
+// bearerToken returns the bearer token in the Authorization header, the scheme name is case-insensitive
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[len("Bearer "):])
+	return token, token != ""
+}
+
+// SecretStore 是 HMAC 请求签名认证使用的密钥存储
+// SecretStore is the secret store used by the HMAC request signing authentication
+type SecretStore interface {
+	// Secret 返回密钥 ID 对应的密钥，密钥不存在时返回 false
+	// Secret returns the secret of the key ID, false is returned if the key does not exist
+	Secret(keyID string) ([]byte, bool)
+}
+
+// StaticSecrets 是密钥 ID 到密钥的固定映射
+// StaticSecrets is a fixed map from key IDs to secrets
+type StaticSecrets map[string][]byte
+
+// Secret 返回密钥 ID 对应的密钥
+// Secret returns the secret of the key ID
+func (s StaticSecrets) Secret(keyID string) ([]byte, bool) {
+	secret, ok := s[keyID]
+	return secret, ok
+}
+
+// HMACOption 是 HMAC 请求签名认证中间件的配置选项
+// HMACOption is a configuration option of the HMAC request signing authentication middleware
+type HMACOption func(*hmacOptions)
+
+// hmacOptions 是 HMAC 请求签名认证中间件的配置
+// hmacOptions is the configuration of the HMAC request signing authentication middleware
+type hmacOptions struct {
+	// skew 是允许的签名时间与服务器时间的偏差
+	// skew is the allowed skew between the signing time and the server time
+	skew time.Duration
+
+	// now 返回当前时间，用于测试
+	// now returns the current time, used for tests
+	now func() time.Time
+}
+
+// WithClockSkew 设置允许的签名时间与服务器时间的偏差，超出偏差的请求被拒绝以防止重放，默认是 5 分钟
+// WithClockSkew sets the allowed skew between the signing time and the server time, requests beyond the skew are rejected to prevent replays, the default is 5 minutes
+func WithClockSkew(skew time.Duration) HMACOption {
+	return func(o *hmacOptions) {
+		if skew > 0 {
+			o.skew = skew
+		}
+	}
+}
+
+// HMACAuth 返回一个验证 HMAC-SHA256 请求签名的中间件。客户端使用 SignRequest 签名请求，签名覆盖请求方法、URI、时间和请求体的摘要，
+// 签名时间与服务器时间的偏差超过允许的范围时拒绝请求。认证失败时返回 401 和 httptool.BaseHttpResponse 格式的 JSON 响应体。
+// 中间件会读取整个请求体，请配合 BodyLimit 使用。secrets 为 nil 时会 panic
+// HMACAuth returns a middleware verifying the HMAC-SHA256 request signatures. Clients sign requests with SignRequest, the signature covers the method, the URI, the time and the digest of the body,
+// requests are rejected when the skew between the signing time and the server time exceeds the allowed range. 401 and a JSON body in the format of httptool.BaseHttpResponse are returned on failure.
+// The middleware reads the whole body, use it together with BodyLimit. It panics if secrets is nil
+func HMACAuth(secrets SecretStore, opts ...HMACOption) Middleware {
+	if secrets == nil {
+		panic("server: nil secret store")
+	}
+	o := &hmacOptions{skew: time.Second * defaultClockSkew, now: time.Now}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 检查签名时间，防止重放旧的请求
+			// Check the signing time to prevent replaying old requests
+			keyID := r.Header.Get(HMACKeyHeader)
+			timestamp, err := strconv.ParseInt(r.Header.Get(HMACTimestampHeader), 10, 64)
+			signature, decodeErr := hex.DecodeString(r.Header.Get(HMACSignatureHeader))
+			if keyID == "" || err != nil || decodeErr != nil || len(signature) == 0 {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			if skew := o.now().Sub(time.Unix(timestamp, 0)); skew > o.skew || skew < -o.skew {
+				writeError(w, http.StatusUnauthorized, "request timestamp is out of range")
+				return
+			}
+
+			// 读取请求体计算摘要，之后恢复请求体供处理器读取
+			// Read the body to compute the digest, and restore the body for the handler afterwards
+			body, err := readBody(r)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+					return
+				}
+				writeError(w, http.StatusBadRequest, "failed to read request body")
+				return
+			}
+
+			// 未知的密钥和错误的签名返回相同的错误，未知的密钥也使用占位密钥计算签名，不通过响应内容或时间泄露密钥是否存在
+			// Unknown keys and wrong signatures return the same error, the signature is also computed with the placeholder secret for unknown keys,
+			// so that the existence of keys is leaked neither by the response nor by the timing
+			secret, ok := secrets.Secret(keyID)
+			if !ok {
+				secret = placeholderSecret
+			}
+			valid := hmac.Equal(signature, sign(secret, r.Method, r.URL.RequestURI(), timestamp, body))
+			if !ok || !valid {
+				writeError(w, http.StatusUnauthorized, "invalid signature")
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, keyID, SchemeHMAC))
+		})
+	}
+}
+
+// SignRequest 使用密钥为请求签名，写入 HMACKeyHeader、HMACTimestampHeader 和 HMACSignatureHeader 请求头，供 HMACAuth 验证。
+// 请求体会被读取并替换为可以重复读取的副本
+// SignRequest signs the request with the secret, writing the HMACKeyHeader, HMACTimestampHeader and HMACSignatureHeader headers verified by HMACAuth.
+// The body is read and replaced with a copy which can be read again
+func SignRequest(r *http.Request, keyID string, secret []byte, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	timestamp := now.Unix()
+	r.Header.Set(HMACKeyHeader, keyID)
+	r.Header.Set(HMACTimestampHeader, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(HMACSignatureHeader, hex.EncodeToString(sign(secret, r.Method, r.URL.RequestURI(), timestamp, body)))
+	return nil
+}
+
+// sign 计算请求的签名，签名的内容是以换行分隔的请求方法、URI、时间和请求体的十六进制 SHA-256 摘要
+// sign computes the signature of the request, the signed content is the method, the URI, the time and the hexadecimal SHA-256 digest of the body separated by newlines
+func sign(secret []byte, method, uri string, timestamp int64, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	_, _ = io.WriteString(mac, method+"\n"+uri+"\n"+strconv.FormatInt(timestamp, 10)+"\n"+hex.EncodeToString(digest[:]))
+	return mac.Sum(nil)
+}
+
+// readBody 读取整个请求体，并把请求体替换为读取的内容
+// readBody reads the whole body and replaces the body with the content read
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// principalHandler writes the name and scheme of the authenticated principal
+func principalHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "no principal", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(p.Name + "/" + p.Scheme))
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	handler := Chain(principalHandler(), BasicAuth("api", StaticUsers{"alice": "secret"}))
+	request := func(username, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if username != "" {
+			r.SetBasicAuth(username, password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// The principal is placed in the context
+	w := request("alice", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice/basic", w.Body.String())
+
+	// Missing credentials, wrong passwords and unknown users are rejected with the challenge
+	for _, w := range []*httptest.ResponseRecorder{request("", ""), request("alice", "wrong"), request("bob", "secret"), request("bob", "")} {
+		assertErrorBody(t, w, http.StatusUnauthorized, "unauthorized")
+		assert.Equal(t, `Basic realm="api", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	tokens := NewTokens(map[string]string{"old-token": "ci"})
+	handler := Chain(principalHandler(), BearerAuth(tokens))
+	request := func(auth string) *httptest.ResponseRecorder {
+		return serve(handler, http.MethodGet, "/", "Authorization", auth)
+	}
+
+	// A valid token is accepted with a case-insensitive scheme
+	assert.Equal(t, "ci/bearer", request("Bearer old-token").Body.String())
+	assert.Equal(t, "ci/bearer", request("bearer old-token").Body.String())
+
+	// Missing and invalid tokens are rejected
+	w := request("")
+	assertErrorBody(t, w, http.StatusUnauthorized, "unauthorized")
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assertErrorBody(t, request("Basic b2xkLXRva2Vu"), http.StatusUnauthorized, "unauthorized")
+	w = request("Bearer wrong")
+	assertErrorBody(t, w, http.StatusUnauthorized, "invalid token")
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+
+	// Rotate the token: both are valid until the old one is revoked
+	tokens.Add("new-token", "ci")
+	assert.Equal(t, http.StatusOK, request("Bearer new-token").Code)
+	assert.Equal(t, http.StatusOK, request("Bearer old-token").Code)
+	tokens.Revoke("old-token")
+	assert.Equal(t, http.StatusUnauthorized, request("Bearer old-token").Code)
+
+	// Replace all tokens
+	tokens.Replace(map[string]string{"deploy-token": "deploy"})
+	assert.Equal(t, http.StatusUnauthorized, request("Bearer new-token").Code)
+	assert.Equal(t, "deploy/bearer", request("Bearer deploy-token").Body.String())
+}
+
+func TestTokens_ZeroValue(t *testing.T) {
+	// The zero value is an empty store accepting tokens
+	tokens := &Tokens{}
+	_, ok := tokens.Lookup("token")
+	assert.False(t, ok)
+	tokens.Revoke("token")
+	tokens.Add("token", "ci")
+	name, ok := tokens.Lookup("token")
+	assert.True(t, ok)
+	assert.Equal(t, "ci", name)
+}
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secrets := StaticSecrets{"svc-a": []byte("key-a")}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(p.Name + ":" + string(body)))
+	})
+	handler := Chain(echo, HMACAuth(secrets, WithClockSkew(time.Minute), func(o *hmacOptions) {
+		o.now = func() time.Time { return now }
+	}))
+	signed := func(method, target, body, keyID string, secret []byte, at time.Time) *http.Request {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		assert.NoError(t, SignRequest(r, keyID, secret, at))
+		return r
+	}
+	serveRequest := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// A signed request is accepted and the body is still readable
+	w := serveRequest(signed(http.MethodPost, "/orders?id=1", `{"n":1}`, "svc-a", []byte("key-a"), now.Add(-30*time.Second)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `svc-a:{"n":1}`, w.Body.String())
+
+	// Tampering with the body, the URI or the method breaks the signature
+	r := signed(http.MethodPost, "/orders?id=1", `{"n":1}`, "svc-a", []byte("key-a"), now)
+	r.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"n":2}`)).Body
+	assertErrorBody(t, serveRequest(r), http.StatusUnauthorized, "invalid signature")
+	r = signed(http.MethodPost, "/orders?id=1", "", "svc-a", []byte("key-a"), now)
+	r.URL.RawQuery = "id=2"
+	assertErrorBody(t, serveRequest(r), http.StatusUnauthorized, "invalid signature")
+	r = signed(http.MethodPost, "/orders", "", "svc-a", []byte("key-a"), now)
+	r.Method = http.MethodDelete
+	assertErrorBody(t, serveRequest(r), http.StatusUnauthorized, "invalid signature")
+
+	// Unknown keys and wrong secrets are rejected the same way, even when signed with the placeholder secret
+	assertErrorBody(t, serveRequest(signed(http.MethodGet, "/", "", "svc-b", []byte("key-a"), now)), http.StatusUnauthorized, "invalid signature")
+	assertErrorBody(t, serveRequest(signed(http.MethodGet, "/", "", "svc-b", placeholderSecret, now)), http.StatusUnauthorized, "invalid signature")
+	assertErrorBody(t, serveRequest(signed(http.MethodGet, "/", "", "svc-a", []byte("wrong"), now)), http.StatusUnauthorized, "invalid signature")
+
+	// Timestamps beyond the skew are rejected in both directions
+	assertErrorBody(t, serveRequest(signed(http.MethodGet, "/", "", "svc-a", []byte("key-a"), now.Add(-2*time.Minute))), http.StatusUnauthorized, "request timestamp is out of range")
+	assertErrorBody(t, serveRequest(signed(http.MethodGet, "/", "", "svc-a", []byte("key-a"), now.Add(2*time.Minute))), http.StatusUnauthorized, "request timestamp is out of range")
+
+	// Requests without the headers are rejected
+	assertErrorBody(t, serveRequest(httptest.NewRequest(http.MethodGet, "/", nil)), http.StatusUnauthorized, "unauthorized")
+}
+
+func TestHMACAuth_BodyLimit(t *testing.T) {
+	handler := Chain(textHandler("ok"), BodyLimit(4), HMACAuth(StaticSecrets{"svc": []byte("key")}))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too large"))
+	assert.NoError(t, SignRequest(r, "svc", []byte("key"), time.Now()))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestAuth_Invalid(t *testing.T) {
+	assert.Panics(t, func() { BasicAuth("api", nil) })
+	assert.Panics(t, func() { BearerAuth(nil) })
+	assert.Panics(t, func() { HMACAuth(nil) })
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultMinCompressSize 是默认的压缩响应体的最小字节数
+	// defaultMinCompressSize is the default minimum number of bytes of the response body to compress
+	defaultMinCompressSize = 1024
+
+	// encodingGzip 是 gzip 内容编码
+	// encodingGzip is the gzip content coding
+	encodingGzip = "gzip"
+
+	// encodingDeflate 是 deflate 内容编码
+	// encodingDeflate is the deflate content coding
+	encodingDeflate = "deflate"
+)
+
+// defaultCompressibleTypes 是默认压缩的内容类型，以 / 结尾的项匹配该类型下的所有子类型
+// defaultCompressibleTypes are the content types compressed by default, items ending with / match all subtypes of the type
+var defaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// CompressOption 是压缩中间件的配置选项
+// CompressOption is a configuration option of the compression middleware
+type CompressOption func(*compressOptions)
+
+// compressOptions 是压缩中间件的配置
+// compressOptions is the configuration of the compression middleware
+type compressOptions struct {
+	// level 是压缩级别
+	// level is the compression level
+	level int
+
+	// minSize 是压缩响应体的最小字节数
+	// minSize is the minimum number of bytes of the response body to compress
+	minSize int
+
+	// types 是压缩的内容类型
+	// types are the compressed content types
+	types []string
+}
+
+// WithCompressionLevel 设置压缩级别，取值范围与 compress/flate 相同，默认是 flate.DefaultCompression，无效的级别会被忽略
+// WithCompressionLevel sets the compression level, the range is the same as compress/flate, the default is flate.DefaultCompression, invalid levels are ignored
+func WithCompressionLevel(level int) CompressOption {
+	return func(o *compressOptions) {
+		if level >= flate.HuffmanOnly && level <= flate.BestCompression {
+			o.level = level
+		}
+	}
+}
+
+// WithMinSize 设置压缩响应体的最小字节数，更小的响应不压缩，默认是 1024
+// WithMinSize sets the minimum number of bytes of the response body to compress, smaller responses are not compressed, the default is 1024
+func WithMinSize(size int) CompressOption {
+	return func(o *compressOptions) {
+		if size >= 0 {
+			o.minSize = size
+		}
+	}
+}
+
+// WithCompressibleTypes 设置压缩的内容类型，以 / 结尾的项匹配该类型下的所有子类型，例如 "text/"。默认是文本、JSON、JavaScript、XML 和 SVG
+// WithCompressibleTypes sets the compressed content types, items ending with / match all subtypes of the type, such as "text/". The defaults are text, JSON, JavaScript, XML and SVG
+func WithCompressibleTypes(types ...string) CompressOption {
+	return func(o *compressOptions) {
+		o.types = nil
+		for _, t := range types {
+			o.types = append(o.types, strings.ToLower(t))
+		}
+	}
+}
+
+// Compress 返回一个按照 Accept-Encoding 使用 gzip 或 deflate 压缩响应的中间件。只有内容类型在允许列表中且响应体达到最小字节数时才压缩，
+// 已经设置了 Content-Encoding 的响应、Range 请求、HEAD 请求以及 204、206 和 304 响应不压缩。
+// 响应总是带有 Vary: Accept-Encoding。处理器调用 Flush 时立即开始压缩并刷新已经压缩的数据，适用于流式响应
+// Compress returns a middleware compressing responses with gzip or deflate according to Accept-Encoding. Responses are only compressed when the content type is in the allowlist and the body reaches the minimum size,
+// responses with Content-Encoding already set, Range requests, HEAD requests, and 204, 206 and 304 responses are not compressed.
+// Responses always carry Vary: Accept-Encoding. When the handler calls Flush, compression starts immediately and the compressed data is flushed, which suits streaming responses
+func Compress(opts ...CompressOption) Middleware {
+	o := &compressOptions{level: flate.DefaultCompression, minSize: defaultMinCompressSize, types: defaultCompressibleTypes}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// 复用压缩器，创建压缩器的开销比压缩小响应还大
+	// Reuse the compressors, creating a compressor costs more than compressing a small response
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(io.Discard, o.level)
+			return w
+		}},
+		encodingDeflate: {New: func() interface{} {
+			w, _ := flate.NewWriter(io.Discard, o.level)
+			return w
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 处理器 panic 时不写出缓冲的响应，留给 Recovery 返回 500
+			// The buffered response is not written when the handler panics, leaving Recovery to answer 500
+			cw := &compressWriter{ResponseWriter: w, options: o, encoding: encoding, pool: pools[encoding]}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding 根据 Accept-Encoding 选择 gzip 或 deflate，q 值相同时优先 gzip，都不接受时返回空字符串
+// negotiateEncoding chooses gzip or deflate according to Accept-Encoding, gzip is preferred when the q values are equal, an empty string is returned if neither is accepted
+func negotiateEncoding(accept string) string {
+	qualities := parseAcceptEncoding(accept)
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingGzip, encodingDeflate} {
+		if q := encodingQuality(qualities, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding 解析 Accept-Encoding，返回编码名称到 q 值的映射
+// parseAcceptEncoding parses Accept-Encoding, returning the map from coding names to q values
+func parseAcceptEncoding(accept string) map[string]float64 {
+	qualities := map[string]float64{}
+	for _, item := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		qualities[name] = q
+	}
+	return qualities
+}
+
+// encodingQuality 返回编码的 q 值，没有单独列出的编码使用 * 的 q 值，都没有时返回 0
+// encodingQuality returns the q value of the coding, codings not listed individually use the q value of *, 0 is returned if neither is present
+func encodingQuality(qualities map[string]float64, encoding string) float64 {
+	if q, ok := qualities[encoding]; ok {
+		return q
+	}
+	return qualities["*"]
+}
+
+// compressWriter 缓冲响应体的开头部分，达到最小字节数或者刷新时决定是否压缩
+// compressWriter buffers the beginning of the response body, deciding whether to compress when the minimum size is reached or on flush
+type compressWriter struct {
+	http.ResponseWriter
+
+	// options 是压缩中间件的配置
+	// options is the configuration of the compression middleware
+	options *compressOptions
+
+	// encoding 是协商的内容编码
+	// encoding is the negotiated content coding
+	encoding string
+
+	// pool 是内容编码的压缩器池
+	// pool is the compressor pool of the content coding
+	pool *sync.Pool
+
+	// status 是处理器写入的状态码，0 表示还没有写入
+	// status is the status code written by the handler, 0 means not written yet
+	status int
+
+	// buf 是决定是否压缩之前缓冲的响应体
+	// buf is the response body buffered before deciding whether to compress
+	buf []byte
+
+	// decided 表示是否已经决定是否压缩并写入了响应头
+	// decided indicates whether it has been decided whether to compress and the header has been written
+	decided bool
+
+	// compressor 是使用的压缩器，nil 表示不压缩
+	// compressor is the compressor in use, nil means the response is not compressed
+	compressor resettableWriter
+
+	// hijacked 表示连接是否已经被接管
+	// hijacked indicates whether the connection has been hijacked
+	hijacked bool
+}
+
+// resettableWriter 是 gzip.Writer 和 flate.Writer 共同的方法
+// resettableWriter is the methods shared by gzip.Writer and flate.Writer
+type resettableWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// WriteHeader 记录状态码，响应头在决定是否压缩之后才写入，1xx 的状态码直接写入
+// WriteHeader records the status code, the header is only written after deciding whether to compress, 1xx status codes are written directly
+func (c *compressWriter) WriteHeader(status int) {
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+// Write 写入响应体，决定之前先缓冲到最小字节数
+// Write writes the response body, buffering up to the minimum size before deciding
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if len(c.buf) < c.options.minSize {
+			return len(b), nil
+		}
+		if err := c.decide(false); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.compressor != nil {
+		return c.compressor.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// decide 决定是否压缩，写入响应头和缓冲的响应体。streaming 表示处理器主动刷新，此时不检查最小字节数
+// decide decides whether to compress, writing the header and the buffered body. streaming indicates the handler flushes actively, the minimum size is not checked then
+func (c *compressWriter) decide(streaming bool) error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	header := c.Header()
+	if header.Get("Content-Type") == "" && len(c.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+
+	// 满足条件时开始压缩，压缩后的长度未知，强 ETag 不再适用
+	// Start compressing when the conditions are met, the compressed length is unknown and a strong ETag no longer applies
+	if c.compressible(streaming) {
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		header.Set("Content-Encoding", c.encoding)
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		c.compressor = c.pool.Get().(resettableWriter)
+		c.compressor.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.compressor != nil {
+		_, err = c.compressor.Write(buf)
+	} else {
+		_, err = c.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// compressible 检查响应是否应该压缩
+// compressible checks whether the response should be compressed
+func (c *compressWriter) compressible(streaming bool) bool {
+	switch c.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if !streaming && len(c.buf) < c.options.minSize {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range c.options.types {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush 立即决定是否压缩，并刷新压缩器和底层的 ResponseWriter
+// Flush decides whether to compress immediately, and flushes the compressor and the underlying ResponseWriter
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		_ = c.decide(true)
+	}
+	if c.compressor != nil {
+		_ = c.compressor.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 接管底层的连接，之后不再写入任何数据
+// Hijack takes over the underlying connection, nothing is written afterwards
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := c.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := h.Hijack()
+		if err == nil {
+			c.hijacked = true
+		}
+		return conn, rw, err
+	}
+	return nil, nil, fmt.Errorf("server: %T does not support hijacking", c.ResponseWriter)
+}
+
+// Unwrap 返回底层的 ResponseWriter，供 http.ResponseController 使用
+// Unwrap returns the underlying ResponseWriter, used by http.ResponseController
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// close 在处理器返回后写出剩余的数据并把压缩器放回池中
+// close writes the remaining data after the handler returns and puts the compressor back into the pool
+func (c *compressWriter) close() {
+	if c.hijacked {
+		return
+	}
+	if !c.decided {
+		if c.status == 0 && len(c.buf) == 0 {
+			return
+		}
+		_ = c.decide(false)
+	}
+	if c.compressor != nil {
+		_ = c.compressor.Close()
+		c.compressor.Reset(io.Discard)
+		c.pool.Put(c.compressor)
+		c.compressor = nil
+	}
+}
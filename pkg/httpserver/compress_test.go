@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// contentHandler writes the body with the content type and the extra headers
+func contentHandler(contentType, body string, headers map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		_, _ = io.WriteString(w, body)
+	})
+}
+
+// gunzip decompresses the gzip body
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+	zr, err := gzip.NewReader(body)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	data, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"deflate":                   "deflate",
+		"gzip, deflate, br":         "gzip",
+		"deflate, gzip;q=0.5":       "deflate",
+		"GZIP;Q=0.8, deflate;q=0.9": "deflate",
+		"gzip;q=0":                  "",
+		"*":                         "gzip",
+		"*;q=0.5, gzip;q=0":         "deflate",
+		"br, identity":              "",
+	}
+	for accept, expected := range tests {
+		assert.Equal(t, expected, negotiateEncoding(accept), accept)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat(`{"name":"tiny http server"}`, 100)
+	handler := Chain(contentHandler("application/json", body, map[string]string{"Content-Length": fmt.Sprint(len(body)), "ETag": `"v1"`}), Compress())
+
+	// Large JSON responses are compressed with gzip
+	w := serve(handler, http.MethodGet, "/", "Accept-Encoding", "gzip, deflate")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Less(t, w.Body.Len(), len(body))
+	assert.Equal(t, body, gunzip(t, w.Body))
+
+	// Deflate is used when preferred
+	w = serve(handler, http.MethodGet, "/", "Accept-Encoding", "deflate")
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	data, err := io.ReadAll(flate.NewReader(w.Body))
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+
+	// Clients without compression support and HEAD requests receive the original body
+	for _, w := range []*httptest.ResponseRecorder{serve(handler, http.MethodGet, "/"), serve(handler, http.MethodHead, "/", "Accept-Encoding", "gzip")} {
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Equal(t, fmt.Sprint(len(body)), w.Header().Get("Content-Length"))
+	}
+}
+
+func TestCompress_Skipped(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+	tests := map[string]http.Handler{
+		"small body":    contentHandler("application/json", `{"ok":true}`, nil),
+		"image":         contentHandler("image/png", large, nil),
+		"encoded":       contentHandler("text/plain", large, map[string]string{"Content-Encoding": "br"}),
+		"sniffed image": contentHandler("", "\x89PNG\r\n\x1a\n"+large, nil),
+		"no content": http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	for name, h := range tests {
+		w := serve(Chain(h, Compress()), http.MethodGet, "/", "Accept-Encoding", "gzip")
+		assert.NotEqual(t, "gzip", w.Header().Get("Content-Encoding"), name)
+	}
+
+	// The body and the status are preserved when not compressing
+	w := serve(Chain(contentHandler("application/json", `{"ok":true}`, nil), Compress()), http.MethodGet, "/", "Accept-Encoding", "gzip")
+	assert.Equal(t, `{"ok":true}`, w.Body.String())
+	w = serve(Chain(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}), Compress()), http.MethodGet, "/", "Accept-Encoding", "gzip")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Sniffed text is compressed and custom types can be allowed
+	w = serve(Chain(contentHandler("", large, nil), Compress()), http.MethodGet, "/", "Accept-Encoding", "gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	w = serve(Chain(contentHandler("application/wasm", large, nil), Compress(WithCompressibleTypes("application/wasm"), WithMinSize(10))), http.MethodGet, "/", "Accept-Encoding", "gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	// Range requests are passed through
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=0-9")
+	rec := httptest.NewRecorder()
+	Chain(contentHandler("text/plain", large, nil), Compress()).ServeHTTP(rec, r)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+}
+
+func TestCompress_Streaming(t *testing.T) {
+	// Stream events with a flush after each one
+	release := make(chan struct{})
+	srv := httptest.NewServer(Chain(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			if i == 0 {
+				<-release
+			}
+		}
+	}), Compress()))
+	defer srv.Close()
+
+	// The first event arrives compressed before the handler finishes
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	zr, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err)
+	lines := bufio.NewReader(zr)
+	line, err := lines.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: 0\n", line)
+
+	// The rest arrives after the handler continues
+	close(release)
+	rest, err := io.ReadAll(lines)
+	assert.NoError(t, err)
+	assert.Equal(t, "\ndata: 1\n\ndata: 2\n\n", string(rest))
+}
+
+func TestCompress_Panic(t *testing.T) {
+	// The buffered body is dropped so Recovery answers 500
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	}), Recovery(&recordLogger{}), Compress())
+	w := serve(handler, http.MethodGet, "/", "Accept-Encoding", "gzip")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
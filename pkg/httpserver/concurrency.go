@@ -0,0 +1,244 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RejectConcurrency 是因为并发数达到上限且等待队列已满而拒绝请求的原因
+	// RejectConcurrency is the reason of rejecting requests because the concurrency reaches the limit and the wait queue is full
+	RejectConcurrency = "concurrency"
+
+	// RejectQueueTimeout 是因为在等待队列中超时而拒绝请求的原因
+	// RejectQueueTimeout is the reason of rejecting requests because they time out in the wait queue
+	RejectQueueTimeout = "queue_timeout"
+
+	// RejectShed 是因为自适应降载降低了并发上限而拒绝请求的原因
+	// RejectShed is the reason of rejecting requests because the adaptive shedding lowered the concurrency limit
+	RejectShed = "shed"
+
+	// RejectRateLimit 是因为超过限流配额而拒绝请求的原因
+	// RejectRateLimit is the reason of rejecting requests because they exceed the rate limit quota
+	RejectRateLimit = "rate_limit"
+
+	// defaultShedRetryAfter 是默认的拒绝请求时建议客户端重试的时间（秒）
+	// defaultShedRetryAfter is the default time suggested to clients for retrying when rejecting requests in seconds
+	defaultShedRetryAfter = 1
+
+	// latencySmoothing 是请求耗时指数移动平均的平滑系数
+	// latencySmoothing is the smoothing factor of the exponential moving average of the request latency
+	latencySmoothing = 0.2
+
+	// shedDecrease 是耗时超过目标时并发上限乘以的系数
+	// shedDecrease is the factor the concurrency limit is multiplied by when the latency exceeds the target
+	shedDecrease = 0.9
+)
+
+// ConcurrencyOption 是并发限制中间件的配置选项
+// ConcurrencyOption is a configuration option of the concurrency limit middleware
+type ConcurrencyOption func(*concurrencyLimiter)
+
+// WithWaitQueue 设置等待队列，并发数达到上限时最多 size 个请求排队等待空闲的名额，每个请求最多等待 timeout，默认没有等待队列
+// WithWaitQueue sets the wait queue, at most size requests queue up for a free slot when the concurrency reaches the limit, each request waits at most timeout, there is no wait queue by default
+func WithWaitQueue(size int, timeout time.Duration) ConcurrencyOption {
+	return func(l *concurrencyLimiter) {
+		if size > 0 && timeout > 0 {
+			l.queueSize, l.queueTimeout = size, timeout
+		}
+	}
+}
+
+// WithAdaptiveShedding 开启自适应降载：请求耗时的移动平均超过 target 时逐步降低并发上限，低于 target 时逐步恢复到配置的上限
+// WithAdaptiveShedding enables the adaptive shedding: the concurrency limit is lowered gradually when the moving average of the request latency exceeds target, and restored gradually to the configured limit when it is below target
+func WithAdaptiveShedding(target time.Duration) ConcurrencyOption {
+	return func(l *concurrencyLimiter) {
+		if target > 0 {
+			l.target = target
+		}
+	}
+}
+
+// WithShedRetryAfter 设置拒绝请求时 Retry-After 响应头建议的重试时间，默认是 1 秒
+// WithShedRetryAfter sets the retry time suggested by the Retry-After header when rejecting requests, the default is 1 second
+func WithShedRetryAfter(retryAfter time.Duration) ConcurrencyOption {
+	return func(l *concurrencyLimiter) {
+		if retryAfter > 0 {
+			l.retryAfter = retryAfter
+		}
+	}
+}
+
+// concurrencyLimiter 限制同时处理的请求数
+// concurrencyLimiter limits the number of requests handled at the same time
+type concurrencyLimiter struct {
+	// mu 保护下面的状态
+	// mu protects the state below
+	mu sync.Mutex
+
+	// max 是配置的并发上限
+	// max is the configured concurrency limit
+	max int
+
+	// limit 是当前的并发上限，开启自适应降载时在 1 和 max 之间变化
+	// limit is the current concurrency limit, it varies between 1 and max when the adaptive shedding is enabled
+	limit float64
+
+	// inFlight 是正在处理的请求数
+	// inFlight is the number of requests being handled
+	inFlight int
+
+	// waiters 是等待队列，按照到达的顺序排列，名额空闲时关闭通道
+	// waiters is the wait queue in the order of arrival, the channel is closed when a slot is free
+	waiters []chan struct{}
+
+	// queueSize 是等待队列的长度，0 表示没有等待队列
+	// queueSize is the length of the wait queue, 0 means there is no wait queue
+	queueSize int
+
+	// queueTimeout 是请求在等待队列中的最长时间
+	// queueTimeout is the longest time a request stays in the wait queue
+	queueTimeout time.Duration
+
+	// target 是自适应降载的目标耗时，0 表示不开启
+	// target is the target latency of the adaptive shedding, 0 means it is disabled
+	target time.Duration
+
+	// latency 是请求耗时的指数移动平均
+	// latency is the exponential moving average of the request latency
+	latency time.Duration
+
+	// retryAfter 是拒绝请求时建议的重试时间
+	// retryAfter is the retry time suggested when rejecting requests
+	retryAfter time.Duration
+}
+
+// ConcurrencyLimit 返回一个限制同时处理的请求数的中间件，超过上限的请求进入等待队列或者被拒绝。
+// 被拒绝的请求收到 503、Retry-After 响应头和 httptool.BaseHttpResponse 格式的 JSON 响应体，开启指标时计入 http_requests_rejected_total。
+// max 不是正数时会 panic
+// ConcurrencyLimit returns a middleware limiting the number of requests handled at the same time, the requests beyond the limit enter the wait queue or are rejected.
+// Rejected requests receive 503, the Retry-After header and a JSON body in the format of httptool.BaseHttpResponse, they are counted in http_requests_rejected_total when the metrics are enabled.
+// It panics if max is not positive
+func ConcurrencyLimit(max int, opts ...ConcurrencyOption) Middleware {
+	if max <= 0 {
+		panic("server: invalid concurrency limit " + strconv.Itoa(max))
+	}
+	l := newConcurrencyLimiter(max, opts...)
+	retryAfter := strconv.FormatInt(ceilSeconds(l.retryAfter), 10)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 获取名额，失败时拒绝请求
+			// Acquire a slot, reject the request on failure
+			if reason := l.acquire(r); reason != "" {
+				markRejected(r, reason)
+				w.Header().Set("Retry-After", retryAfter)
+				writeError(w, http.StatusServiceUnavailable, "server is overloaded")
+				return
+			}
+
+			// 处理请求并记录耗时，panic 时也要释放名额
+			// Handle the request and record the latency, the slot must be released even on panic
+			start := time.Now()
+			defer func() { l.release(time.Since(start)) }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newConcurrencyLimiter 创建一个新的并发限制器
+// newConcurrencyLimiter creates a new concurrency limiter
+func newConcurrencyLimiter(max int, opts ...ConcurrencyOption) *concurrencyLimiter {
+	l := &concurrencyLimiter{max: max, limit: float64(max), retryAfter: time.Second * defaultShedRetryAfter}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// acquire 获取一个名额，必要时在等待队列中等待，成功时返回空字符串，失败时返回拒绝的原因
+// acquire acquires a slot, waiting in the wait queue if necessary, an empty string is returned on success, the reason of the rejection is returned on failure
+func (l *concurrencyLimiter) acquire(r *http.Request) string {
+	l.mu.Lock()
+
+	// 有空闲的名额且没有更早的请求在等待时直接获取
+	// Acquire directly when a slot is free and no earlier request is waiting
+	if l.inFlight < int(l.limit) && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return ""
+	}
+
+	// 等待队列已满时拒绝，自适应降载降低了上限时原因是降载
+	// Reject when the wait queue is full, the reason is shedding when the adaptive shedding lowered the limit
+	if len(l.waiters) >= l.queueSize {
+		reason := RejectConcurrency
+		if l.inFlight < l.max {
+			reason = RejectShed
+		}
+		l.mu.Unlock()
+		return reason
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	// 等待名额、超时或者客户端断开
+	// Wait for a slot, the timeout or the client disconnecting
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return ""
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+
+	// 离开等待队列，如果名额恰好已经分配给了当前请求，把它释放给下一个请求
+	// Leave the wait queue, if a slot has just been granted to the current request, release it to the next request
+	l.mu.Lock()
+	for i, waiter := range l.waiters {
+		if waiter == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			l.mu.Unlock()
+			return RejectQueueTimeout
+		}
+	}
+	l.mu.Unlock()
+	l.release(0)
+	return RejectQueueTimeout
+}
+
+// release 释放一个名额并把它分配给等待队列中最早的请求，latency 是请求的耗时，0 表示不记录
+// release releases a slot and grants it to the earliest request in the wait queue, latency is the latency of the request, 0 means it is not recorded
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 根据耗时的移动平均调整并发上限：超过目标时按比例降低，否则每处理一轮请求增加一个名额
+	// Adjust the concurrency limit by the moving average of the latency: lower it proportionally when exceeding the target, otherwise add one slot per round of requests
+	if l.target > 0 && latency > 0 {
+		if l.latency == 0 {
+			l.latency = latency
+		} else {
+			l.latency += time.Duration(latencySmoothing * float64(latency-l.latency))
+		}
+		if l.latency > l.target {
+			l.limit = math.Max(1, l.limit*shedDecrease)
+		} else {
+			l.limit = math.Min(float64(l.max), l.limit+1/l.limit)
+		}
+	}
+
+	// 把空闲的名额按照到达的顺序分配给等待的请求
+	// Grant the free slots to the waiting requests in the order of arrival
+	l.inFlight--
+	for l.inFlight < int(l.limit) && len(l.waiters) > 0 {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+	}
+}
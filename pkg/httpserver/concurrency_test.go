@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingHandler returns a handler blocking until release is closed, entered receives a value when a request enters it
+func blockingHandler(entered chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte("done"))
+	})
+}
+
+// serveAsync serves a request in a new goroutine and returns the channel of the recorder
+func serveAsync(h http.Handler) <-chan *httptest.ResponseRecorder {
+	result := make(chan *httptest.ResponseRecorder, 1)
+	go func() { result <- serve(h, http.MethodGet, "/") }()
+	return result
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	// One request at a time without a wait queue
+	entered, release := make(chan struct{}, 2), make(chan struct{})
+	handler := Chain(blockingHandler(entered, release), ConcurrencyLimit(1, WithShedRetryAfter(3*time.Second)))
+	first := serveAsync(handler)
+	<-entered
+
+	// The second request is rejected while the first is in flight
+	w := serve(handler, http.MethodGet, "/")
+	assertErrorBody(t, w, http.StatusServiceUnavailable, "server is overloaded")
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+
+	// The slot is released after the first request completes
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/").Code)
+}
+
+func TestConcurrencyLimit_WaitQueue(t *testing.T) {
+	// One request at a time with one place in the wait queue
+	entered, release := make(chan struct{}, 3), make(chan struct{})
+	handler := Chain(blockingHandler(entered, release), ConcurrencyLimit(1, WithWaitQueue(1, 5*time.Second)))
+	first := serveAsync(handler)
+	<-entered
+
+	// The second request waits in the queue and the third is rejected
+	second := serveAsync(handler)
+	assert.Eventually(t, func() bool {
+		return serve(handler, http.MethodGet, "/").Code == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+
+	// The queued request is served after the first completes
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, http.StatusOK, (<-second).Code)
+}
+
+func TestConcurrencyLimit_QueueTimeout(t *testing.T) {
+	// The queued request gives up after the timeout
+	l := newConcurrencyLimiter(1, WithWaitQueue(1, 20*time.Millisecond))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "", l.acquire(r))
+	assert.Equal(t, RejectQueueTimeout, l.acquire(r))
+	assert.Empty(t, l.waiters)
+
+	// The slot is still usable after the queued request left
+	l.release(0)
+	assert.Equal(t, "", l.acquire(r))
+}
+
+func TestConcurrencyLimit_AdaptiveShedding(t *testing.T) {
+	// Four slots with a latency target of 100ms
+	l := newConcurrencyLimiter(4, WithAdaptiveShedding(100*time.Millisecond))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// Slow requests lower the limit down to one
+	for i := 0; i < 30; i++ {
+		assert.Equal(t, "", l.acquire(r))
+		l.release(time.Second)
+	}
+	assert.Equal(t, 1.0, l.limit)
+
+	// Requests beyond the lowered limit are shed
+	assert.Equal(t, "", l.acquire(r))
+	assert.Equal(t, RejectShed, l.acquire(r))
+	l.release(time.Second)
+
+	// Fast requests restore the limit gradually
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "", l.acquire(r))
+		l.release(time.Millisecond)
+	}
+	assert.Equal(t, 4.0, l.limit)
+}
+
+func TestConcurrencyLimit_Metrics(t *testing.T) {
+	// Limit the whole server to one request at a time
+	srv, err := NewWithOptions(WithMetrics(""))
+	assert.NoError(t, err)
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	srv.HandleMethod(http.MethodGet, "/slow", blockingHandler(entered, release))
+	srv.Use(ConcurrencyLimit(1))
+
+	// Reject a request while another is in flight
+	first := make(chan *httptest.ResponseRecorder, 1)
+	go func() { first <- serve(srv, http.MethodGet, "/slow") }()
+	<-entered
+	assert.Equal(t, http.StatusServiceUnavailable, serve(srv, http.MethodGet, "/slow").Code)
+	close(release)
+	<-first
+
+	// The rejection is counted by reason
+	body := serve(srv, http.MethodGet, DefaultMetricsPath).Body.String()
+	assert.Contains(t, body, fmt.Sprintf("http_requests_rejected_total{reason=%q} 1\n", RejectConcurrency))
+}
+
+func TestConcurrencyLimit_Invalid(t *testing.T) {
+	assert.Panics(t, func() { ConcurrencyLimit(0) })
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// defaultCORSMethods 是默认允许的跨域请求方法
+	// defaultCORSMethods are the cross-origin request methods allowed by default
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+	// defaultCORSHeaders 是默认允许的跨域请求头
+	// defaultCORSHeaders are the cross-origin request headers allowed by default
+	defaultCORSHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+)
+
+// CORSOption 是跨域中间件的配置选项
+// CORSOption is a configuration option of the CORS middleware
+type CORSOption func(*corsPolicy)
+
+// corsPolicy 是跨域资源共享的策略
+// corsPolicy is the policy of cross-origin resource sharing
+type corsPolicy struct {
+	// anyOrigin 表示是否允许所有的源
+	// anyOrigin indicates whether all origins are allowed
+	anyOrigin bool
+
+	// origins 是精确匹配的源，已经转换为小写
+	// origins are the origins matched exactly, converted to lower case
+	origins map[string]bool
+
+	// wildcards 是通配子域名的源，每一项是 scheme 和以 "." 开头的父域名
+	// wildcards are the origins with wildcard subdomains, each item is the scheme and the parent domain starting with "."
+	wildcards [][2]string
+
+	// patterns 是用正则表达式匹配的源
+	// patterns are the origins matched by regular expressions
+	patterns []*regexp.Regexp
+
+	// methods 是允许的请求方法
+	// methods are the allowed request methods
+	methods []string
+
+	// anyHeader 表示是否允许所有的请求头
+	// anyHeader indicates whether all request headers are allowed
+	anyHeader bool
+
+	// headers 是允许的请求头，已经转换为小写
+	// headers are the allowed request headers, converted to lower case
+	headers map[string]bool
+
+	// credentials 表示是否允许携带凭据，例如 Cookie
+	// credentials indicates whether credentials such as cookies are allowed
+	credentials bool
+
+	// exposed 是允许浏览器读取的响应头
+	// exposed are the response headers browsers are allowed to read
+	exposed []string
+
+	// maxAge 是预检结果的缓存时间，0 表示不设置
+	// maxAge is the cache time of the preflight result, 0 means it is not set
+	maxAge time.Duration
+}
+
+// WithAllowedOrigins 设置允许的源，可以是精确的源，例如 "https://app.example.com"，通配子域名，例如 "https://*.example.com"，
+// 或者 "*" 表示所有的源。默认允许所有的源。通配符只能作为开头的 "*." 子域名标签，出现在其他位置时 panic
+// WithAllowedOrigins sets the allowed origins, an origin can be an exact one, such as "https://app.example.com", a wildcard subdomain, such as "https://*.example.com",
+// or "*" for all origins. All origins are allowed by default. The wildcard can only be a leading "*." subdomain label, it panics when it appears anywhere else
+func WithAllowedOrigins(origins ...string) CORSOption {
+	return func(p *corsPolicy) {
+		p.anyOrigin = false
+		for _, origin := range origins {
+			origin = strings.ToLower(origin)
+			switch {
+			case origin == "*":
+				p.anyOrigin = true
+			case strings.Contains(origin, "*"):
+				// 通配符只能是 scheme 之后开头的 "*." 子域名标签
+				// The wildcard can only be a leading "*." subdomain label after the scheme
+				scheme, host, ok := strings.Cut(origin, "://")
+				if !ok || !strings.HasPrefix(host, "*.") || len(host) == 2 || strings.Contains(host[1:], "*") {
+					panic("server: invalid CORS origin pattern " + strconv.Quote(origin))
+				}
+				p.wildcards = append(p.wildcards, [2]string{scheme + "://", host[1:]})
+			default:
+				p.origins[origin] = true
+			}
+		}
+	}
+}
+
+// WithAllowedOriginPatterns 设置用正则表达式匹配的允许的源，正则表达式应该使用 ^ 和 $ 匹配整个源
+// WithAllowedOriginPatterns sets the allowed origins matched by regular expressions, the expressions should use ^ and $ to match the whole origin
+func WithAllowedOriginPatterns(patterns ...*regexp.Regexp) CORSOption {
+	return func(p *corsPolicy) {
+		p.anyOrigin = false
+		p.patterns = append(p.patterns, patterns...)
+	}
+}
+
+// WithAllowedMethods 设置允许的跨域请求方法，默认是 GET、HEAD 和 POST
+// WithAllowedMethods sets the allowed cross-origin request methods, the defaults are GET, HEAD and POST
+func WithAllowedMethods(methods ...string) CORSOption {
+	return func(p *corsPolicy) {
+		p.methods = nil
+		for _, method := range methods {
+			p.methods = append(p.methods, strings.ToUpper(method))
+		}
+	}
+}
+
+// WithAllowedHeaders 设置允许的跨域请求头，"*" 表示允许所有的请求头。默认是 Accept、Accept-Language、Content-Language 和 Content-Type
+// WithAllowedHeaders sets the allowed cross-origin request headers, "*" means all request headers are allowed. The defaults are Accept, Accept-Language, Content-Language and Content-Type
+func WithAllowedHeaders(headers ...string) CORSOption {
+	return func(p *corsPolicy) {
+		p.anyHeader, p.headers = false, map[string]bool{}
+		for _, header := range headers {
+			if header == "*" {
+				p.anyHeader = true
+				continue
+			}
+			p.headers[strings.ToLower(header)] = true
+		}
+	}
+}
+
+// WithAllowCredentials 允许跨域请求携带凭据，例如 Cookie 和 Authorization 请求头，此时响应回显具体的源而不是 "*"。
+// 允许的源必须通过 WithAllowedOrigins 或 WithAllowedOriginPatterns 明确设置，并且不能包含 "*"
+// WithAllowCredentials allows cross-origin requests to carry credentials, such as cookies and the Authorization header, the response then echoes the concrete origin instead of "*".
+// The allowed origins must be set explicitly with WithAllowedOrigins or WithAllowedOriginPatterns and cannot include "*"
+func WithAllowCredentials() CORSOption {
+	return func(p *corsPolicy) {
+		p.credentials = true
+	}
+}
+
+// WithExposedHeaders 设置允许浏览器中的脚本读取的响应头，例如 X-Request-ID
+// WithExposedHeaders sets the response headers scripts in browsers are allowed to read, such as X-Request-ID
+func WithExposedHeaders(headers ...string) CORSOption {
+	return func(p *corsPolicy) {
+		p.exposed = append(p.exposed, headers...)
+	}
+}
+
+// WithMaxAge 设置浏览器缓存预检结果的时间，默认不设置，由浏览器决定
+// WithMaxAge sets the time browsers cache the preflight result, it is not set by default and left to browsers
+func WithMaxAge(maxAge time.Duration) CORSOption {
+	return func(p *corsPolicy) {
+		p.maxAge = maxAge
+	}
+}
+
+// CORS 返回一个实现跨域资源共享的中间件。预检请求（带有 Access-Control-Request-Method 的 OPTIONS 请求）直接返回 204，不会传递给路由；
+// 其他跨域请求在源被允许时带上跨域响应头后继续处理。源不被允许时不写入跨域响应头，由浏览器拒绝。
+// 预检请求可能发往没有注册 OPTIONS 的路由，所以应该通过 TinyHttpServer.Use 使用它。允许凭据时允许所有的源会 panic，因为任何网站都可以借此读取用户的数据
+// CORS returns a middleware implementing cross-origin resource sharing. Preflight requests (OPTIONS requests with Access-Control-Request-Method) are answered with 204 directly without reaching the routes;
+// other cross-origin requests continue with the CORS headers when the origin is allowed. No CORS headers are written when the origin is not allowed, leaving the rejection to browsers.
+// Preflight requests may target routes without OPTIONS registered, so it should be used with TinyHttpServer.Use. It panics if credentials are allowed with all origins, since any site could read the data of users with it
+func CORS(opts ...CORSOption) Middleware {
+	p := &corsPolicy{anyOrigin: true, origins: map[string]bool{}, methods: defaultCORSMethods, headers: map[string]bool{}}
+	for _, header := range defaultCORSHeaders {
+		p.headers[strings.ToLower(header)] = true
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.credentials && p.anyOrigin {
+		panic("server: CORS credentials require explicitly allowed origins")
+	}
+
+	// 预先格式化固定的响应头
+	// Format the fixed response headers in advance
+	methods := strings.Join(p.methods, ", ")
+	exposed := strings.Join(p.exposed, ", ")
+	maxAge := ""
+	if p.maxAge > 0 {
+		maxAge = strconv.FormatInt(int64(p.maxAge/time.Second), 10)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			header := w.Header()
+
+			// 响应随源变化时告知缓存
+			// Tell caches when the response varies by origin
+			if !p.anyOrigin {
+				header.Add("Vary", "Origin")
+			}
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			// 不是跨域请求或者源不被允许时不写入跨域响应头
+			// No CORS headers are written when the request is not cross-origin or the origin is not allowed
+			allowed := origin != "" && p.allowOrigin(origin)
+			if !preflight {
+				if allowed {
+					p.writeOrigin(header, origin)
+					if exposed != "" {
+						header.Set("Access-Control-Expose-Headers", exposed)
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 预检请求直接返回，请求的方法和请求头都被允许时才写入跨域响应头
+			// Preflight requests are answered directly, the CORS headers are only written when the requested method and headers are all allowed
+			requested := r.Header.Get("Access-Control-Request-Headers")
+			if allowed && p.allowMethod(r.Header.Get("Access-Control-Request-Method")) && p.allowHeaders(requested) {
+				p.writeOrigin(header, origin)
+				header.Set("Access-Control-Allow-Methods", methods)
+				if requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+				if maxAge != "" {
+					header.Set("Access-Control-Max-Age", maxAge)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// allowOrigin 检查源是否被允许
+// allowOrigin checks whether the origin is allowed
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+
+	// 通配符只能匹配子域名，不能跨越路径、端口或用户信息
+	// The wildcard can only match subdomains, it cannot span paths, ports or user info
+	for _, w := range p.wildcards {
+		if len(origin) > len(w[0])+len(w[1]) && strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) {
+			if sub := origin[len(w[0]) : len(origin)-len(w[1])]; !strings.ContainsAny(sub, "/:@") {
+				return true
+			}
+		}
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMethod 检查请求方法是否被允许
+// allowMethod checks whether the request method is allowed
+func (p *corsPolicy) allowMethod(method string) bool {
+	for _, m := range p.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders 检查以逗号分隔的请求头是否都被允许
+// allowHeaders checks whether the comma-separated request headers are all allowed
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	if p.anyHeader || requested == "" {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !p.headers[strings.ToLower(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeOrigin 写入允许的源和凭据，允许所有的源时写入 "*"，否则回显具体的源
+// writeOrigin writes the allowed origin and credentials, "*" is written when all origins are allowed, otherwise the concrete origin is echoed
+func (p *corsPolicy) writeOrigin(header http.Header, origin string) {
+	if p.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
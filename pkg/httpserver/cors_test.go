@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	handler := Chain(textHandler("ok"), CORS())
+
+	// Any origin is allowed with "*" and the response does not vary by origin
+	w := serve(handler, http.MethodGet, "/", "Origin", "https://a.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Values("Vary"))
+
+	// Requests without an origin pass through without CORS headers
+	w = serve(handler, http.MethodGet, "/")
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_Origins(t *testing.T) {
+	handler := Chain(textHandler("ok"), CORS(
+		WithAllowedOrigins("https://app.example.com", "https://*.example.org"),
+		WithAllowedOriginPatterns(regexp.MustCompile(`^http://localhost:\d+$`)),
+		WithAllowCredentials(),
+		WithExposedHeaders("X-Request-ID"),
+	))
+
+	// Allowed origins are echoed with the credentials and exposed headers
+	for _, origin := range []string{"https://app.example.com", "https://APP.example.com", "https://api.example.org", "https://a.b.example.org", "http://localhost:8080"} {
+		w := serve(handler, http.MethodGet, "/", "Origin", origin)
+		assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	}
+
+	// Other origins still reach the handler but without CORS headers
+	for _, origin := range []string{"https://evil.com", "https://example.org", "https://evilexample.org", "https://evil.com/.example.org", "https://a.example.org:8443", "http://localhost"} {
+		w := serve(handler, http.MethodGet, "/", "Origin", origin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	handler := Chain(textHandler("ok"), CORS(
+		WithAllowedOrigins("https://app.example.com"),
+		WithAllowedMethods("get", "put"),
+		WithAllowedHeaders("Content-Type", "Authorization"),
+		WithMaxAge(10*time.Minute),
+	))
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		return serve(handler, http.MethodOptions, "/", "Origin", origin, "Access-Control-Request-Method", method, "Access-Control-Request-Headers", headers)
+	}
+
+	// An allowed preflight is answered without reaching the handler
+	w := preflight("https://app.example.com", http.MethodPut, "content-type, authorization")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+
+	// Disallowed origins, methods and headers get no CORS headers
+	for _, w := range []*httptest.ResponseRecorder{
+		preflight("https://evil.com", http.MethodPut, ""),
+		preflight("https://app.example.com", http.MethodDelete, ""),
+		preflight("https://app.example.com", http.MethodPut, "X-Custom"),
+	} {
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	}
+
+	// OPTIONS requests that are not preflights reach the handler
+	w = serve(handler, http.MethodOptions, "/", "Origin", "https://app.example.com")
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestCORS_AnyHeader(t *testing.T) {
+	handler := Chain(textHandler("ok"), CORS(WithAllowedHeaders("*")))
+	w := serve(handler, http.MethodOptions, "/", "Origin", "https://a.example.com", "Access-Control-Request-Method", http.MethodPost, "Access-Control-Request-Headers", "X-Anything")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Anything", w.Header().Get("Access-Control-Allow-Headers"))
+}
+
+func TestCORS_Server(t *testing.T) {
+	// Preflights reach the server level middleware even without OPTIONS routes
+	srv, err := NewWithOptions()
+	assert.NoError(t, err)
+	srv.Post("/items", textHandler("created"))
+	srv.Use(CORS(WithAllowedOrigins("https://app.example.com")))
+
+	w := serve(srv, http.MethodOptions, "/items", "Origin", "https://app.example.com", "Access-Control-Request-Method", http.MethodPost)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_InvalidWildcards(t *testing.T) {
+	// The wildcard is only accepted as a leading subdomain label
+	for _, origin := range []string{"https://example.*", "https://*evil.com", "https://app.*.example.com", "*.example.com", "https://*.", "https://*.*.example.com", "https://*"} {
+		assert.PanicsWithValue(t, "server: invalid CORS origin pattern "+strconv.Quote(origin), func() { CORS(WithAllowedOrigins(origin)) }, origin)
+	}
+	assert.NotPanics(t, func() { CORS(WithAllowedOrigins("https://*.example.com", "http://*.localhost:8080")) })
+}
+
+func TestCORS_CredentialsWithAnyOrigin(t *testing.T) {
+	// Credentials with all origins would let any site read the data of users
+	assert.PanicsWithValue(t, "server: CORS credentials require explicitly allowed origins", func() { CORS(WithAllowCredentials()) })
+	assert.Panics(t, func() { CORS(WithAllowCredentials(), WithAllowedOrigins("https://app.example.com", "*")) })
+
+	// Credentials with explicit origins are allowed
+	assert.NotPanics(t, func() { CORS(WithAllowCredentials(), WithAllowedOrigins("https://app.example.com")) })
+	assert.NotPanics(t, func() {
+		CORS(WithAllowedOriginPatterns(regexp.MustCompile(`^https://app\.example\.com$`)), WithAllowCredentials())
+	})
+}
@@ -3,3 +3,16 @@ module github.com/shengyanli1982/toolkit/pkg/httpserver
 go 1.19
 
 replace github.com/shengyanli1982/toolkit => ../../
+
+replace github.com/shengyanli1982/toolkit/pkg/httptool => ../httptool
+
+require (
+	github.com/shengyanli1982/toolkit/pkg/httptool v0.0.0-00010101000000-000000000000
+	github.com/stretchr/testify v1.9.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
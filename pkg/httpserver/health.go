@@ -0,0 +1,385 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// LivenessPath 是存活探针的路径
+	// LivenessPath is the path of the liveness probe
+	LivenessPath = "/livez"
+
+	// ReadinessPath 是就绪探针的路径
+	// ReadinessPath is the path of the readiness probe
+	ReadinessPath = "/readyz"
+
+	// StartupPath 是启动探针的路径
+	// StartupPath is the path of the startup probe
+	StartupPath = "/startupz"
+
+	// defaultCheckTimeout 是默认的检查超时时间（秒）
+	// defaultCheckTimeout is the default timeout of a check in seconds
+	defaultCheckTimeout = 5
+
+	// serverCheckName 是就绪探针中表示服务器自身状态的检查名称
+	// serverCheckName is the name of the check representing the state of the server itself in the readiness probe
+	serverCheckName = "server"
+)
+
+var (
+	// errShuttingDown 表示服务器正在关闭
+	// errShuttingDown indicates the server is shutting down
+	errShuttingDown = errors.New("server is shutting down")
+
+	// errNotReady 表示服务器被标记为未就绪
+	// errNotReady indicates the server is marked as not ready
+	errNotReady = errors.New("server is marked as not ready")
+)
+
+// Checker 是一个健康检查函数，返回 nil 表示健康，上下文在检查超时后取消
+// Checker is a health check function, nil means healthy, the context is cancelled after the check times out
+type Checker func(ctx context.Context) error
+
+// CheckOption 是健康检查的配置选项
+// CheckOption is a configuration option of a health check
+type CheckOption func(*check)
+
+// WithCheckTimeout 设置检查的超时时间，默认是 5 秒
+// WithCheckTimeout sets the timeout of the check, the default is 5 seconds
+func WithCheckTimeout(timeout time.Duration) CheckOption {
+	return func(c *check) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithCheckCache 设置检查结果的缓存时间，缓存期间的探针直接使用上一次的结果，避免频繁的探针压垮依赖，默认不缓存
+// WithCheckCache sets the time the check result is cached, probes within the time reuse the last result to avoid frequent probes overwhelming the dependency, the default is no caching
+func WithCheckCache(ttl time.Duration) CheckOption {
+	return func(c *check) {
+		c.ttl = ttl
+	}
+}
+
+// check 是一个带名称的健康检查
+// check is a named health check
+type check struct {
+	// name 是检查的名称
+	// name is the name of the check
+	name string
+
+	// fn 是检查函数
+	// fn is the check function
+	fn Checker
+
+	// timeout 是检查的超时时间
+	// timeout is the timeout of the check
+	timeout time.Duration
+
+	// ttl 是检查结果的缓存时间
+	// ttl is the time the check result is cached
+	ttl time.Duration
+
+	// mu 保护下面的字段，同时保证同一个检查不会并发执行
+	// mu protects the fields below and ensures the same check is not run concurrently
+	mu sync.Mutex
+
+	// last 是上一次检查的结果
+	// last is the result of the last check
+	last CheckResult
+
+	// lastTime 是上一次检查的时间
+	// lastTime is the time of the last check
+	lastTime time.Time
+}
+
+// run 执行检查并返回结果，缓存有效时返回缓存的结果
+// run runs the check and returns the result, the cached result is returned when the cache is valid
+func (c *check) run(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 使用缓存的结果
+	// Use the cached result
+	if c.ttl > 0 && !c.lastTime.IsZero() && time.Since(c.lastTime) < c.ttl {
+		result := c.last
+		result.Cached = true
+		return result
+	}
+
+	// 在超时时间内执行检查，检查没有及时返回时不再等待它
+	// Run the check within the timeout, the check is no longer waited for if it does not return in time
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				errCh <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		errCh <- c.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %v", c.timeout)
+	}
+
+	// 记录检查的结果
+	// Record the result of the check
+	c.last, c.lastTime = newCheckResult(c.name, err, time.Since(start)), time.Now()
+	return c.last
+}
+
+// CheckResult 是一个健康检查的结果
+// CheckResult is the result of a health check
+type CheckResult struct {
+	// Name 是检查的名称
+	// Name is the name of the check
+	Name string `json:"name"`
+
+	// Healthy 表示检查是否通过
+	// Healthy indicates whether the check passed
+	Healthy bool `json:"healthy"`
+
+	// Error 是检查失败的原因
+	// Error is the reason the check failed
+	Error string `json:"error,omitempty"`
+
+	// Duration 是检查花费的时间
+	// Duration is the time the check took
+	Duration string `json:"duration"`
+
+	// Cached 表示结果是否来自缓存
+	// Cached indicates whether the result comes from the cache
+	Cached bool `json:"cached,omitempty"`
+}
+
+// newCheckResult 根据检查的错误创建检查结果
+// newCheckResult creates the check result from the error of the check
+func newCheckResult(name string, err error, duration time.Duration) CheckResult {
+	result := CheckResult{Name: name, Healthy: err == nil, Duration: duration.String()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ProbeReport 是一个探针的详细结果
+// ProbeReport is the verbose result of a probe
+type ProbeReport struct {
+	// Healthy 表示所有的检查是否都通过
+	// Healthy indicates whether all checks passed
+	Healthy bool `json:"healthy"`
+
+	// Checks 是每个检查的结果，按照注册的顺序排列
+	// Checks are the results of each check, in the order of registration
+	Checks []CheckResult `json:"checks"`
+}
+
+// probe 是一个探针，包含一组检查
+// probe is a probe containing a group of checks
+type probe struct {
+	// mu 保护检查列表
+	// mu protects the list of checks
+	mu sync.RWMutex
+
+	// checks 是探针的检查，按照注册的顺序排列
+	// checks are the checks of the probe, in the order of registration
+	checks []*check
+
+	// pre 是在注册的检查之前执行的内置检查，为空时忽略
+	// pre is the built-in check run before the registered checks, it is ignored when nil
+	pre func() error
+
+	// sticky 表示探针通过一次后总是成功，不再执行检查
+	// sticky indicates the probe always succeeds after passing once, the checks are no longer run
+	sticky bool
+
+	// passed 表示探针已经通过过一次
+	// passed indicates the probe has passed once
+	passed atomic.Bool
+}
+
+// add 向探针添加一个检查，名称重复时 panic
+// add adds a check to the probe, it panics if the name is duplicated
+func (p *probe) add(name string, fn Checker, opts ...CheckOption) {
+	if fn == nil {
+		panic("server: nil checker for " + name)
+	}
+	c := &check{name: name, fn: fn, timeout: time.Second * defaultCheckTimeout}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, existing := range p.checks {
+		if existing.name == name {
+			panic("server: multiple registrations for check " + name)
+		}
+	}
+	p.checks = append(p.checks, c)
+}
+
+// run 并发执行所有的检查并返回报告
+// run runs all checks concurrently and returns the report
+func (p *probe) run(ctx context.Context) ProbeReport {
+	// 通过一次后总是成功的探针不再执行检查
+	// A probe which always succeeds after passing once no longer runs the checks
+	report := ProbeReport{Healthy: true, Checks: []CheckResult{}}
+	if p.sticky && p.passed.Load() {
+		return report
+	}
+
+	p.mu.RLock()
+	checks := append([]*check(nil), p.checks...)
+	p.mu.RUnlock()
+
+	// 先执行内置检查
+	// Run the built-in check first
+	if p.pre != nil {
+		report.Checks = append(report.Checks, newCheckResult(serverCheckName, p.pre(), 0))
+	}
+
+	// 并发执行注册的检查
+	// Run the registered checks concurrently
+	results := make([]CheckResult, len(checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+	report.Checks = append(report.Checks, results...)
+
+	// 汇总检查的结果
+	// Summarize the results of the checks
+	for _, result := range report.Checks {
+		report.Healthy = report.Healthy && result.Healthy
+	}
+	if p.sticky && report.Healthy {
+		p.passed.Store(true)
+	}
+	return report
+}
+
+// ServeHTTP 执行探针并返回结果，健康时返回 200，否则返回 503。带有 verbose 查询参数时返回每个检查的 JSON 结果
+// ServeHTTP runs the probe and returns the result, 200 is returned when healthy, otherwise 503. The JSON result of each check is returned with the verbose query parameter
+func (p *probe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := p.run(r.Context())
+	code := http.StatusOK
+	if !report.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	// 返回详细的 JSON 结果
+	// Return the verbose JSON result
+	if _, verbose := r.URL.Query()["verbose"]; verbose {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	// 返回简短的文本结果，列出失败的检查
+	// Return the short text result, listing the failed checks
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	if report.Healthy {
+		_, _ = w.Write([]byte("ok"))
+		return
+	}
+	failed := make([]string, 0, len(report.Checks))
+	for _, result := range report.Checks {
+		if !result.Healthy {
+			failed = append(failed, result.Name)
+		}
+	}
+	_, _ = fmt.Fprintf(w, "failed: %s", strings.Join(failed, ", "))
+}
+
+// health 是服务器的健康子系统，包含存活、就绪和启动探针
+// health is the health subsystem of the server, containing the liveness, readiness and startup probes
+type health struct {
+	// liveness 是存活探针，失败表示进程需要重启
+	// liveness is the liveness probe, a failure means the process needs a restart
+	liveness *probe
+
+	// readiness 是就绪探针，失败表示服务器暂时不应接收流量
+	// readiness is the readiness probe, a failure means the server should not receive traffic for now
+	readiness *probe
+
+	// startup 是启动探针，失败表示服务器还在启动
+	// startup is the startup probe, a failure means the server is still starting
+	startup *probe
+
+	// notReady 表示服务器被手动标记为未就绪
+	// notReady indicates the server is manually marked as not ready
+	notReady atomic.Bool
+}
+
+// newHealth 创建健康子系统，draining 返回服务器是否正在关闭
+// newHealth creates the health subsystem, draining returns whether the server is shutting down
+func newHealth(draining func() bool) *health {
+	h := &health{liveness: &probe{}, readiness: &probe{}, startup: &probe{sticky: true}}
+	h.readiness.pre = func() error {
+		switch {
+		case draining():
+			return errShuttingDown
+		case h.notReady.Load():
+			return errNotReady
+		default:
+			return nil
+		}
+	}
+	return h
+}
+
+// WithHealthProbes 在 /livez、/readyz 和 /startupz 注册存活、就绪和启动探针。探针健康时返回 200，否则返回 503，带有 verbose 查询参数时返回每个检查的 JSON 结果
+// WithHealthProbes registers the liveness, readiness and startup probes on /livez, /readyz and /startupz. The probes return 200 when healthy, otherwise 503, the JSON result of each check is returned with the verbose query parameter
+func WithHealthProbes() Option {
+	return func(o *options) {
+		o.healthProbes = true
+	}
+}
+
+// AddLivenessCheck 添加一个存活检查，名称重复时 panic。存活检查失败表示进程需要重启，只应检查进程自身的状态
+// AddLivenessCheck adds a liveness check, it panics if the name is duplicated. A failed liveness check means the process needs a restart, it should only check the state of the process itself
+func (s *TinyHttpServer) AddLivenessCheck(name string, fn Checker, opts ...CheckOption) {
+	s.health.liveness.add(name, fn, opts...)
+}
+
+// AddReadinessCheck 添加一个就绪检查，名称重复时 panic。就绪检查失败表示服务器暂时不应接收流量，例如依赖的数据库不可用
+// AddReadinessCheck adds a readiness check, it panics if the name is duplicated. A failed readiness check means the server should not receive traffic for now, such as when the database it depends on is unavailable
+func (s *TinyHttpServer) AddReadinessCheck(name string, fn Checker, opts ...CheckOption) {
+	s.health.readiness.add(name, fn, opts...)
+}
+
+// AddStartupCheck 添加一个启动检查，名称重复时 panic。启动探针在所有启动检查通过一次后总是成功
+// AddStartupCheck adds a startup check, it panics if the name is duplicated. The startup probe always succeeds after all startup checks pass once
+func (s *TinyHttpServer) AddStartupCheck(name string, fn Checker, opts ...CheckOption) {
+	s.health.startup.add(name, fn, opts...)
+}
+
+// SetReady 手动标记服务器是否就绪，未就绪时就绪探针失败。服务器关闭时就绪探针总是失败
+// SetReady manually marks whether the server is ready, the readiness probe fails when not ready. The readiness probe always fails when the server shuts down
+func (s *TinyHttpServer) SetReady(ready bool) {
+	s.health.notReady.Store(!ready)
+}
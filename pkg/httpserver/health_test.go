@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// probeReport sends a verbose probe request and returns the status code and report
+func probeReport(t *testing.T, url string) (int, ProbeReport) {
+	t.Helper()
+	report := ProbeReport{}
+	resp, err := http.Get(url + "?verbose")
+	if !assert.NoError(t, err) {
+		return 0, report
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	return resp.StatusCode, report
+}
+
+func TestTinyHttpServer_HealthProbes(t *testing.T) {
+	// Start a server with the health probes
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithHealthProbes())
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	base := fmt.Sprintf("http://%s", srv.Addr())
+
+	// Register the checks
+	var dbErr atomic.Value
+	dbErr.Store(errors.New("connection refused"))
+	srv.AddLivenessCheck("goroutines", func(context.Context) error { return nil })
+	srv.AddReadinessCheck("db", func(context.Context) error {
+		if err, ok := dbErr.Load().(error); ok {
+			return err
+		}
+		return nil
+	})
+	srv.AddReadinessCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, WithCheckTimeout(20*time.Millisecond))
+	warm := atomic.Bool{}
+	srv.AddStartupCheck("cache", func(context.Context) error {
+		if !warm.Load() {
+			return errors.New("warming up")
+		}
+		return nil
+	})
+
+	// The liveness probe succeeds
+	code, body := get(t, base+LivenessPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body)
+
+	// The readiness probe reports the failed checks
+	code, body = get(t, base+ReadinessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "failed: db, slow", body)
+	code, report := probeReport(t, base+ReadinessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Healthy)
+	if assert.Len(t, report.Checks, 3) {
+		assert.Equal(t, "server", report.Checks[0].Name)
+		assert.True(t, report.Checks[0].Healthy)
+		assert.Equal(t, "connection refused", report.Checks[1].Error)
+		assert.Equal(t, "check timed out after 20ms", report.Checks[2].Error)
+	}
+
+	// The startup probe keeps succeeding after passing once
+	code, _ = get(t, base+StartupPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	warm.Store(true)
+	code, _ = get(t, base+StartupPath)
+	assert.Equal(t, http.StatusOK, code)
+	warm.Store(false)
+	code, _ = get(t, base+StartupPath)
+	assert.Equal(t, http.StatusOK, code)
+
+	// The server can be marked as not ready manually
+	srv.SetReady(false)
+	_, report = probeReport(t, base+ReadinessPath)
+	assert.Equal(t, "server is marked as not ready", report.Checks[0].Error)
+	srv.SetReady(true)
+}
+
+func TestTinyHttpServer_HealthCheckCache(t *testing.T) {
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithHealthProbes())
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	url := fmt.Sprintf("http://%s%s", srv.Addr(), ReadinessPath)
+
+	// Register a cached check counting its calls
+	calls := atomic.Int32{}
+	srv.AddReadinessCheck("db", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}, WithCheckCache(time.Hour))
+
+	// The second probe uses the cached result
+	_, report := probeReport(t, url)
+	assert.False(t, report.Checks[1].Cached)
+	_, report = probeReport(t, url)
+	assert.True(t, report.Checks[1].Cached)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestTinyHttpServer_HealthProbesShutdown(t *testing.T) {
+	// Start a server with a drain delay
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithHealthProbes(), WithDrainDelay(200*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	base := fmt.Sprintf("http://%s", srv.Addr())
+	code, _ := get(t, base+ReadinessPath)
+	assert.Equal(t, http.StatusOK, code)
+
+	// The readiness probe fails during the shutdown while the liveness probe still succeeds
+	go srv.Stop()
+	assert.Eventually(t, srv.Draining, time.Second, 5*time.Millisecond)
+	_, report := probeReport(t, base+ReadinessPath)
+	assert.Equal(t, "server is shutting down", report.Checks[0].Error)
+	code, _ = get(t, base+LivenessPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NoError(t, srv.Wait())
+}
+
+func TestTinyHttpServer_HealthCheckDuplicate(t *testing.T) {
+	srv := New(0, nil, nil)
+	srv.AddReadinessCheck("db", func(context.Context) error { return nil })
+	assert.Panics(t, func() { srv.AddReadinessCheck("db", func(context.Context) error { return nil }) })
+	assert.Panics(t, func() { srv.AddLivenessCheck("nil", nil) })
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shengyanli1982/toolkit/pkg/httptool"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve sends a request with the header name and value pairs to the handler and returns the recorder
+func serve(h http.Handler, method, target string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// assertErrorBody checks the status and the JSON error body in the format of httptool.BaseHttpResponse written by writeError
+func assertErrorBody(t *testing.T, w *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+	assert.Equal(t, status, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	resp := httptool.BaseHttpResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(status), resp.Code)
+	assert.Equal(t, message, resp.ErrorMessage)
+}
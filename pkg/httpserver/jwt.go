@@ -0,0 +1,619 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SchemeJWT 是 JWT 认证的方案名称
+	// SchemeJWT is the scheme name of the JWT authentication
+	SchemeJWT = "jwt"
+
+	// HS256 是使用 SHA-256 的 HMAC 签名算法，密钥是 []byte
+	// HS256 is the HMAC signature algorithm with SHA-256, the key is []byte
+	HS256 = "HS256"
+
+	// RS256 是使用 SHA-256 的 RSASSA-PKCS1-v1_5 签名算法，密钥是 *rsa.PublicKey
+	// RS256 is the RSASSA-PKCS1-v1_5 signature algorithm with SHA-256, the key is *rsa.PublicKey
+	RS256 = "RS256"
+
+	// ES256 是使用 P-256 和 SHA-256 的 ECDSA 签名算法，密钥是 *ecdsa.PublicKey
+	// ES256 is the ECDSA signature algorithm with P-256 and SHA-256, the key is *ecdsa.PublicKey
+	ES256 = "ES256"
+
+	// minRSAKeyBits 是接受的 RSA 密钥的最小位数
+	// minRSAKeyBits is the minimum number of bits of the accepted RSA keys
+	minRSAKeyBits = 2048
+)
+
+var (
+	// errInvalidToken 表示令牌的格式或者签名无效
+	// errInvalidToken indicates the format or the signature of the token is invalid
+	errInvalidToken = errors.New("invalid token")
+
+	// errTokenExpired 表示令牌已经过期
+	// errTokenExpired indicates the token is expired
+	errTokenExpired = errors.New("token is expired")
+
+	// errTokenNotYetValid 表示令牌还没有生效
+	// errTokenNotYetValid indicates the token is not valid yet
+	errTokenNotYetValid = errors.New("token is not valid yet")
+
+	// errInvalidIssuer 表示令牌的签发者不被接受
+	// errInvalidIssuer indicates the issuer of the token is not accepted
+	errInvalidIssuer = errors.New("invalid token issuer")
+
+	// errInvalidAudience 表示令牌的受众不包含要求的受众
+	// errInvalidAudience indicates the audience of the token does not contain the required audience
+	errInvalidAudience = errors.New("invalid token audience")
+)
+
+// Claims 是验证通过的 JWT 声明
+// Claims are the claims of a verified JWT
+type Claims struct {
+	// Issuer 是签发者，iss 声明
+	// Issuer is the issuer, the iss claim
+	Issuer string
+
+	// Subject 是主体，sub 声明
+	// Subject is the subject, the sub claim
+	Subject string
+
+	// Audience 是受众，aud 声明，单个字符串也转换为列表
+	// Audience is the audience, the aud claim, a single string is converted into a list as well
+	Audience []string
+
+	// ExpiresAt 是过期时间，exp 声明，没有时为零值
+	// ExpiresAt is the expiration time, the exp claim, it is the zero value when absent
+	ExpiresAt time.Time
+
+	// NotBefore 是生效时间，nbf 声明，没有时为零值
+	// NotBefore is the time the token becomes valid, the nbf claim, it is the zero value when absent
+	NotBefore time.Time
+
+	// IssuedAt 是签发时间，iat 声明，没有时为零值
+	// IssuedAt is the issuing time, the iat claim, it is the zero value when absent
+	IssuedAt time.Time
+
+	// ID 是令牌的唯一标识，jti 声明
+	// ID is the unique identifier of the token, the jti claim
+	ID string
+
+	// Raw 是所有声明的原始 JSON，用于读取自定义的声明
+	// Raw is the raw JSON of all claims, used to read custom claims
+	Raw map[string]json.RawMessage
+}
+
+// Get 将名称为 name 的自定义声明解码到 v 中，声明不存在时返回 false
+// Get decodes the custom claim named name into v, false is returned if the claim does not exist
+func (c *Claims) Get(name string, v interface{}) (bool, error) {
+	raw, ok := c.Raw[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// ClaimsFromContext 返回上下文中验证通过的 JWT 声明，请求没有经过 JWTAuth 中间件时返回 nil 和 false
+// ClaimsFromContext returns the claims of the verified JWT in the context, nil and false are returned if the request did not pass the JWTAuth middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsContextKey).(*Claims)
+	return c, ok
+}
+
+// KeySet 是验证 JWT 签名使用的密钥集合
+// KeySet is the key set used to verify the JWT signatures
+type KeySet interface {
+	// Key 返回密钥 ID 对应的密钥，令牌没有 kid 时 kid 为空字符串。密钥是 []byte、*rsa.PublicKey 或 *ecdsa.PublicKey
+	// Key returns the key of the key ID, kid is an empty string when the token has no kid. The key is []byte, *rsa.PublicKey or *ecdsa.PublicKey
+	Key(kid string) (interface{}, bool)
+}
+
+// StaticKeys 是密钥 ID 到密钥的固定映射，空字符串的键用于没有 kid 的令牌
+// StaticKeys is a fixed map from key IDs to keys, the key of the empty string is used for tokens without kid
+type StaticKeys map[string]interface{}
+
+// Key 返回密钥 ID 对应的密钥
+// Key returns the key of the key ID
+func (k StaticKeys) Key(kid string) (interface{}, bool) {
+	key, ok := k[kid]
+	return key, ok
+}
+
+// JWKSFile 是从本地 JWKS 文件加载的密钥集合。查找密钥时，距离上一次检查超过刷新间隔就检查文件的修改时间，文件变化时重新加载；
+// 重新加载失败时继续使用之前的密钥。查找只持有读锁，检查和解析文件在锁外进行，只有替换密钥时短暂持有写锁。可以安全地并发使用
+// JWKSFile is the key set loaded from a local JWKS file. When looking up keys, the modification time of the file is checked if the refresh interval has passed since the last check, and the file is reloaded when it changed;
+// the previous keys stay in use if reloading fails. Lookups only hold the read lock, checking and parsing the file happen outside the lock, and the write lock is only held briefly to swap the keys. It is safe for concurrent use
+type JWKSFile struct {
+	// path 是 JWKS 文件的路径
+	// path is the path of the JWKS file
+	path string
+
+	// refresh 是检查文件变化的间隔，0 表示不自动刷新
+	// refresh is the interval of checking the file for changes, 0 means it is not refreshed automatically
+	refresh time.Duration
+
+	// logger 记录加载时跳过的密钥
+	// logger records the keys skipped when loading
+	logger LeveledLogger
+
+	// checked 是上一次检查文件的时间（Unix 纳秒），到期的检查通过比较并交换只由一个 goroutine 进行
+	// checked is the time of the last check of the file in Unix nanoseconds, a due check is done by only one goroutine through compare-and-swap
+	checked atomic.Int64
+
+	// reloading 串行化重新加载，使较早读取的文件不会覆盖较新的密钥
+	// reloading serializes reloads, so that a file read earlier never overwrites newer keys
+	reloading sync.Mutex
+
+	// mu 保护下面的状态
+	// mu protects the state below
+	mu sync.RWMutex
+
+	// keys 是密钥 ID 到密钥的映射
+	// keys is the map from key IDs to keys
+	keys map[string]interface{}
+
+	// modTime 是加载的文件的修改时间
+	// modTime is the modification time of the loaded file
+	modTime time.Time
+}
+
+// JWKSOption 是 JWKS 文件的配置选项
+// JWKSOption is a configuration option of the JWKS file
+type JWKSOption func(*JWKSFile)
+
+// WithJWKSLogger 设置记录被跳过的密钥的日志记录器，默认使用 log.Printf
+// WithJWKSLogger sets the logger recording the skipped keys, log.Printf is used by default
+func WithJWKSLogger(logger Logger) JWKSOption {
+	return func(f *JWKSFile) {
+		f.logger = leveled(logger)
+	}
+}
+
+// NewJWKSFile 从 path 加载 JWKS 文件，refresh 是检查文件变化的间隔，0 表示不自动刷新。
+// 支持 RSA（至少 2048 位）、P-256 的 EC 和 oct 类型的密钥，其他类型、曲线和过弱的密钥被跳过并记录日志。文件无法加载或者没有可用的密钥时返回错误
+// NewJWKSFile loads the JWKS file from path, refresh is the interval of checking the file for changes, 0 means it is not refreshed automatically.
+// Keys of the RSA (at least 2048 bits), EC with P-256 and oct types are supported, keys of other types and curves and weak keys are skipped and logged. An error is returned if the file cannot be loaded or has no usable key
+func NewJWKSFile(path string, refresh time.Duration, opts ...JWKSOption) (*JWKSFile, error) {
+	f := &JWKSFile{path: path, refresh: refresh, logger: leveled(nil)}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	f.checked.Store(time.Now().UnixNano())
+	return f, nil
+}
+
+// Key 返回密钥 ID 对应的密钥，必要时先刷新文件
+// Key returns the key of the key ID, refreshing the file first if necessary
+func (f *JWKSFile) Key(kid string) (interface{}, bool) {
+	if f.refresh > 0 {
+		f.refreshIfDue(time.Now())
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	key, ok := f.keys[kid]
+	return key, ok
+}
+
+// refreshIfDue 在距离上一次检查超过刷新间隔时检查文件的修改时间，文件变化时重新加载。同一时间只有一个 goroutine 检查，其他的继续使用当前的密钥
+// refreshIfDue checks the modification time of the file when the refresh interval has passed since the last check, reloading the file when it changed. Only one goroutine checks at a time, the others keep using the current keys
+func (f *JWKSFile) refreshIfDue(now time.Time) {
+	last := f.checked.Load()
+	if now.UnixNano()-last < int64(f.refresh) || !f.checked.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return
+	}
+	f.mu.RLock()
+	changed := !info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if changed {
+		_ = f.Reload()
+	}
+}
+
+// Reload 立即重新加载 JWKS 文件，失败或者没有可用的密钥时继续使用之前的密钥
+// Reload reloads the JWKS file immediately, the previous keys stay in use on failure or when the file has no usable key
+func (f *JWKSFile) Reload() error {
+	f.reloading.Lock()
+	defer f.reloading.Unlock()
+
+	// 在锁外读取和解析文件，查找密钥不会被阻塞
+	// Read and parse the file outside the lock, so that looking up keys is not blocked
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	// 跳过不支持的和过弱的密钥，其他的密钥继续可用，只有没有可用的密钥时才失败
+	// Skip the unsupported and weak keys so that the other keys stay usable, it only fails when no usable key is left
+	var skipped error
+	keys, err := parseJWKS(data, func(kid string, err error) {
+		f.logger.Warn("JWKS key skipped", "path", f.path, "kid", kid, "error", err)
+		if skipped == nil {
+			skipped = fmt.Errorf("key %q: %w", kid, err)
+		}
+	})
+	if err == nil && len(keys) == 0 {
+		err = errors.New("no usable key")
+		if skipped != nil {
+			err = fmt.Errorf("no usable key, %w", skipped)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid JWKS file %s: %w", f.path, err)
+	}
+
+	// 替换密钥
+	// Swap the keys
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys, f.modTime = keys, info.ModTime()
+	return nil
+}
+
+// jwk 是 JWKS 中的一个密钥，字段的含义见 RFC 7517 和 RFC 7518
+// jwk is a key in the JWKS, the fields are defined in RFC 7517 and RFC 7518
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS 解析 JWKS 文档，跳过不用于签名的密钥，无法使用的密钥交给 skip 后跳过
+// parseJWKS parses the JWKS document, skipping the keys not used for signatures, the unusable keys are passed to skip and skipped
+func parseJWKS(data []byte, skip func(kid string, err error)) (map[string]interface{}, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			skip(k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey 将 JWK 转换为验证签名使用的密钥
+// publicKey converts the JWK into the key used to verify signatures
+func (k *jwk) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+
+		// 拒绝过小的公钥指数和过短的模数，它们可以被轻易地伪造签名或者分解
+		// Reject too small public exponents and too short moduli, signatures can be easily forged with them or they can be factored
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.E < 3 {
+			return nil, fmt.Errorf("RSA public exponent %d is too small", key.E)
+		}
+		if bits := key.N.BitLen(); bits < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key of %d bits is shorter than %d bits", bits, minRSAKeyBits)
+		}
+		return key, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return key, nil
+	case "oct":
+		secret, err := decode(k.K)
+		if err != nil {
+			return nil, err
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// JWTOption 是 JWT 认证中间件的配置选项
+// JWTOption is a configuration option of the JWT authentication middleware
+type JWTOption func(*jwtOptions)
+
+// jwtOptions 是 JWT 认证中间件的配置
+// jwtOptions is the configuration of the JWT authentication middleware
+type jwtOptions struct {
+	// algorithms 是接受的签名算法
+	// algorithms are the accepted signature algorithms
+	algorithms map[string]bool
+
+	// issuers 是接受的签发者，为空表示不检查
+	// issuers are the accepted issuers, empty means they are not checked
+	issuers []string
+
+	// audience 是令牌必须包含的受众，为空表示不检查
+	// audience is the audience the token must contain, empty means it is not checked
+	audience string
+
+	// leeway 是检查过期时间和生效时间时允许的时钟偏差
+	// leeway is the clock skew allowed when checking the expiration and the valid time
+	leeway time.Duration
+
+	// now 返回当前时间，用于测试
+	// now returns the current time, used for tests
+	now func() time.Time
+}
+
+// WithJWTAlgorithms 设置接受的签名算法，默认接受 HS256、RS256 和 ES256。算法必须与密钥的类型匹配，none 永远不被接受
+// WithJWTAlgorithms sets the accepted signature algorithms, HS256, RS256 and ES256 are accepted by default. The algorithm must match the type of the key, none is never accepted
+func WithJWTAlgorithms(algorithms ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.algorithms = make(map[string]bool, len(algorithms))
+		for _, alg := range algorithms {
+			o.algorithms[alg] = true
+		}
+	}
+}
+
+// WithIssuer 设置接受的签发者，令牌的 iss 声明必须是其中之一，默认不检查
+// WithIssuer sets the accepted issuers, the iss claim of the token must be one of them, it is not checked by default
+func WithIssuer(issuers ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.issuers = append(o.issuers, issuers...)
+	}
+}
+
+// WithAudience 设置令牌必须包含的受众，默认不检查
+// WithAudience sets the audience the token must contain, it is not checked by default
+func WithAudience(audience string) JWTOption {
+	return func(o *jwtOptions) {
+		o.audience = audience
+	}
+}
+
+// WithLeeway 设置检查 exp 和 nbf 时允许的时钟偏差，默认是 0
+// WithLeeway sets the clock skew allowed when checking exp and nbf, the default is 0
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(o *jwtOptions) {
+		if leeway > 0 {
+			o.leeway = leeway
+		}
+	}
+}
+
+// JWTAuth 返回一个验证 Authorization: Bearer <jwt> 请求头的中间件，签名使用 keys 中与令牌 kid 对应的密钥验证，并检查 exp、nbf、iss 和 aud。
+// 验证通过的声明可以通过 ClaimsFromContext 读取，同时 sub 作为名称放入认证主体。
+// 验证失败时返回 401、WWW-Authenticate 响应头和 httptool.BaseHttpResponse 格式的 JSON 响应体。keys 为 nil 时会 panic
+// JWTAuth returns a middleware verifying the Authorization: Bearer <jwt> header, the signature is verified with the key in keys matching the kid of the token, and exp, nbf, iss and aud are checked.
+// The verified claims can be read with ClaimsFromContext, and sub is placed in the authenticated principal as the name.
+// 401, the WWW-Authenticate header and a JSON body in the format of httptool.BaseHttpResponse are returned on failure. It panics if keys is nil
+func JWTAuth(keys KeySet, opts ...JWTOption) Middleware {
+	if keys == nil {
+		panic("server: nil key set")
+	}
+	o := &jwtOptions{now: time.Now}
+	WithJWTAlgorithms(HS256, RS256, ES256)(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			claims, err := verifyJWT(token, keys, o)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			r = withPrincipal(r, claims.Subject, SchemeJWT)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+		})
+	}
+}
+
+// verifyJWT 验证令牌的签名和声明，返回验证通过的声明
+// verifyJWT verifies the signature and the claims of the token, returning the verified claims
+func verifyJWT(token string, keys KeySet, o *jwtOptions) (*Claims, error) {
+	// 拆分并解码头部、载荷和签名
+	// Split and decode the header, the payload and the signature
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	// 验证签名，算法必须被接受且与密钥的类型匹配
+	// Verify the signature, the algorithm must be accepted and match the type of the key
+	key, ok := keys.Key(header.Kid)
+	if !ok || !o.algorithms[header.Alg] || !verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, errInvalidToken
+	}
+
+	// 签名有效之后才解析声明
+	// The claims are only parsed after the signature is valid
+	claims, err := parseClaims(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	now := o.now()
+	if !claims.ExpiresAt.IsZero() && !now.Before(claims.ExpiresAt.Add(o.leeway)) {
+		return nil, errTokenExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Before(claims.NotBefore.Add(-o.leeway)) {
+		return nil, errTokenNotYetValid
+	}
+	if len(o.issuers) > 0 && !containsString(o.issuers, claims.Issuer) {
+		return nil, errInvalidIssuer
+	}
+	if o.audience != "" && !containsString(claims.Audience, o.audience) {
+		return nil, errInvalidAudience
+	}
+	return claims, nil
+}
+
+// verifySignature 使用算法和密钥验证签名，密钥的类型与算法不匹配时返回 false
+// verifySignature verifies the signature with the algorithm and the key, false is returned if the type of the key does not match the algorithm
+func verifySignature(alg string, key interface{}, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		_, _ = mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case ES256:
+		// 签名是 32 字节的 R 和 32 字节的 S 拼接而成
+		// The signature is the 32-byte R concatenated with the 32-byte S
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		return ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+	default:
+		return false
+	}
+}
+
+// parseClaims 解析令牌的载荷
+// parseClaims parses the payload of the token
+func parseClaims(segment string) (*Claims, error) {
+	raw := map[string]json.RawMessage{}
+	if err := decodeSegment(segment, &raw); err != nil {
+		return nil, err
+	}
+	claims := &Claims{Raw: raw}
+	for name, dst := range map[string]*string{"iss": &claims.Issuer, "sub": &claims.Subject, "jti": &claims.ID} {
+		if v, ok := raw[name]; ok {
+			if err := json.Unmarshal(v, dst); err != nil {
+				return nil, fmt.Errorf("claim %s: %w", name, err)
+			}
+		}
+	}
+	for name, dst := range map[string]*time.Time{"exp": &claims.ExpiresAt, "nbf": &claims.NotBefore, "iat": &claims.IssuedAt} {
+		if v, ok := raw[name]; ok {
+			var seconds json.Number
+			if err := json.Unmarshal(v, &seconds); err != nil {
+				return nil, fmt.Errorf("claim %s: %w", name, err)
+			}
+			f, err := seconds.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("claim %s: %w", name, err)
+			}
+			*dst = time.Unix(int64(f), 0)
+		}
+	}
+
+	// aud 可以是字符串或者字符串数组
+	// aud can be a string or an array of strings
+	if v, ok := raw["aud"]; ok {
+		var single string
+		if err := json.Unmarshal(v, &single); err == nil {
+			claims.Audience = []string{single}
+		} else if err := json.Unmarshal(v, &claims.Audience); err != nil {
+			return nil, fmt.Errorf("claim aud: %w", err)
+		}
+	}
+	return claims, nil
+}
+
+// decodeSegment 解码 base64url 编码的 JSON 段
+// decodeSegment decodes the base64url encoded JSON segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// containsString 检查列表是否包含字符串
+// containsString checks whether the list contains the string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
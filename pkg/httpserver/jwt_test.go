@@ -0,0 +1,332 @@
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signJWT signs the claims with the algorithm and the private key, the key is []byte, *rsa.PrivateKey or *ecdsa.PrivateKey
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// claimsHandler writes the subject and the role claim of the verified token
+func claimsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "no claims", http.StatusInternalServerError)
+			return
+		}
+		var role string
+		_, _ = claims.Get("role", &role)
+		p, _ := PrincipalFromContext(r.Context())
+		_, _ = w.Write([]byte(claims.Subject + "/" + role + "/" + p.Scheme))
+	})
+}
+
+func TestJWTAuth_Algorithms(t *testing.T) {
+	secret := []byte("hmac-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	keys := StaticKeys{"hs": secret, "rs": &rsaKey.PublicKey, "es": &ecKey.PublicKey}
+	handler := Chain(claimsHandler(), JWTAuth(keys))
+	claims := map[string]interface{}{"sub": "alice", "role": "admin"}
+
+	// Tokens of each algorithm are verified and the claims are placed in the context
+	for _, token := range []string{
+		signJWT(t, HS256, "hs", secret, claims),
+		signJWT(t, RS256, "rs", rsaKey, claims),
+		signJWT(t, ES256, "es", ecKey, claims),
+	} {
+		w := serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alice/admin/jwt", w.Body.String())
+	}
+
+	// Wrong keys, unknown key IDs and mismatched algorithms are rejected
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	for _, token := range []string{
+		signJWT(t, HS256, "hs", []byte("wrong"), claims),
+		signJWT(t, ES256, "es", otherKey, claims),
+		signJWT(t, HS256, "unknown", secret, claims),
+		signJWT(t, HS256, "rs", rsaModulus(rsaKey), claims),
+		signJWT(t, "none", "hs", secret, claims),
+		"not.a.token",
+		"garbage",
+	} {
+		w := serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token)
+		assertErrorBody(t, w, http.StatusUnauthorized, "invalid token")
+		assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	}
+
+	// Requests without a token receive the challenge
+	w := serve(handler, http.MethodGet, "/")
+	assertErrorBody(t, w, http.StatusUnauthorized, "unauthorized")
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	// Only the configured algorithms are accepted
+	handler = Chain(claimsHandler(), JWTAuth(keys, WithJWTAlgorithms(RS256)))
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, HS256, "hs", secret, claims)), http.StatusUnauthorized, "invalid token")
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, RS256, "rs", rsaKey, claims)).Code)
+}
+
+// rsaModulus returns the modulus of the RSA key, used to forge an HS256 token with public material
+func rsaModulus(key *rsa.PrivateKey) []byte {
+	return key.PublicKey.N.Bytes()
+}
+
+func TestJWTAuth_Claims(t *testing.T) {
+	secret := []byte("hmac-secret")
+	now := time.Unix(1700000000, 0)
+	handler := Chain(claimsHandler(), JWTAuth(StaticKeys{"": secret},
+		WithIssuer("https://auth.example.com"),
+		WithAudience("orders"),
+		WithLeeway(30*time.Second),
+		func(o *jwtOptions) { o.now = func() time.Time { return now } },
+	))
+	token := func(overrides map[string]interface{}) string {
+		claims := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://auth.example.com",
+			"aud": []string{"billing", "orders"},
+			"exp": now.Add(time.Minute).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return signJWT(t, HS256, "", secret, claims)
+	}
+
+	// Valid claims are accepted, including a single string audience and tokens without exp and nbf
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(nil)).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"aud": "orders"})).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"exp": nil, "nbf": nil})).Code)
+
+	// The leeway tolerates small clock skews
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()})).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"nbf": now.Add(10 * time.Second).Unix()})).Code)
+
+	// Invalid claims are rejected with the reason
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})), http.StatusUnauthorized, "token is expired")
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})), http.StatusUnauthorized, "token is not valid yet")
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"iss": "https://evil.example.com"})), http.StatusUnauthorized, "invalid token issuer")
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"aud": "billing"})), http.StatusUnauthorized, "invalid token audience")
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+token(map[string]interface{}{"exp": "tomorrow"})), http.StatusUnauthorized, "invalid token")
+}
+
+// writeJWKS writes the JWKS document with the keys to the path
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// rsaJWK returns the JWK of the RSA public key
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestJWKSFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	secret := []byte("hmac-secret")
+
+	// Load the RSA, EC and oct keys, skipping the encryption keys
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path,
+		rsaJWK("rs-1", &rsaKey.PublicKey),
+		map[string]string{
+			"kty": "EC", "kid": "es-1", "crv": "P-256",
+			"x": base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		map[string]string{"kty": "oct", "kid": "hs-1", "k": base64.RawURLEncoding.EncodeToString(secret)},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"},
+	)
+	jwks, err := NewJWKSFile(path, 10*time.Millisecond)
+	assert.NoError(t, err)
+	handler := Chain(claimsHandler(), JWTAuth(jwks))
+	claims := map[string]interface{}{"sub": "alice"}
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, RS256, "rs-1", rsaKey, claims)).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, ES256, "es-1", ecKey, claims)).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, HS256, "hs-1", secret, claims)).Code)
+	_, ok := jwks.Key("enc")
+	assert.False(t, ok)
+
+	// Rotate the RSA key in the file, the change is picked up after the refresh interval
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	writeJWKS(t, path, rsaJWK("rs-2", &newKey.PublicKey))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	assert.Eventually(t, func() bool {
+		return serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, RS256, "rs-2", newKey, claims)).Code == http.StatusOK
+	}, time.Second, 20*time.Millisecond)
+	assertErrorBody(t, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, RS256, "rs-1", rsaKey, claims)), http.StatusUnauthorized, "invalid token")
+
+	// A broken file keeps the previous keys
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	assert.Error(t, jwks.Reload())
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, RS256, "rs-2", newKey, claims)).Code)
+
+	// Loading fails when the file is missing or invalid
+	_, err = NewJWKSFile(filepath.Join(t.TempDir(), "missing.json"), 0)
+	assert.Error(t, err)
+	_, err = NewJWKSFile(path, 0)
+	assert.ErrorContains(t, err, "invalid JWKS file")
+}
+
+func TestJWKSFile_WeakRSAKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	// Moduli shorter than 2048 bits are rejected
+	shortKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	writeJWKS(t, path, rsaJWK("short", &shortKey.PublicKey))
+	_, err = NewJWKSFile(path, 0)
+	assert.ErrorContains(t, err, "RSA key of 1024 bits is shorter than 2048 bits")
+
+	// Public exponents below 3 are rejected
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	weak := rsaKey.PublicKey
+	weak.E = 1
+	writeJWKS(t, path, rsaJWK("weak", &weak))
+	_, err = NewJWKSFile(path, 0)
+	assert.ErrorContains(t, err, "RSA public exponent 1 is too small")
+}
+
+func TestJWKSFile_MixedKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	shortKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	// Unsupported and weak keys are skipped and logged, the usable keys are loaded
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path,
+		map[string]string{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		map[string]string{"kty": "EC", "kid": "es-384", "crv": "P-384"},
+		rsaJWK("short", &shortKey.PublicKey),
+		rsaJWK("rs-1", &rsaKey.PublicKey),
+	)
+	logger := &recordLogger{}
+	jwks, err := NewJWKSFile(path, 0, WithJWKSLogger(logger))
+	assert.NoError(t, err)
+	handler := Chain(claimsHandler(), JWTAuth(jwks))
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/", "Authorization", "Bearer "+signJWT(t, RS256, "rs-1", rsaKey, map[string]interface{}{"sub": "alice"})).Code)
+	for _, kid := range []string{"ed-1", "es-384", "short"} {
+		_, ok := jwks.Key(kid)
+		assert.False(t, ok, kid)
+	}
+	assert.Len(t, logger.messages, 3)
+	assert.Contains(t, logger.messages[0], `kid=ed-1 error="unsupported key type \"OKP\""`)
+	assert.Contains(t, logger.messages[1], `kid=es-384 error="unsupported curve \"P-384\""`)
+	assert.Contains(t, logger.messages[2], "kid=short")
+
+	// A reload without usable keys fails and keeps the previous keys
+	writeJWKS(t, path, map[string]string{"kty": "OKP", "kid": "ed-2", "crv": "Ed25519"})
+	assert.ErrorContains(t, jwks.Reload(), `no usable key, key "ed-2": unsupported key type "OKP"`)
+	_, ok := jwks.Key("rs-1")
+	assert.True(t, ok)
+}
+
+func TestJWKSFile_Concurrent(t *testing.T) {
+	// Keys are looked up while the file changes and is reloaded
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	secret := func(i int) map[string]string {
+		return map[string]string{"kty": "oct", "kid": "hs", "k": base64.RawURLEncoding.EncodeToString([]byte{byte(i)})}
+	}
+	writeJWKS(t, path, secret(0))
+	jwks, err := NewJWKSFile(path, time.Nanosecond)
+	assert.NoError(t, err)
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, ok := jwks.Key("hs")
+				assert.True(t, ok)
+			}
+		}()
+	}
+	for i := 1; i <= 20; i++ {
+		writeJWKS(t, path, secret(i))
+		assert.NoError(t, os.Chtimes(path, time.Now(), time.Unix(int64(1700000000+i), 0)))
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	// The last version of the file is loaded in the end
+	assert.Eventually(t, func() bool {
+		key, _ := jwks.Key("hs")
+		return bytes.Equal(key.([]byte), []byte{20})
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestJWTAuth_Invalid(t *testing.T) {
+	assert.Panics(t, func() { JWTAuth(nil) })
+}
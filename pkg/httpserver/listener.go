@@ -0,0 +1,256 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// unixPrefix 是 Unix 域套接字地址的前缀，例如 unix:/run/app/admin.sock
+	// unixPrefix is the prefix of Unix domain socket addresses, such as unix:/run/app/admin.sock
+	unixPrefix = "unix:"
+
+	// listenFdsStart 是 systemd 或者重启时传递的第一个文件描述符
+	// listenFdsStart is the first file descriptor passed by systemd or on restart
+	listenFdsStart = 3
+
+	// staleSocketDialTimeout 是检查套接字文件是否仍在使用时的连接超时时间
+	// staleSocketDialTimeout is the dial timeout when checking whether a socket file is still in use
+	staleSocketDialTimeout = time.Second
+)
+
+// listenerSpec 描述服务器的一个监听器
+// listenerSpec describes a listener of the server
+type listenerSpec struct {
+	// address 是监听的地址，可以是 TCP 地址或者 unix: 开头的 Unix 域套接字路径
+	// address is the address to listen on, it can be a TCP address or a Unix domain socket path starting with unix:
+	address string
+
+	// mode 是 Unix 域套接字文件的权限，0 表示不修改
+	// mode is the permission of the Unix domain socket file, 0 means it is not changed
+	mode os.FileMode
+
+	// listener 是外部提供的监听器，不为空时直接使用
+	// listener is the externally supplied listener, it is used directly when not nil
+	listener net.Listener
+}
+
+// WithListener 让服务器同时在外部提供的监听器上服务，可以多次使用。服务器接管监听器，并在停止时关闭它
+// WithListener makes the server also serve on an externally supplied listener, it can be used several times. The server takes over the listener and closes it when stopping
+func WithListener(ln net.Listener) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listenerSpec{listener: ln})
+	}
+}
+
+// WithUnixSocket 让服务器同时在 Unix 域套接字上服务，可以多次使用。没有进程监听时上次运行残留的套接字文件会被删除，
+// 套接字文件的权限设置为 mode（0 表示不修改），并在服务器停止时删除
+// WithUnixSocket makes the server also serve on a Unix domain socket, it can be used several times. The socket file left by the last run is removed when no process listens on it,
+// the permission of the socket file is set to mode (0 means it is not changed), and the file is removed when the server stops
+func WithUnixSocket(path string, mode os.FileMode) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listenerSpec{address: unixPrefix + path, mode: mode})
+	}
+}
+
+// WithSystemdListeners 让服务器在 systemd 套接字激活传递的所有文件描述符上服务（LISTEN_PID 和 LISTEN_FDS）。
+// 进程不是由套接字激活启动时，这个选项不起作用
+// WithSystemdListeners makes the server serve on all file descriptors passed by systemd socket activation (LISTEN_PID and LISTEN_FDS).
+// The option has no effect when the process is not started by socket activation
+func WithSystemdListeners() Option {
+	return func(o *options) {
+		o.systemd = true
+	}
+}
+
+// validateListeners 检查额外的监听器是否有效
+// validateListeners checks whether the extra listeners are valid
+func validateListeners(specs []listenerSpec) error {
+	for _, spec := range specs {
+		switch {
+		case spec.address == "" && spec.listener == nil:
+			return fmt.Errorf("%w: listener is nil", ErrInvalidOption)
+		case spec.address == unixPrefix:
+			return fmt.Errorf("%w: unix socket path is required", ErrInvalidOption)
+		case spec.mode&^os.ModePerm != 0:
+			return fmt.Errorf("%w: unix socket mode %v is not a permission", ErrInvalidOption, spec.mode)
+		}
+	}
+	return nil
+}
+
+// listen 监听 TCP 地址或者 unix: 开头的 Unix 域套接字路径，mode 是套接字文件的权限，0 表示不修改
+// listen listens on a TCP address or a Unix domain socket path starting with unix:, mode is the permission of the socket file, 0 means it is not changed
+func listen(address string, mode os.FileMode) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return net.Listen("tcp", address)
+	}
+	path := strings.TrimPrefix(address, unixPrefix)
+
+	// 只删除上次运行残留的套接字文件，连接被拒绝说明没有进程在监听。其他类型的文件不会被删除，
+	// 仍然有进程在监听或者无法确认时返回地址已被占用
+	// Only remove the socket file left by the last run, a refused connection means no process is listening. Files of other types are not removed,
+	// address in use is returned when a process is still listening or it cannot be confirmed
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.DialTimeout("unix", path, staleSocketDialTimeout)
+		if err == nil {
+			_ = conn.Close()
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("listen unix %s: %w", path, syscall.EADDRINUSE)
+		}
+		_ = os.Remove(path)
+	}
+
+	// 监听套接字并设置权限，关闭监听器时套接字文件被删除
+	// Listen on the socket and set the permission, the socket file is removed when the listener is closed
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// SystemdListeners 返回 systemd 套接字激活传递给当前进程的监听器，并清除相关的环境变量以免被子进程继承。
+// 进程不是由套接字激活启动时返回空列表
+// SystemdListeners returns the listeners passed to the current process by systemd socket activation, clearing the related environment variables so that child processes do not inherit them.
+// An empty list is returned when the process is not started by socket activation
+func SystemdListeners() ([]net.Listener, error) {
+	// 检查文件描述符是否传递给当前进程
+	// Check whether the file descriptors are passed to the current process
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// 清除环境变量
+	// Clear the environment variables
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	return fileListeners(listenFdsStart, count, names)
+}
+
+// fileListeners 将从 start 开始的 count 个继承的文件描述符转换为监听器，names 是文件的名称
+// fileListeners converts count inherited file descriptors starting from start into listeners, names are the names of the files
+func fileListeners(start, count int, names []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := "fd" + strconv.Itoa(start+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		// net.FileListener 复制文件描述符，原来的文件需要关闭
+		// net.FileListener duplicates the file descriptor, the original file needs to be closed
+		f := os.NewFile(uintptr(start+i), name)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("inherited file descriptor %d (%s) is not a listener: %w", start+i, name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// closeListeners 关闭所有的监听器
+// closeListeners closes all listeners
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+}
+
+// listenAll 打开服务器的所有监听器，任何一个失败时关闭已经打开的监听器，同时返回每个监听器在重启时交给新进程使用的键。
+// 配置了其他监听器时，只有显式设置了地址或端口才监听地址。重启时优先使用从旧进程继承的用途和地址相同的监听器
+// listenAll opens all listeners of the server, the opened listeners are closed if any of them fails, returning the key of each listener used by the new process on restart as well.
+// When other listeners are configured, the address is only listened on if the address or the port is set explicitly. On restart the listeners inherited from the old process with the same purpose and address are preferred
+func (s *TinyHttpServer) listenAll(inherited *inheritance) ([]net.Listener, []string, error) {
+	var listeners []net.Listener
+	var keys []string
+
+	// 失败时关闭已经打开的监听器和所有外部提供的监听器
+	// Close the opened listeners and all externally supplied listeners on failure
+	fail := func(err error) ([]net.Listener, []string, error) {
+		closeListeners(listeners)
+		for _, spec := range s.listenerSpecs {
+			if spec.listener != nil {
+				_ = spec.listener.Close()
+			}
+		}
+		return nil, nil, err
+	}
+
+	// systemd 套接字激活传递的监听器，重启后由继承的监听器代替
+	// Listeners passed by systemd socket activation, they are replaced by the inherited listeners after a restart
+	if s.systemd {
+		listeners, keys = inherited.claimAll(fdSystemd)
+		s.restarted = len(listeners) > 0
+		activated, err := SystemdListeners()
+		if err != nil {
+			return fail(err)
+		}
+		for _, ln := range activated {
+			listeners, keys = append(listeners, ln), append(keys, inheritKey(fdSystemd, ln.Addr().String()))
+		}
+	}
+
+	// 监听地址和端口
+	// Listen on the address and the port
+	if s.listenAddr || (len(listeners) == 0 && len(s.listenerSpecs) == 0) {
+		ln := s.claim(inherited, fdListener, s.httpsvr.Addr)
+		if ln == nil {
+			var err error
+			if ln, err = net.Listen("tcp", s.httpsvr.Addr); err != nil {
+				return fail(err)
+			}
+		}
+		listeners, keys = append(listeners, ln), append(keys, inheritKey(fdListener, s.httpsvr.Addr))
+	}
+
+	// 外部提供的监听器和 Unix 域套接字，继承的监听器代替地址相同的外部提供的监听器
+	// Externally supplied listeners and Unix domain sockets, the inherited listeners replace the externally supplied listeners with the same address
+	for _, spec := range s.listenerSpecs {
+		if spec.listener != nil {
+			address := spec.listener.Addr().String()
+			ln := s.claim(inherited, fdSupplied, address)
+			if ln != nil {
+				_ = spec.listener.Close()
+			} else {
+				ln = spec.listener
+			}
+			listeners, keys = append(listeners, ln), append(keys, inheritKey(fdSupplied, address))
+			continue
+		}
+		ln := s.claim(inherited, fdListener, spec.address)
+		if ln == nil {
+			var err error
+			if ln, err = listen(spec.address, spec.mode); err != nil {
+				return fail(err)
+			}
+		}
+		listeners, keys = append(listeners, ln), append(keys, inheritKey(fdListener, spec.address))
+	}
+
+	return listeners, keys, nil
+}
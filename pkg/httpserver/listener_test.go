@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unixClient returns a client connecting to the Unix domain socket at path
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// getWithClient sends a GET request with the client and returns the body
+func getWithClient(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestTinyHttpServer_MultipleListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix domain sockets are not tested on windows")
+	}
+
+	// Prepare a supplied listener and a socket path
+	supplied, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	// Start a server listening on the address, the supplied listener and the socket
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithListener(supplied), WithUnixSocket(path, 0o660))
+	assert.NoError(t, err)
+	srv.Get("/hello", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("hello")) })
+	assert.Nil(t, srv.Addrs())
+	assert.NoError(t, srv.Start())
+
+	// All listeners serve the same routes
+	addrs := srv.Addrs()
+	assert.Len(t, addrs, 3)
+	assert.Equal(t, srv.Addr(), addrs[0])
+	assert.Equal(t, supplied.Addr(), addrs[1])
+	assert.Equal(t, "unix", addrs[2].Network())
+	_, body := get(t, fmt.Sprintf("http://%s/hello", addrs[0]))
+	assert.Equal(t, "hello", body)
+	_, body = get(t, fmt.Sprintf("http://%s/hello", supplied.Addr()))
+	assert.Equal(t, "hello", body)
+	assert.Equal(t, "hello", getWithClient(t, unixClient(path), "http://unix/hello"))
+
+	// The socket has the requested permission
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+	// All listeners are closed and the socket file is removed after the server stops
+	srv.Stop()
+	_, err = net.Dial("tcp", supplied.Addr().String())
+	assert.Error(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTinyHttpServer_ListenerOnly(t *testing.T) {
+	// Start a server with only a supplied listener
+	supplied, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv, err := NewWithOptions(WithListener(supplied))
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+
+	// The default address is not listened on
+	assert.Len(t, srv.Addrs(), 1)
+	assert.Equal(t, supplied.Addr(), srv.Addr())
+}
+
+func TestTinyHttpServer_ListenerBindError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix domain sockets are not tested on windows")
+	}
+
+	// A regular file occupies the socket path and is not removed
+	path := filepath.Join(t.TempDir(), "http.sock")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+	// The server fails to start and releases the opened and supplied listeners
+	supplied, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithListener(supplied), WithUnixSocket(path, 0))
+	assert.NoError(t, err)
+	assert.Error(t, srv.Start())
+	assert.Nil(t, srv.Addr())
+	_, err = net.Dial("tcp", supplied.Addr().String())
+	assert.Error(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestTinyHttpServer_UnixSocketInUse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix domain sockets are not tested on windows")
+	}
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	// A socket file with a listening process is not removed
+	active, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithUnixSocket(path, 0))
+	assert.NoError(t, err)
+	err = srv.Start()
+	assert.ErrorIs(t, err, syscall.EADDRINUSE)
+	conn, err := net.Dial("unix", path)
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+
+	// A stale socket file refusing connections is replaced
+	active.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.NoError(t, active.Close())
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+	srv, err = NewWithOptions(WithAddress("127.0.0.1:0"), WithUnixSocket(path, 0))
+	assert.NoError(t, err)
+	srv.Get("/hello", textHandler("hello"))
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	assert.Equal(t, "hello", getWithClient(t, unixClient(path), "http://unix/hello"))
+}
+
+func TestSystemdListeners_NotActivated(t *testing.T) {
+	// The file descriptors are passed to another process
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := SystemdListeners()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	// The server listens on the address when no file descriptors are passed
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSystemdListeners())
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	assert.Len(t, srv.Addrs(), 1)
+}
+
+func TestNewWithOptions_InvalidListeners(t *testing.T) {
+	tests := map[string][]Option{
+		"nil listener": {WithListener(nil)},
+		"empty socket": {WithUnixSocket("", 0o600)},
+		"socket mode":  {WithUnixSocket("/tmp/http.sock", os.ModeDir|0o600)},
+	}
+	for name, opts := range tests {
+		srv, err := NewWithOptions(opts...)
+		assert.ErrorIs(t, err, ErrInvalidOption, name)
+		assert.Nil(t, srv, name)
+	}
+}
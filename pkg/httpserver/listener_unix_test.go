@@ -0,0 +1,44 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dupFd duplicates the file descriptor of the file as if it is inherited, fileListeners takes over the duplicate
+func dupFd(t *testing.T, f *os.File) int {
+	t.Helper()
+	fd, err := syscall.Dup(int(f.Fd()))
+	assert.NoError(t, err)
+	return fd
+}
+
+func TestFileListeners(t *testing.T) {
+	// Duplicate the file descriptor of a listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	assert.NoError(t, err)
+	defer f.Close()
+
+	// The inherited file descriptor is converted into a listener serving the same address
+	listeners, err := fileListeners(dupFd(t, f), 1, []string{"http"})
+	assert.NoError(t, err)
+	assert.Len(t, listeners, 1)
+	assert.Equal(t, ln.Addr().String(), listeners[0].Addr().String())
+	closeListeners(listeners)
+
+	// A file descriptor which is not a socket is rejected
+	file, err := os.CreateTemp(t.TempDir(), "file")
+	assert.NoError(t, err)
+	defer file.Close()
+	_, err = fileListeners(dupFd(t, file), 1, nil)
+	assert.ErrorContains(t, err, "is not a listener")
+}
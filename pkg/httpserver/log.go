@@ -1,7 +1,10 @@
 package server
 
 import (
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 )
 
 // Logger 是一个接口，定义了一个 Errorf 方法，该方法接受一个格式化字符串和可变参数
@@ -10,6 +13,30 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 }
 
+// LeveledLogger 是支持级别和键值对字段的日志记录器，例如 Info("listening", "addr", addr)。
+// 通过 WithLogger 设置的日志记录器实现了它时，服务器使用带级别的结构化日志
+// LeveledLogger is a logger supporting levels and key-value fields, such as Info("listening", "addr", addr).
+// The server uses leveled structured logs when the logger set by WithLogger implements it
+type LeveledLogger interface {
+	Logger
+
+	// Debug 记录调试日志
+	// Debug records a debug log
+	Debug(msg string, keysAndValues ...interface{})
+
+	// Info 记录信息日志
+	// Info records an info log
+	Info(msg string, keysAndValues ...interface{})
+
+	// Warn 记录警告日志
+	// Warn records a warning log
+	Warn(msg string, keysAndValues ...interface{})
+
+	// Error 记录错误日志
+	// Error records an error log
+	Error(msg string, keysAndValues ...interface{})
+}
+
 // defaultLogger 是 Logger 接口的一个实现
 // defaultLogger is an implementation of the Logger interface
 type defaultLogger struct{}
@@ -19,3 +46,93 @@ type defaultLogger struct{}
 func (l *defaultLogger) Errorf(format string, args ...interface{}) {
 	log.Printf(format, args...)
 }
+
+// Debug 使用 log.Print 打印调试日志
+// Debug uses log.Print to print a debug log
+func (l *defaultLogger) Debug(msg string, keysAndValues ...interface{}) {
+	log.Print(formatLine("DEBUG", msg, keysAndValues))
+}
+
+// Info 使用 log.Print 打印信息日志
+// Info uses log.Print to print an info log
+func (l *defaultLogger) Info(msg string, keysAndValues ...interface{}) {
+	log.Print(formatLine("INFO", msg, keysAndValues))
+}
+
+// Warn 使用 log.Print 打印警告日志
+// Warn uses log.Print to print a warning log
+func (l *defaultLogger) Warn(msg string, keysAndValues ...interface{}) {
+	log.Print(formatLine("WARN", msg, keysAndValues))
+}
+
+// Error 使用 log.Print 打印错误日志
+// Error uses log.Print to print an error log
+func (l *defaultLogger) Error(msg string, keysAndValues ...interface{}) {
+	log.Print(formatLine("ERROR", msg, keysAndValues))
+}
+
+// errorfLogger 将只有 Errorf 的 Logger 适配为 LeveledLogger，警告和错误日志通过 Errorf 记录，调试和信息日志被丢弃
+// errorfLogger adapts a Logger with only Errorf to a LeveledLogger, warning and error logs are recorded with Errorf, debug and info logs are dropped
+type errorfLogger struct {
+	Logger
+}
+
+// Debug 丢弃调试日志
+// Debug drops the debug log
+func (l errorfLogger) Debug(string, ...interface{}) {}
+
+// Info 丢弃信息日志
+// Info drops the info log
+func (l errorfLogger) Info(string, ...interface{}) {}
+
+// Warn 通过 Errorf 记录警告日志
+// Warn records the warning log with Errorf
+func (l errorfLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.Errorf("%s\n", formatLine("WARN", msg, keysAndValues))
+}
+
+// Error 通过 Errorf 记录错误日志
+// Error records the error log with Errorf
+func (l errorfLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.Errorf("%s\n", formatLine("ERROR", msg, keysAndValues))
+}
+
+// leveled 返回支持级别的日志记录器，logger 为空时使用默认的日志记录器
+// leveled returns the logger supporting levels, the default logger is used when logger is nil
+func leveled(logger Logger) LeveledLogger {
+	switch l := logger.(type) {
+	case nil:
+		return &defaultLogger{}
+	case LeveledLogger:
+		return l
+	default:
+		return errorfLogger{Logger: l}
+	}
+}
+
+// formatLine 将级别、消息和键值对格式化为 logfmt 风格的一行，例如 level=INFO msg="server started" addr=:8080
+// formatLine formats the level, message and key-value pairs into a logfmt style line, such as level=INFO msg="server started" addr=:8080
+func formatLine(level, msg string, keysAndValues []interface{}) string {
+	b := strings.Builder{}
+	b.WriteString("level=" + level + " msg=" + quoteValue(msg))
+
+	// 没有键的值使用 !BADKEY 作为键，与 log/slog 一致
+	// A value without a key uses !BADKEY as the key, consistent with log/slog
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, value := "!BADKEY", keysAndValues[i]
+		if i+1 < len(keysAndValues) {
+			key, value = fmt.Sprint(keysAndValues[i]), keysAndValues[i+1]
+		}
+		b.WriteString(" " + key + "=" + quoteValue(fmt.Sprint(value)))
+	}
+	return b.String()
+}
+
+// quoteValue 在值为空或包含空白、引号或等号时为其加上引号
+// quoteValue quotes the value when it is empty or contains whitespace, quotes or equal signs
+func quoteValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatLine(t *testing.T) {
+	assert.Equal(t, `level=INFO msg="server started" addr=:8080 tls=true`, formatLine("INFO", "server started", []interface{}{"addr", ":8080", "tls", true}))
+	assert.Equal(t, `level=ERROR msg=failed error="dial tcp: refused" empty="" !BADKEY=dangling`, formatLine("ERROR", "failed", []interface{}{"error", errors.New("dial tcp: refused"), "empty", "", "dangling"}))
+}
+
+func TestLeveled(t *testing.T) {
+	// A nil logger uses the default logger
+	_, ok := leveled(nil).(*defaultLogger)
+	assert.True(t, ok)
+
+	// A leveled logger is used as it is
+	logger := &leveledRecorder{}
+	assert.Same(t, logger, leveled(logger))
+
+	// A logger with only Errorf records warnings and errors, debug and info logs are dropped
+	plain := &recordLogger{}
+	l := leveled(plain)
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn", "k", "v")
+	l.Error("error", "k", 1)
+	assert.Equal(t, []string{"level=WARN msg=warn k=v\n", "level=ERROR msg=error k=1\n"}, plain.messages)
+}
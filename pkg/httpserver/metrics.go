@@ -0,0 +1,340 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultMetricsPath 是指标端点的默认路径
+	// DefaultMetricsPath is the default path of the metrics endpoint
+	DefaultMetricsPath = "/metrics"
+
+	// unmatchedRoute 是未匹配任何路由的请求的路由标签，避免把任意路径作为标签值
+	// unmatchedRoute is the route label of requests matching no route, avoiding arbitrary paths as label values
+	unmatchedRoute = "unmatched"
+
+	// otherMethod 是非标准方法的方法标签
+	// otherMethod is the method label of non-standard methods
+	otherMethod = "OTHER"
+
+	// metricsContentType 是 Prometheus 文本格式的内容类型
+	// metricsContentType is the content type of the Prometheus text format
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// durationBuckets 是请求耗时直方图的桶上界（秒），与 Prometheus 客户端的默认值一致
+	// durationBuckets are the upper bounds of the buckets of the request duration histogram in seconds, consistent with the defaults of the Prometheus clients
+	durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// sizeBuckets 是响应大小直方图的桶上界（字节）
+	// sizeBuckets are the upper bounds of the buckets of the response size histogram in bytes
+	sizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7, 1e8}
+
+	// standardMethods 是作为方法标签的标准方法
+	// standardMethods are the standard methods used as method labels
+	standardMethods = map[string]bool{
+		http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+		http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+	}
+)
+
+// WithMetrics 开启请求指标，并在 path 以 Prometheus 文本格式暴露它们，path 为空时使用 /metrics。
+// 指标包括按方法、路由和状态码统计的请求数，按方法和路由统计的耗时和响应大小直方图，按原因统计的被负载保护拒绝的请求数，以及正在处理的请求数
+// WithMetrics enables the request metrics and exposes them at path in the Prometheus text format, /metrics is used when path is empty.
+// The metrics include the request counts per method, route and status code, the duration and response size histograms per method and route, the requests rejected by load protection per reason, and the requests in flight
+func WithMetrics(path string) Option {
+	return func(o *options) {
+		if path == "" {
+			path = DefaultMetricsPath
+		}
+		o.metricsPath = path
+	}
+}
+
+// requestState 是请求处理过程中共享的状态，路由器在匹配路由后填入路由模式
+// requestState is the state shared while handling a request, the router fills in the route pattern after matching a route
+type requestState struct {
+	// route 是匹配的路由模式，为空表示未匹配任何路由
+	// route is the matched route pattern, empty means no route is matched
+	route string
+
+	// rejected 是中间件拒绝请求的原因，为空表示请求没有被拒绝
+	// rejected is the reason a middleware rejected the request, empty means the request is not rejected
+	rejected string
+}
+
+// setMatchedRoute 在请求状态存在时记录匹配的路由模式
+// setMatchedRoute records the matched route pattern when the request state exists
+func setMatchedRoute(r *http.Request, pattern string) {
+	if state, ok := r.Context().Value(requestStateContextKey).(*requestState); ok {
+		state.route = pattern
+	}
+}
+
+// markRejected 在请求状态存在时记录请求被拒绝的原因
+// markRejected records the reason the request is rejected when the request state exists
+func markRejected(r *http.Request, reason string) {
+	if state, ok := r.Context().Value(requestStateContextKey).(*requestState); ok {
+		state.rejected = reason
+	}
+}
+
+// histogram 是一个累积的直方图
+// histogram is a cumulative histogram
+type histogram struct {
+	// counts 是每个桶的计数，最后一个是 +Inf 桶，计数不是累积的
+	// counts are the counts of each bucket, the last one is the +Inf bucket, the counts are not cumulative
+	counts []uint64
+
+	// sum 是所有观测值的和
+	// sum is the sum of all observed values
+	sum float64
+
+	// count 是观测的次数
+	// count is the number of observations
+	count uint64
+}
+
+// observe 记录一个观测值
+// observe records an observed value
+func (h *histogram) observe(buckets []float64, v float64) {
+	i := sort.SearchFloat64s(buckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// seriesKey 是一个时间序列的标签
+// seriesKey is the labels of a time series
+type seriesKey struct {
+	// method 是请求的方法
+	// method is the method of the request
+	method string
+
+	// route 是匹配的路由模式
+	// route is the matched route pattern
+	route string
+
+	// status 是响应的状态码，直方图不使用它
+	// status is the status code of the response, it is not used by histograms
+	status string
+}
+
+// metrics 是服务器的请求指标
+// metrics are the request metrics of the server
+type metrics struct {
+	// inFlight 是正在处理的请求数
+	// inFlight is the number of requests in flight
+	inFlight atomic.Int64
+
+	// mu 保护下面的字段
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// requests 是每个方法、路由和状态码的请求数
+	// requests are the request counts per method, route and status code
+	requests map[seriesKey]uint64
+
+	// durations 是每个方法和路由的耗时直方图
+	// durations are the duration histograms per method and route
+	durations map[seriesKey]*histogram
+
+	// sizes 是每个方法和路由的响应大小直方图
+	// sizes are the response size histograms per method and route
+	sizes map[seriesKey]*histogram
+
+	// rejected 是每个原因被拒绝的请求数
+	// rejected are the counts of rejected requests per reason
+	rejected map[string]uint64
+}
+
+// newMetrics 创建新的请求指标
+// newMetrics creates new request metrics
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  map[seriesKey]uint64{},
+		durations: map[seriesKey]*histogram{},
+		sizes:     map[seriesKey]*histogram{},
+		rejected:  map[string]uint64{},
+	}
+}
+
+// instrument 返回记录请求指标的处理器
+// instrument returns the handler recording the request metrics
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		// 在上下文中放入请求状态，让路由器填入匹配的路由
+		// Put the request state into the context to let the router fill in the matched route
+		start := time.Now()
+		state := &requestState{}
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestStateContextKey, state)))
+
+		m.observe(r.Method, state.route, rec.Status(), time.Since(start), rec.bytes)
+		if state.rejected != "" {
+			m.reject(state.rejected)
+		}
+	})
+}
+
+// observe 记录一个完成的请求
+// observe records a completed request
+func (m *metrics) observe(method, route string, status int, duration time.Duration, size int64) {
+	// 限制标签的取值范围
+	// Limit the range of the label values
+	if !standardMethods[method] {
+		method = otherMethod
+	}
+	if route == "" {
+		route = unmatchedRoute
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[seriesKey{method: method, route: route, status: strconv.Itoa(status)}]++
+	key := seriesKey{method: method, route: route}
+	if m.durations[key] == nil {
+		m.durations[key] = &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+		m.sizes[key] = &histogram{counts: make([]uint64, len(sizeBuckets)+1)}
+	}
+	m.durations[key].observe(durationBuckets, duration.Seconds())
+	m.sizes[key].observe(sizeBuckets, float64(size))
+}
+
+// reject 记录一个被拒绝的请求
+// reject records a rejected request
+func (m *metrics) reject(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected[reason]++
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出指标
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	_ = bw.Flush()
+}
+
+// write 以 Prometheus 文本格式写入所有指标，时间序列按照标签排序
+// write writes all metrics in the Prometheus text format, the time series are sorted by labels
+func (m *metrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 请求数
+	// Request counts
+	writeHeader(w, "http_requests_total", "counter", "Total number of HTTP requests by method, route and status code.")
+	for _, key := range sortedKeys(m.requests) {
+		fmt.Fprintf(w, "http_requests_total{%s} %d\n", key.labels(true), m.requests[key])
+	}
+
+	// 耗时和响应大小直方图
+	// Duration and response size histograms
+	writeHeader(w, "http_request_duration_seconds", "histogram", "Duration of HTTP requests in seconds by method and route.")
+	for _, key := range sortedKeys(m.durations) {
+		writeHistogram(w, "http_request_duration_seconds", key.labels(false), durationBuckets, m.durations[key])
+	}
+	writeHeader(w, "http_response_size_bytes", "histogram", "Size of HTTP response bodies in bytes by method and route.")
+	for _, key := range sortedKeys(m.sizes) {
+		writeHistogram(w, "http_response_size_bytes", key.labels(false), sizeBuckets, m.sizes[key])
+	}
+
+	// 被拒绝的请求数
+	// Rejected request counts
+	writeHeader(w, "http_requests_rejected_total", "counter", "Total number of HTTP requests rejected by load protection by reason.")
+	reasons := make([]string, 0, len(m.rejected))
+	for reason := range m.rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "http_requests_rejected_total{reason=\"%s\"} %d\n", escapeLabel(reason), m.rejected[reason])
+	}
+
+	// 正在处理的请求数
+	// Requests in flight
+	writeHeader(w, "http_requests_in_flight", "gauge", "Number of HTTP requests currently being served.")
+	fmt.Fprintf(w, "http_requests_in_flight %d\n", m.inFlight.Load())
+}
+
+// labels 返回格式化的标签，withStatus 表示是否包含状态码
+// labels returns the formatted labels, withStatus indicates whether the status code is included
+func (k seriesKey) labels(withStatus bool) string {
+	labels := fmt.Sprintf(`method="%s",route="%s"`, escapeLabel(k.method), escapeLabel(k.route))
+	if withStatus {
+		labels += fmt.Sprintf(`,status="%s"`, k.status)
+	}
+	return labels
+}
+
+// sortedKeys 返回排序后的时间序列标签
+// sortedKeys returns the sorted labels of the time series
+func sortedKeys[V any](series map[seriesKey]V) []seriesKey {
+	keys := make([]seriesKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	return keys
+}
+
+// writeHeader 写入指标的 HELP 和 TYPE 行
+// writeHeader writes the HELP and TYPE lines of the metric
+func writeHeader(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistogram 写入直方图的桶、和与计数
+// writeHistogram writes the buckets, the sum and the count of the histogram
+func writeHistogram(w *bufio.Writer, name, labels string, buckets []float64, h *histogram) {
+	cumulative := uint64(0)
+	for i, bound := range buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// formatFloat 以 Prometheus 文本格式格式化浮点数
+// formatFloat formats the float in the Prometheus text format
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelEscaper 转义标签值中的反斜杠、双引号和换行
+// labelEscaper escapes the backslashes, double quotes and newlines in label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel 转义标签值
+// escapeLabel escapes the label value
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTinyHttpServer_Metrics(t *testing.T) {
+	// Start a server with the metrics on a custom path
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithMetrics("/internal/metrics"))
+	assert.NoError(t, err)
+	srv.Get("/users/{id}", textHandler("user"))
+	srv.Post("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	base := fmt.Sprintf("http://%s", srv.Addr())
+
+	// Send requests to a route, an unmatched path and a slow route
+	get(t, base+"/users/1")
+	get(t, base+"/users/2")
+	get(t, base+"/missing/path")
+	resp, err := http.Post(base+"/slow", "text/plain", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// Scrape the metrics
+	resp, err = http.Get(base + "/internal/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	lines := strings.Split(string(body), "\n")
+
+	// Request counts are recorded per route pattern and status, unmatched paths are grouped
+	assert.Contains(t, lines, `http_requests_total{method="GET",route="/users/{id}",status="200"} 2`)
+	assert.Contains(t, lines, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, lines, `http_requests_total{method="POST",route="/slow",status="202"} 1`)
+	assert.Contains(t, lines, `# TYPE http_requests_total counter`)
+
+	// Histograms are cumulative
+	assert.Contains(t, lines, `http_request_duration_seconds_bucket{method="POST",route="/slow",le="0.025"} 0`)
+	assert.Contains(t, lines, `http_request_duration_seconds_bucket{method="POST",route="/slow",le="+Inf"} 1`)
+	assert.Contains(t, lines, `http_request_duration_seconds_count{method="GET",route="/users/{id}"} 2`)
+	assert.Contains(t, lines, `http_response_size_bytes_bucket{method="GET",route="/users/{id}",le="100"} 2`)
+	assert.Contains(t, lines, `http_response_size_bytes_sum{method="GET",route="/users/{id}"} 8`)
+
+	// The scrape itself is in flight
+	assert.Contains(t, lines, `http_requests_in_flight 1`)
+}
+
+func TestMetrics_Labels(t *testing.T) {
+	m := newMetrics()
+	m.observe("BREW", "", http.StatusTeapot, time.Millisecond, 0)
+	m.observe(http.MethodGet, `/a"b`, http.StatusOK, time.Millisecond, 0)
+
+	// Non-standard methods and label values are normalized and escaped
+	rec := serve(m, http.MethodGet, "/metrics")
+	assert.Contains(t, rec.Body.String(), `http_requests_total{method="OTHER",route="unmatched",status="418"} 1`)
+	assert.Contains(t, rec.Body.String(), `http_requests_total{method="GET",route="/a\"b",status="200"} 1`)
+}
+
+func TestNewWithOptions_InvalidMetrics(t *testing.T) {
+	srv, err := NewWithOptions(WithMetrics("metrics"))
+	assert.ErrorIs(t, err, ErrInvalidOption)
+	assert.Nil(t, srv)
+
+	// An empty path uses the default path
+	srv, err = NewWithOptions(WithMetrics(""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(srv, http.MethodGet, DefaultMetricsPath).Code)
+}
@@ -0,0 +1,421 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// RequestIDHeader 是携带请求 ID 的请求头和响应头
+	// RequestIDHeader is the request and response header carrying the request ID
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength 是接受的客户端请求 ID 的最大长度
+	// maxRequestIDLength is the maximum length of the request ID accepted from clients
+	maxRequestIDLength = 128
+)
+
+// Middleware 是包装处理器的中间件，用于实现日志、恢复等横切的功能
+// Middleware is a middleware wrapping a handler, used to implement cross-cutting features such as logging and recovery
+type Middleware func(http.Handler) http.Handler
+
+// Chain 使用中间件包装处理器，第一个中间件在最外层，最先处理请求
+// Chain wraps the handler with the middlewares, the first middleware is the outermost and handles the request first
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Use 添加包装整个服务器的中间件，包括健康检查和未匹配任何路由的请求，第一个中间件在最外层。
+// 中间件可以在服务器启动后添加，对之后的请求立即生效
+// Use adds middlewares wrapping the whole server, including the health check and requests matching no route, the first middleware is the outermost.
+// Middlewares can be added after the server starts, they take effect immediately for subsequent requests
+func (s *TinyHttpServer) Use(middlewares ...Middleware) {
+	s.mwMu.Lock()
+	defer s.mwMu.Unlock()
+
+	// 重新组合中间件并原子地替换处理器
+	// Compose the middlewares again and replace the handler atomically
+	s.middlewares = append(s.middlewares, middlewares...)
+	handler := Chain(s.RouteGroup.router, s.middlewares...)
+
+	// 开启指标时在最外层记录请求指标，覆盖所有中间件的处理
+	// Record the request metrics at the outermost layer when the metrics are enabled, covering the handling of all middlewares
+	if s.metrics != nil {
+		handler = s.metrics.instrument(handler)
+	}
+	s.handler.Store(&handler)
+}
+
+// ServeHTTP 使用中间件和路由处理请求，服务器因此也可以作为 http.Handler 使用，例如在测试中
+// ServeHTTP handles the request with the middlewares and the routes, so the server can also be used as an http.Handler, such as in tests
+func (s *TinyHttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
+
+// Use 添加组的中间件，它们只包装之后在组和子组中注册的路由，第一个中间件在最外层
+// Use adds middlewares of the group, they only wrap the routes registered afterwards in the group and its sub groups, the first middleware is the outermost
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// responseRecorder 记录写入的状态码和字节数，并保留底层 ResponseWriter 的 Flush 和 Hijack 能力
+// responseRecorder records the status code and the number of bytes written, keeping the Flush and Hijack abilities of the underlying ResponseWriter
+type responseRecorder struct {
+	http.ResponseWriter
+
+	// status 是写入的状态码，0 表示还没有写入
+	// status is the status code written, 0 means not written yet
+	status int
+
+	// bytes 是写入的响应体字节数
+	// bytes is the number of bytes of the response body written
+	bytes int64
+}
+
+// newResponseRecorder 创建一个新的响应记录器
+// newResponseRecorder creates a new response recorder
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+// WriteHeader 记录并写入状态码
+// WriteHeader records and writes the status code
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write 写入响应体并记录字节数
+// Write writes the response body and records the number of bytes
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Status 返回写入的状态码，没有写入时返回 200
+// Status returns the status code written, 200 is returned if nothing is written
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Flush 刷新底层的 ResponseWriter
+// Flush flushes the underlying ResponseWriter
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 接管底层的连接
+// Hijack takes over the underlying connection
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("server: %T does not support hijacking", r.ResponseWriter)
+}
+
+// Unwrap 返回底层的 ResponseWriter，供 http.ResponseController 使用
+// Unwrap returns the underlying ResponseWriter, used by http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Recovery 返回一个恢复处理器 panic 的中间件，panic 和调用栈通过日志记录器记录，客户端收到 500。
+// http.ErrAbortHandler 会继续向上抛出以中止响应。logger 为空时使用默认的日志记录器
+// Recovery returns a middleware recovering panics of handlers, the panic and the stack are recorded with the logger, the client receives 500.
+// http.ErrAbortHandler is re-panicked to abort the response. The default logger is used when logger is nil
+func Recovery(logger Logger) Middleware {
+	log := leveled(logger)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				// 中止响应的 panic 交给 http.Server 处理
+				// The panic aborting the response is left to http.Server
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				// 记录 panic 并在响应还没有开始时返回 500
+				// Record the panic and return 500 if the response has not started yet
+				log.Error("http handler panic", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+				if rec.status == 0 {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// RequestID 返回一个传递请求 ID 的中间件。请求头 X-Request-ID 有效时沿用它，否则生成一个新的 ID。
+// ID 写入响应头，并可以通过 RequestIDFromContext 从请求上下文中读取
+// RequestID returns a middleware propagating the request ID. The X-Request-ID request header is reused when it is valid, otherwise a new ID is generated.
+// The ID is written to the response header and can be read from the request context with RequestIDFromContext
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id)))
+		})
+	}
+}
+
+// RequestIDFromContext 返回上下文中的请求 ID，没有使用 RequestID 中间件时返回空字符串
+// RequestIDFromContext returns the request ID in the context, an empty string is returned if the RequestID middleware is not used
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// validRequestID 检查客户端提供的请求 ID 是否可以安全地沿用
+// validRequestID checks whether the request ID provided by the client can be reused safely
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID 生成一个新的随机请求 ID
+// newRequestID generates a new random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// BodyLimit 返回一个限制请求体大小的中间件，Content-Length 超过限制时直接返回 413，读取超过限制的请求体时返回错误
+// BodyLimit returns a middleware limiting the size of the request body, 413 is returned directly when Content-Length exceeds the limit, reading a body beyond the limit returns an error
+func BodyLimit(limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout 返回一个限制请求处理时间的中间件，超时后请求上下文被取消，还没有写入响应时客户端收到 503。
+// 处理器在超时后的写入会返回 http.ErrHandlerTimeout，已经开始的流式响应在超时后不再写入。处理器同步运行，中间件等待它返回，
+// 因此处理器应当在上下文取消后尽快返回。写入器支持 http.Flusher 和 http.Hijacker，接管的连接不受超时的限制
+// Timeout returns a middleware limiting the time for handling a request, the request context is cancelled after the timeout and the client receives 503 if no response is written yet.
+// Writes of the handler after the timeout return http.ErrHandlerTimeout, a streaming response already started is not written after the timeout. The handler runs synchronously and the middleware waits for it to return,
+// so the handler should return soon after the context is cancelled. The writer supports http.Flusher and http.Hijacker, hijacked connections are not limited by the timeout
+func Timeout(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			// 计时器在超时后写入 503，处理器返回后写入器结束，之后不会再访问底层的 ResponseWriter
+			// The timer writes 503 after the timeout, the writer finishes after the handler returns and the underlying ResponseWriter is not accessed afterwards
+			tw := &timeoutWriter{w: w, ctx: ctx, header: make(http.Header)}
+			timer := time.AfterFunc(timeout, tw.timeout)
+			defer timer.Stop()
+			defer tw.finish()
+
+			next.ServeHTTP(tw, r.WithContext(ctx))
+		})
+	}
+}
+
+// timeoutWriter 是 Timeout 使用的 ResponseWriter，处理器和超时计时器的写入通过互斥锁串行化
+// timeoutWriter is the ResponseWriter used by Timeout, writes of the handler and the timeout timer are serialized with the mutex
+type timeoutWriter struct {
+	// w 是底层的 ResponseWriter
+	// w is the underlying ResponseWriter
+	w http.ResponseWriter
+
+	// ctx 是带有超时的请求上下文，处理器在计时器之前观察到超时时，写入器也按照超时处理
+	// ctx is the request context with the timeout, the writer also handles the timeout when the handler observes it ahead of the timer
+	ctx context.Context
+
+	// header 是处理器使用的响应头，写入状态码时复制到底层的 ResponseWriter，计时器不会访问它
+	// header is the response header used by the handler, it is copied to the underlying ResponseWriter when the status code is written, the timer never accesses it
+	header http.Header
+
+	// mu 保护下面的状态和对底层 ResponseWriter 的写入
+	// mu protects the states below and the writes to the underlying ResponseWriter
+	mu sync.Mutex
+
+	// wroteHeader 表示已经写入状态码，timedOut 表示已经超时，hijacked 表示连接已经被接管，done 表示处理器已经返回
+	// wroteHeader means the status code is written, timedOut means the timeout is reached, hijacked means the connection is hijacked, done means the handler returned
+	wroteHeader, timedOut, hijacked, done bool
+}
+
+// Header 返回处理器使用的响应头
+// Header returns the response header used by the handler
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader 在超时前写入状态码
+// WriteHeader writes the status code before the timeout
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() || tw.hijacked {
+		return
+	}
+	tw.writeHeader(status)
+}
+
+// writeHeader 复制响应头并写入状态码，调用时需要持有锁
+// writeHeader copies the response header and writes the status code, the lock must be held when called
+func (tw *timeoutWriter) writeHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, vv := range tw.header {
+		dst[k] = vv
+	}
+	tw.w.WriteHeader(status)
+}
+
+// Write 在超时前写入响应体，超时后返回 http.ErrHandlerTimeout
+// Write writes the response body before the timeout, http.ErrHandlerTimeout is returned after the timeout
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// Flush 在超时前刷新底层的 ResponseWriter
+// Flush flushes the underlying ResponseWriter before the timeout
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() || tw.hijacked {
+		return
+	}
+	tw.writeHeader(http.StatusOK)
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 在超时前接管底层的连接，接管后计时器不再写入响应
+// Hijack takes over the underlying connection before the timeout, the timer no longer writes the response after the hijack
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("server: %T does not support hijacking", tw.w)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// timeout 由计时器调用，处理器还没有写入响应时返回 503 并立即刷新给客户端
+// timeout is called by the timer, 503 is returned and flushed to the client immediately if the handler has not written the response yet
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.done {
+		return
+	}
+	tw.expire()
+}
+
+// expired 在上下文超时后完成超时响应，返回是否已经超时，调用时需要持有锁
+// expired completes the timeout response after the context expires and returns whether the timeout is reached, the lock must be held when called
+func (tw *timeoutWriter) expired() bool {
+	if tw.ctx.Err() == context.DeadlineExceeded {
+		tw.expire()
+	}
+	return tw.timedOut
+}
+
+// expire 标记超时并在还没有写入响应时返回 503，调用时需要持有锁
+// expire marks the timeout and returns 503 if the response is not written yet, the lock must be held when called
+func (tw *timeoutWriter) expire() {
+	if tw.timedOut || tw.hijacked {
+		return
+	}
+	tw.timedOut = true
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	http.Error(tw.w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish 在处理器返回后调用，上下文已经超时时先于计时器完成超时响应，否则复制没有写入的响应头，之后计时器不再访问底层的 ResponseWriter
+// finish is called after the handler returns, it completes the timeout response ahead of the timer if the context has expired, otherwise it copies the response header not written yet,
+// the timer no longer accesses the underlying ResponseWriter afterwards
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.done = true
+	tw.expired()
+	if !tw.wroteHeader && !tw.hijacked {
+		dst := tw.w.Header()
+		for k, vv := range tw.header {
+			dst[k] = vv
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordLogger is a Logger recording the messages
+type recordLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+// tag returns a middleware appending the name to the X-Trace response header
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestTinyHttpServer_Use(t *testing.T) {
+	srv := New(0, nil, nil)
+	srv.Get("/a", textHandler("a"))
+
+	// Server middlewares wrap all routes in order, even the ones registered before
+	srv.Use(tag("outer"), tag("inner"))
+	rec := serve(srv, http.MethodGet, "/a")
+	assert.Equal(t, []string{"outer", "inner"}, rec.Header().Values("X-Trace"))
+	rec = serve(srv, http.MethodGet, "/ping")
+	assert.Equal(t, []string{"outer", "inner"}, rec.Header().Values("X-Trace"))
+
+	// Group middlewares only wrap the routes registered afterwards, sub groups inherit them
+	api := srv.Group("/api")
+	api.Get("/before", textHandler("before"))
+	api.Use(tag("api"))
+	api.Get("/after", textHandler("after"))
+	api.Group("/v1").Get("/nested", textHandler("nested"))
+	assert.Equal(t, []string{"outer", "inner"}, serve(srv, http.MethodGet, "/api/before").Header().Values("X-Trace"))
+	assert.Equal(t, []string{"outer", "inner", "api"}, serve(srv, http.MethodGet, "/api/after").Header().Values("X-Trace"))
+	assert.Equal(t, []string{"outer", "inner", "api"}, serve(srv, http.MethodGet, "/api/v1/nested").Header().Values("X-Trace"))
+
+	// Middlewares added later are appended innermost
+	srv.Use(tag("late"))
+	assert.Equal(t, []string{"outer", "inner", "late"}, serve(srv, http.MethodGet, "/a").Header().Values("X-Trace"))
+}
+
+func TestRecovery(t *testing.T) {
+	logger := &recordLogger{}
+	handler := Recovery(logger)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	// The panic is logged and the client receives 500
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	if assert.Len(t, logger.messages, 1) {
+		assert.Contains(t, logger.messages[0], `level=ERROR msg="http handler panic" method=GET path=/panic panic=boom`)
+		assert.Contains(t, logger.messages[0], "goroutine")
+	}
+
+	// http.ErrAbortHandler is re-panicked
+	abort := Recovery(logger)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	// A valid request ID is reused
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", rec.Header().Get(RequestIDHeader))
+
+	// A missing or invalid request ID is replaced
+	for _, id := range []string{"", "bad id", strings.Repeat("x", 200)} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, id)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Len(t, seen, 32)
+		assert.Equal(t, seen, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	handler := BodyLimit(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Bodies within the limit are accepted
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// A declared length beyond the limit is rejected directly
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// An undeclared length beyond the limit fails when read
+	req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("123"), strings.NewReader("45")))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "request body too large")
+}
+
+func TestTimeout(t *testing.T) {
+	handler := Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			_, _ = io.WriteString(w, "late")
+		}
+	}))
+
+	// The client receives 503 after the timeout
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestTimeout_Writer(t *testing.T) {
+	// Headers and flushes are passed through before the timeout
+	handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Stream", "yes")
+		_, _ = io.WriteString(w, "chunk")
+		f, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		f.Flush()
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "yes", rec.Header().Get("X-Stream"))
+	assert.Equal(t, "chunk", rec.Body.String())
+	assert.True(t, rec.Flushed)
+
+	// Headers are kept when the handler writes nothing
+	handler = Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Empty", "yes")
+	}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "yes", rec.Header().Get("X-Empty"))
+
+	// Writes after the timeout fail, the started response is not changed
+	var errs []error
+	handler = Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "started")
+		<-r.Context().Done()
+		_, err := io.WriteString(w, "late")
+		errs = append(errs, err)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "started", rec.Body.String())
+	assert.Equal(t, []error{http.ErrHandlerTimeout}, errs)
+}
+
+func TestTimeout_Metrics(t *testing.T) {
+	// The handler keeps running after the timeout, the metrics are recorded after it returns
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithMetrics(""))
+	assert.NoError(t, err)
+	srv.Use(Timeout(20 * time.Millisecond))
+	srv.Get("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		_, _ = io.WriteString(w, "late")
+	})
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	base := fmt.Sprintf("http://%s", srv.Addr())
+
+	// The client receives 503 and the request is recorded with the route pattern
+	for i := 0; i < 3; i++ {
+		status, body := get(t, base+"/slow/1")
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "Service Unavailable\n", body)
+	}
+	_, metrics := get(t, base+DefaultMetricsPath)
+	assert.Contains(t, strings.Split(metrics, "\n"), `http_requests_total{method="GET",route="/slow/{id}",status="503"} 3`)
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultShutdownTimeout 是默认的关闭宽限期（秒）
+	// defaultShutdownTimeout is the default shutdown grace period in seconds
+	defaultShutdownTimeout = 5
+)
+
+// ErrInvalidOption 表示服务器的选项无效或者相互冲突
+// ErrInvalidOption indicates the options of the server are invalid or conflicting
+var ErrInvalidOption = errors.New("invalid server option")
+
+// Option 是 TinyHttpServer 的配置选项
+// Option is a configuration option of TinyHttpServer
+type Option func(*options)
+
+// options 是 TinyHttpServer 的配置
+// options is the configuration of TinyHttpServer
+type options struct {
+	// address 是服务器监听的地址，可以包含端口
+	// address is the address the server listens on, it may contain the port
+	address string
+
+	// addressSet 表示地址是否通过 WithAddress 设置
+	// addressSet indicates whether the address is set by WithAddress
+	addressSet bool
+
+	// port 是服务器监听的端口
+	// port is the port the server listens on
+	port uint16
+
+	// portSet 表示端口是否通过 WithPort 设置
+	// portSet indicates whether the port is set by WithPort
+	portSet bool
+
+	// readTimeout 是读取整个请求的超时时间
+	// readTimeout is the timeout for reading the entire request
+	readTimeout time.Duration
+
+	// readHeaderTimeout 是读取请求头的超时时间
+	// readHeaderTimeout is the timeout for reading the request header
+	readHeaderTimeout time.Duration
+
+	// writeTimeout 是写入响应的超时时间
+	// writeTimeout is the timeout for writing the response
+	writeTimeout time.Duration
+
+	// idleTimeout 是保持连接的空闲超时时间
+	// idleTimeout is the idle timeout of keep-alive connections
+	idleTimeout time.Duration
+
+	// maxHeaderBytes 是请求头的最大字节数，0 表示使用 http.DefaultMaxHeaderBytes
+	// maxHeaderBytes is the maximum number of bytes of the request header, 0 means http.DefaultMaxHeaderBytes is used
+	maxHeaderBytes int
+
+	// shutdownTimeout 是关闭服务器的宽限期
+	// shutdownTimeout is the grace period for shutting down the server
+	shutdownTimeout time.Duration
+
+	// baseContext 是所有请求上下文的父上下文
+	// baseContext is the parent context of all request contexts
+	baseContext context.Context
+
+	// handler 是处理未匹配任何路由的请求的处理器
+	// handler is the handler for requests matching no route
+	handler http.Handler
+
+	// handlerSet 表示处理器是否通过 WithHandler 设置
+	// handlerSet indicates whether the handler is set by WithHandler
+	handlerSet bool
+
+	// logger 是服务器的日志记录器
+	// logger is the logger of the server
+	logger Logger
+
+	// healthCheck 是健康检查的处理函数
+	// healthCheck is the handler function of the health check
+	healthCheck http.HandlerFunc
+
+	// metricsPath 是指标端点的路径，为空时不开启指标
+	// metricsPath is the path of the metrics endpoint, the metrics are disabled when it is empty
+	metricsPath string
+
+	// healthProbes 表示是否注册存活、就绪和启动探针
+	// healthProbes indicates whether the liveness, readiness and startup probes are registered
+	healthProbes bool
+
+	// signals 是触发优雅关闭的信号，为空时不处理信号
+	// signals are the signals triggering a graceful shutdown, signals are not handled when empty
+	signals []os.Signal
+
+	// drainDelay 是关闭时健康检查开始失败后等待的时间
+	// drainDelay is the time to wait after the health check starts failing on shutdown
+	drainDelay time.Duration
+
+	// hookTimeout 是每个关闭钩子的超时时间
+	// hookTimeout is the timeout of each shutdown hook
+	hookTimeout time.Duration
+
+	// restartSignals 是触发平滑重启的信号，为空时不处理信号
+	// restartSignals are the signals triggering a graceful restart, signals are not handled when empty
+	restartSignals []os.Signal
+
+	// restartTimeout 是重启时等待新进程就绪的超时时间
+	// restartTimeout is the timeout of waiting for the new process to be ready on restart
+	restartTimeout time.Duration
+
+	// restartSettle 是重启时等待刚接受的连接发送第一个请求的最长时间
+	// restartSettle is the longest time of waiting for the connections just accepted to send their first request on restart
+	restartSettle time.Duration
+
+	// listeners 是额外的监听器
+	// listeners are the extra listeners
+	listeners []listenerSpec
+
+	// systemd 表示是否使用 systemd 套接字激活传递的监听器
+	// systemd indicates whether the listeners passed by systemd socket activation are used
+	systemd bool
+
+	// admin 是管理端的配置，为空时不开启管理端
+	// admin is the configuration of the admin endpoint, the admin endpoint is disabled when it is nil
+	admin *adminOptions
+
+	// tls 是 TLS 的配置，为空时使用 HTTP
+	// tls is the configuration of TLS, HTTP is used when it is nil
+	tls *tlsOptions
+}
+
+// newOptions 返回带有默认值的配置
+// newOptions returns the configuration with default values
+func newOptions() *options {
+	return &options{
+		address:           listenAddr,
+		port:              DefaultListenPort,
+		readTimeout:       time.Second * defaultIdleTimeout,
+		readHeaderTimeout: time.Duration(defaultIdleTimeout/2) * time.Second,
+		writeTimeout:      time.Second * defaultIdleTimeout,
+		idleTimeout:       time.Second * defaultIdleTimeout,
+		shutdownTimeout:   time.Second * defaultShutdownTimeout,
+		hookTimeout:       time.Second * defaultHookTimeout,
+		restartTimeout:    time.Second * defaultRestartTimeout,
+		restartSettle:     defaultRestartSettle,
+		baseContext:       context.Background(),
+	}
+}
+
+// WithAddress 设置服务器监听的地址，地址可以包含端口，例如 "127.0.0.1" 或 "127.0.0.1:9090"，包含端口时不能再使用 WithPort
+// WithAddress sets the address the server listens on, the address may contain the port, such as "127.0.0.1" or "127.0.0.1:9090", WithPort cannot be used when the port is included
+func WithAddress(address string) Option {
+	return func(o *options) {
+		o.address = address
+		o.addressSet = true
+	}
+}
+
+// WithPort 设置服务器监听的端口
+// WithPort sets the port the server listens on
+func WithPort(port uint16) Option {
+	return func(o *options) {
+		o.port = port
+		o.portSet = true
+	}
+}
+
+// WithReadTimeout 设置读取整个请求（包括请求体）的超时时间，0 表示不超时
+// WithReadTimeout sets the timeout for reading the entire request, including the body, 0 means no timeout
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = timeout
+	}
+}
+
+// WithReadHeaderTimeout 设置读取请求头的超时时间，0 表示使用读取超时时间
+// WithReadHeaderTimeout sets the timeout for reading the request header, 0 means the read timeout is used
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readHeaderTimeout = timeout
+	}
+}
+
+// WithWriteTimeout 设置写入响应的超时时间，0 表示不超时
+// WithWriteTimeout sets the timeout for writing the response, 0 means no timeout
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = timeout
+	}
+}
+
+// WithIdleTimeout 设置保持连接的空闲超时时间，0 表示使用读取超时时间
+// WithIdleTimeout sets the idle timeout of keep-alive connections, 0 means the read timeout is used
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxHeaderBytes 设置请求头的最大字节数，0 表示使用 http.DefaultMaxHeaderBytes
+// WithMaxHeaderBytes sets the maximum number of bytes of the request header, 0 means http.DefaultMaxHeaderBytes is used
+func WithMaxHeaderBytes(size int) Option {
+	return func(o *options) {
+		o.maxHeaderBytes = size
+	}
+}
+
+// WithShutdownTimeout 设置 Stop 关闭服务器的宽限期
+// WithShutdownTimeout sets the grace period for Stop to shut down the server
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithBaseContext 设置所有请求上下文的父上下文
+// WithBaseContext sets the parent context of all request contexts
+func WithBaseContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.baseContext = ctx
+	}
+}
+
+// WithHandler 设置处理未匹配任何路由的请求的处理器，例如一个已有的 http.ServeMux，健康检查和注册的路由仍然优先
+// WithHandler sets the handler for requests matching no route, such as an existing http.ServeMux, the health check and the registered routes still take precedence
+func WithHandler(handler http.Handler) Option {
+	return func(o *options) {
+		o.handler = handler
+		o.handlerSet = true
+	}
+}
+
+// WithLogger 设置服务器的日志记录器，为空时使用默认的日志记录器
+// WithLogger sets the logger of the server, the default logger is used when it is nil
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithHealthCheck 设置健康检查的处理函数，为空时使用默认的处理函数
+// WithHealthCheck sets the handler function of the health check, the default handler function is used when it is nil
+func WithHealthCheck(hcFunc func(w http.ResponseWriter, r *http.Request)) Option {
+	return func(o *options) {
+		o.healthCheck = hcFunc
+	}
+}
+
+// validate 检查配置是否有效，并返回服务器的监听地址
+// validate checks whether the configuration is valid and returns the listening address of the server
+func (o *options) validate() (string, error) {
+	// 检查地址和端口是否冲突
+	// Check whether the address and the port conflict
+	addr := net.JoinHostPort(o.address, strconv.Itoa(int(o.port)))
+	if host, port, err := net.SplitHostPort(o.address); err == nil {
+		if o.portSet {
+			return "", fmt.Errorf("%w: address %q already contains port %s, WithPort cannot be used", ErrInvalidOption, o.address, port)
+		}
+		addr = net.JoinHostPort(host, port)
+	}
+
+	// 按照固定的顺序检查超时时间是否有效，使多个超时时间无效时报告的错误保持稳定
+	// Check whether the timeouts are valid in a fixed order, so that the reported error is stable when several timeouts are invalid
+	for _, t := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"read timeout", o.readTimeout},
+		{"read header timeout", o.readHeaderTimeout},
+		{"write timeout", o.writeTimeout},
+		{"idle timeout", o.idleTimeout},
+		{"shutdown timeout", o.shutdownTimeout},
+		{"drain delay", o.drainDelay},
+		{"hook timeout", o.hookTimeout},
+		{"restart timeout", o.restartTimeout},
+		{"restart settle", o.restartSettle},
+	} {
+		if t.timeout < 0 {
+			return "", fmt.Errorf("%w: %s %v is negative", ErrInvalidOption, t.name, t.timeout)
+		}
+	}
+	if o.shutdownTimeout == 0 {
+		return "", fmt.Errorf("%w: shutdown timeout must be positive", ErrInvalidOption)
+	}
+	if o.hookTimeout == 0 {
+		return "", fmt.Errorf("%w: hook timeout must be positive", ErrInvalidOption)
+	}
+	if o.restartTimeout == 0 {
+		return "", fmt.Errorf("%w: restart timeout must be positive", ErrInvalidOption)
+	}
+
+	// 读取请求头的时间不能超过读取整个请求的时间
+	// The time for reading the request header cannot exceed the time for reading the entire request
+	if o.readTimeout > 0 && o.readHeaderTimeout > o.readTimeout {
+		return "", fmt.Errorf("%w: read header timeout %v exceeds read timeout %v", ErrInvalidOption, o.readHeaderTimeout, o.readTimeout)
+	}
+
+	// 检查其他选项
+	// Check the other options
+	if o.maxHeaderBytes < 0 {
+		return "", fmt.Errorf("%w: max header bytes %d is negative", ErrInvalidOption, o.maxHeaderBytes)
+	}
+	if o.baseContext == nil {
+		return "", fmt.Errorf("%w: base context is nil", ErrInvalidOption)
+	}
+	if o.handlerSet && o.handler == nil {
+		return "", fmt.Errorf("%w: handler is nil", ErrInvalidOption)
+	}
+	if o.metricsPath != "" && !strings.HasPrefix(o.metricsPath, "/") {
+		return "", fmt.Errorf("%w: metrics path %q must start with /", ErrInvalidOption, o.metricsPath)
+	}
+
+	// 检查额外的监听器
+	// Check the extra listeners
+	if err := validateListeners(o.listeners); err != nil {
+		return "", err
+	}
+
+	// 检查管理端的配置
+	// Check the configuration of the admin endpoint
+	if o.admin != nil {
+		if err := o.admin.validate(addr); err != nil {
+			return "", err
+		}
+	}
+
+	// 检查 TLS 配置
+	// Check the TLS configuration
+	if o.tls != nil {
+		if err := o.tls.validate(); err != nil {
+			return "", err
+		}
+	}
+
+	// 返回监听地址
+	// Return the listening address
+	return addr, nil
+}
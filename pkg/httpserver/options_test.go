@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+func TestNewWithOptions(t *testing.T) {
+	// Create a fallback handler
+	fallback := http.NewServeMux()
+	fallback.HandleFunc("/legacy", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "legacy "+r.Context().Value(ctxKey{}).(string))
+	})
+
+	// Create a server with options
+	srv, err := NewWithOptions(
+		WithAddress("127.0.0.1:0"),
+		WithReadTimeout(10*time.Second),
+		WithReadHeaderTimeout(2*time.Second),
+		WithWriteTimeout(3*time.Second),
+		WithIdleTimeout(4*time.Second),
+		WithMaxHeaderBytes(4096),
+		WithShutdownTimeout(time.Second),
+		WithBaseContext(context.WithValue(context.Background(), ctxKey{}, "ctx")),
+		WithHandler(fallback),
+		WithHealthCheck(textHandler("healthy")),
+	)
+	assert.NoError(t, err)
+
+	// Verify the http server settings
+	assert.Equal(t, "127.0.0.1:0", srv.httpsvr.Addr)
+	assert.Equal(t, 10*time.Second, srv.httpsvr.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.httpsvr.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, srv.httpsvr.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.httpsvr.IdleTimeout)
+	assert.Equal(t, 4096, srv.httpsvr.MaxHeaderBytes)
+	assert.Equal(t, time.Second, srv.shutdownTimeout)
+
+	// Start the server and verify the routes, the health check and the fallback handler
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	srv.Get("/api", textHandler("api"))
+	base := fmt.Sprintf("http://%s", srv.Addr())
+	_, body := get(t, base+"/ping")
+	assert.Equal(t, "healthy", body)
+	_, body = get(t, base+"/api")
+	assert.Equal(t, "api", body)
+	_, body = get(t, base+"/legacy")
+	assert.Equal(t, "legacy ctx", body)
+	code, _ := get(t, base+"/missing")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestNewWithOptions_Defaults(t *testing.T) {
+	// Create a server with default options
+	srv, err := NewWithOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0:8080", srv.httpsvr.Addr)
+	assert.Equal(t, 120*time.Second, srv.httpsvr.ReadTimeout)
+	assert.Equal(t, 60*time.Second, srv.httpsvr.ReadHeaderTimeout)
+	assert.Equal(t, 5*time.Second, srv.shutdownTimeout)
+
+	// Create a server with an IPv6 address and a port
+	srv, err = NewWithOptions(WithAddress("::1"), WithPort(9090))
+	assert.NoError(t, err)
+	assert.Equal(t, "[::1]:9090", srv.httpsvr.Addr)
+}
+
+func TestNewWithOptions_Invalid(t *testing.T) {
+	tests := map[string][]Option{
+		"address and port":      {WithAddress("127.0.0.1:9000"), WithPort(9001)},
+		"negative timeout":      {WithWriteTimeout(-time.Second)},
+		"zero shutdown timeout": {WithShutdownTimeout(0)},
+		"header timeout":        {WithReadTimeout(time.Second), WithReadHeaderTimeout(2 * time.Second)},
+		"max header bytes":      {WithMaxHeaderBytes(-1)},
+		"nil base context":      {WithBaseContext(nil)},
+		"nil handler":           {WithHandler(nil)},
+	}
+	for name, opts := range tests {
+		srv, err := NewWithOptions(opts...)
+		assert.ErrorIs(t, err, ErrInvalidOption, name)
+		assert.Nil(t, srv, name)
+	}
+
+	// The first invalid timeout in declaration order is always reported
+	for i := 0; i < 10; i++ {
+		_, err := NewWithOptions(WithShutdownTimeout(-time.Second), WithReadTimeout(-time.Second), WithWriteTimeout(-time.Second))
+		assert.EqualError(t, err, ErrInvalidOption.Error()+": read timeout -1s is negative")
+	}
+}
@@ -0,0 +1,656 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultProxyDialTimeout 是默认的连接上游的超时时间（秒）
+	// defaultProxyDialTimeout is the default timeout of connecting to upstreams in seconds
+	defaultProxyDialTimeout = 5
+
+	// defaultProxyResponseTimeout 是默认的等待上游响应头的超时时间（秒）
+	// defaultProxyResponseTimeout is the default timeout of waiting for the response headers of upstreams in seconds
+	defaultProxyResponseTimeout = 30
+)
+
+// errNoHealthyUpstream 表示没有可用的健康上游
+// errNoHealthyUpstream indicates there is no healthy upstream available
+var errNoHealthyUpstream = errors.New("no healthy upstream")
+
+// BalanceStrategy 是反向代理选择上游的负载均衡策略
+// BalanceStrategy is the load balancing strategy the reverse proxy uses to choose upstreams
+type BalanceStrategy int
+
+const (
+	// RoundRobin 依次轮流选择健康的上游，是默认的策略
+	// RoundRobin chooses the healthy upstreams in turn, it is the default strategy
+	RoundRobin BalanceStrategy = iota
+
+	// LeastConnections 选择正在处理的请求最少的健康上游，适合请求耗时差异较大的场景
+	// LeastConnections chooses the healthy upstream with the fewest requests in progress, suitable when the request latency varies a lot
+	LeastConnections
+)
+
+// ProxyOption 是反向代理的配置选项
+// ProxyOption is a configuration option of the reverse proxy
+type ProxyOption func(*proxyOptions)
+
+// proxyOptions 是反向代理的配置
+// proxyOptions is the configuration of the reverse proxy
+type proxyOptions struct {
+	// strategy 是负载均衡策略
+	// strategy is the load balancing strategy
+	strategy BalanceStrategy
+
+	// retries 是幂等请求失败后在其他上游上重试的次数
+	// retries is the number of times idempotent requests are retried on other upstreams after failing
+	retries int
+
+	// checkPath 是健康检查的路径，为空表示不开启主动健康检查
+	// checkPath is the path of the health check, empty means the active health check is disabled
+	checkPath string
+
+	// checkInterval 是健康检查的间隔
+	// checkInterval is the interval of the health check
+	checkInterval time.Duration
+
+	// dialTimeout 是连接上游的超时时间
+	// dialTimeout is the timeout of connecting to upstreams
+	dialTimeout time.Duration
+
+	// responseTimeout 是等待上游响应头的超时时间
+	// responseTimeout is the timeout of waiting for the response headers of upstreams
+	responseTimeout time.Duration
+
+	// preserveHost 表示是否把客户端的 Host 发送给上游
+	// preserveHost indicates whether the Host of the client is sent to upstreams
+	preserveHost bool
+
+	// requestHeaders 是发送给上游前改写的请求头
+	// requestHeaders are the request headers rewritten before sending to upstreams
+	requestHeaders []headerRule
+
+	// responseHeaders 是返回给客户端前改写的响应头
+	// responseHeaders are the response headers rewritten before returning to clients
+	responseHeaders []headerRule
+
+	// transport 是转发请求使用的 RoundTripper，为空时根据超时时间创建
+	// transport is the RoundTripper used to forward requests, it is created from the timeouts when nil
+	transport http.RoundTripper
+
+	// logger 是记录转发失败和上游状态变化的日志记录器
+	// logger is the logger recording forwarding failures and upstream state changes
+	logger LeveledLogger
+}
+
+// headerRule 是一条请求头或响应头的改写规则，值为空表示删除该头
+// headerRule is a rewrite rule of a request or response header, an empty value means the header is removed
+type headerRule struct {
+	// name 是头的名称
+	// name is the name of the header
+	name string
+
+	// value 是头的值
+	// value is the value of the header
+	value string
+}
+
+// applyHeaderRules 在头上应用改写规则
+// applyHeaderRules applies the rewrite rules on the header
+func applyHeaderRules(header http.Header, rules []headerRule) {
+	for _, rule := range rules {
+		if rule.value == "" {
+			header.Del(rule.name)
+			continue
+		}
+		header.Set(rule.name, rule.value)
+	}
+}
+
+// WithBalanceStrategy 设置负载均衡策略，默认是 RoundRobin
+// WithBalanceStrategy sets the load balancing strategy, the default is RoundRobin
+func WithBalanceStrategy(strategy BalanceStrategy) ProxyOption {
+	return func(o *proxyOptions) {
+		o.strategy = strategy
+	}
+}
+
+// WithProxyRetries 设置幂等请求在连接失败或超时后在其他上游上重试的次数，默认不重试。
+// 只有没有请求体的 GET、HEAD、OPTIONS、TRACE、PUT 和 DELETE 请求会重试，因为请求体无法重放
+// WithProxyRetries sets the number of times idempotent requests are retried on other upstreams after connection failures or timeouts, there is no retry by default.
+// Only GET, HEAD, OPTIONS, TRACE, PUT and DELETE requests without a body are retried, because the body cannot be replayed
+func WithProxyRetries(retries int) ProxyOption {
+	return func(o *proxyOptions) {
+		if retries > 0 {
+			o.retries = retries
+		}
+	}
+}
+
+// WithUpstreamHealthCheck 开启主动健康检查，每隔 interval 请求每个上游的 path，2xx 和 3xx 响应表示健康。
+// 不健康的上游不再接收请求，直到检查再次通过。开启后连接失败的上游也立即被标记为不健康。默认不开启，所有上游总是被认为是健康的
+// WithUpstreamHealthCheck enables the active health check, the path of each upstream is requested every interval, 2xx and 3xx responses mean healthy.
+// Unhealthy upstreams receive no requests until the check passes again. Once enabled, upstreams failing to connect are marked unhealthy immediately as well. It is disabled by default and all upstreams are always considered healthy
+func WithUpstreamHealthCheck(path string, interval time.Duration) ProxyOption {
+	return func(o *proxyOptions) {
+		if path != "" && interval > 0 {
+			o.checkPath, o.checkInterval = "/"+strings.TrimPrefix(path, "/"), interval
+		}
+	}
+}
+
+// WithProxyDialTimeout 设置连接上游的超时时间，默认是 5 秒
+// WithProxyDialTimeout sets the timeout of connecting to upstreams, the default is 5 seconds
+func WithProxyDialTimeout(timeout time.Duration) ProxyOption {
+	return func(o *proxyOptions) {
+		if timeout > 0 {
+			o.dialTimeout = timeout
+		}
+	}
+}
+
+// WithProxyResponseTimeout 设置发送请求后等待上游响应头的超时时间，默认是 30 秒。超时的请求收到 504，响应体的传输不受限制，因此流式响应可以持续很久
+// WithProxyResponseTimeout sets the timeout of waiting for the response headers of upstreams after sending the request, the default is 30 seconds. Requests timing out receive 504, the transfer of the body is not limited so streaming responses can last long
+func WithProxyResponseTimeout(timeout time.Duration) ProxyOption {
+	return func(o *proxyOptions) {
+		if timeout > 0 {
+			o.responseTimeout = timeout
+		}
+	}
+}
+
+// WithPreserveHost 把客户端请求的 Host 发送给上游，默认发送上游地址中的主机名
+// WithPreserveHost sends the Host of the client request to upstreams, the host in the upstream URL is sent by default
+func WithPreserveHost() ProxyOption {
+	return func(o *proxyOptions) {
+		o.preserveHost = true
+	}
+}
+
+// WithProxyRequestHeader 在请求发送给上游前设置请求头，value 为空时删除该请求头，例如删除客户端的 Authorization 或者加上上游需要的 API 密钥
+// WithProxyRequestHeader sets the request header before the request is sent to upstreams, the header is removed when value is empty, such as to remove the Authorization of clients or to add the API key required by upstreams
+func WithProxyRequestHeader(name, value string) ProxyOption {
+	return func(o *proxyOptions) {
+		o.requestHeaders = append(o.requestHeaders, headerRule{name: name, value: value})
+	}
+}
+
+// WithProxyResponseHeader 在响应返回给客户端前设置响应头，value 为空时删除该响应头，例如删除上游的 Server 响应头
+// WithProxyResponseHeader sets the response header before the response is returned to clients, the header is removed when value is empty, such as to remove the Server header of upstreams
+func WithProxyResponseHeader(name, value string) ProxyOption {
+	return func(o *proxyOptions) {
+		o.responseHeaders = append(o.responseHeaders, headerRule{name: name, value: value})
+	}
+}
+
+// WithProxyTransport 设置转发请求和健康检查使用的 RoundTripper，例如使用自定义 TLS 配置的 http.Transport。设置后连接和响应头的超时选项不再生效
+// WithProxyTransport sets the RoundTripper used to forward requests and for health checks, such as an http.Transport with a custom TLS configuration. The dial and response header timeout options no longer apply once it is set
+func WithProxyTransport(transport http.RoundTripper) ProxyOption {
+	return func(o *proxyOptions) {
+		if transport != nil {
+			o.transport = transport
+		}
+	}
+}
+
+// WithProxyLogger 设置记录转发失败和上游状态变化的日志记录器，默认使用 log.Printf
+// WithProxyLogger sets the logger recording forwarding failures and upstream state changes, log.Printf is used by default
+func WithProxyLogger(logger Logger) ProxyOption {
+	return func(o *proxyOptions) {
+		o.logger = leveled(logger)
+	}
+}
+
+// UpstreamStatus 是一个上游的状态
+// UpstreamStatus is the state of an upstream
+type UpstreamStatus struct {
+	// URL 是上游的地址
+	// URL is the URL of the upstream
+	URL string `json:"url"`
+
+	// Healthy 表示上游是否健康
+	// Healthy indicates whether the upstream is healthy
+	Healthy bool `json:"healthy"`
+
+	// Active 是上游正在处理的请求数
+	// Active is the number of requests the upstream is handling
+	Active int64 `json:"active"`
+}
+
+// upstream 是反向代理的一个上游
+// upstream is an upstream of the reverse proxy
+type upstream struct {
+	// target 是上游的地址
+	// target is the URL of the upstream
+	target *url.URL
+
+	// healthy 表示上游是否健康
+	// healthy indicates whether the upstream is healthy
+	healthy atomic.Bool
+
+	// active 是上游正在处理的请求数，直到响应体关闭才结束
+	// active is the number of requests the upstream is handling, which end when the response body is closed
+	active atomic.Int64
+}
+
+// ReverseProxy 是把请求转发给一组上游的反向代理，实现了 http.Handler，可以挂载在 TinyHttpServer 的路由上。
+// 转发时请求路径保持不变并追加在上游地址的路径之后，挂载在子路径时使用 http.StripPrefix 去掉前缀
+// ReverseProxy is a reverse proxy forwarding requests to a group of upstreams, it implements http.Handler and can be mounted on the routes of TinyHttpServer.
+// The request path is kept and appended to the path of the upstream URL, use http.StripPrefix to remove the prefix when mounted on a sub path
+type ReverseProxy struct {
+	// opts 是反向代理的配置
+	// opts is the configuration of the reverse proxy
+	opts *proxyOptions
+
+	// upstreams 是所有的上游
+	// upstreams are all upstreams
+	upstreams []*upstream
+
+	// next 是轮询的计数器
+	// next is the counter of round robin
+	next atomic.Uint64
+
+	// proxy 是负责转发请求和响应的 httputil.ReverseProxy
+	// proxy is the httputil.ReverseProxy forwarding requests and responses
+	proxy *httputil.ReverseProxy
+
+	// checker 是健康检查使用的客户端
+	// checker is the client used for health checks
+	checker *http.Client
+
+	// stop 在关闭时关闭，停止健康检查
+	// stop is closed on close to stop the health checks
+	stop chan struct{}
+
+	// stopOnce 保证 stop 只关闭一次
+	// stopOnce ensures stop is closed only once
+	stopOnce sync.Once
+
+	// wg 等待健康检查的协程退出
+	// wg waits for the goroutine of health checks to exit
+	wg sync.WaitGroup
+}
+
+// NewReverseProxy 创建一个转发到 targets 的反向代理，每个 target 是 http 或 https 的地址，例如 http://10.0.0.1:8080/api。
+// 开启健康检查时立即开始检查，使用完毕后调用 Close 停止检查，例如在 OnShutdown 钩子中
+// NewReverseProxy creates a reverse proxy forwarding to targets, each target is an http or https URL, such as http://10.0.0.1:8080/api.
+// The health check starts immediately when enabled, call Close to stop it when done, such as in an OnShutdown hook
+func NewReverseProxy(targets []string, opts ...ProxyOption) (*ReverseProxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no upstream")
+	}
+
+	// 应用所有的选项
+	// Apply all options
+	o := &proxyOptions{
+		strategy:        RoundRobin,
+		dialTimeout:     defaultProxyDialTimeout * time.Second,
+		responseTimeout: defaultProxyResponseTimeout * time.Second,
+		logger:          leveled(nil),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{Timeout: o.dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.ResponseHeaderTimeout = o.responseTimeout
+		o.transport = transport
+	}
+
+	// 解析上游的地址，初始时所有上游都是健康的
+	// Parse the URLs of upstreams, all upstreams are healthy initially
+	p := &ReverseProxy{opts: o, stop: make(chan struct{})}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream %q: %w", target, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid upstream %q: scheme must be http or https with a host", target)
+		}
+		up := &upstream{target: u}
+		up.healthy.Store(true)
+		p.upstreams = append(p.upstreams, up)
+	}
+
+	p.proxy = &httputil.ReverseProxy{
+		Director:       p.direct,
+		Transport:      proxyTransport{p: p},
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+	}
+
+	// 开启健康检查
+	// Enable the health check
+	if o.checkPath != "" {
+		timeout := o.checkInterval
+		if timeout > defaultCheckTimeout*time.Second {
+			timeout = defaultCheckTimeout * time.Second
+		}
+		p.checker = &http.Client{
+			Transport: o.transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		p.wg.Add(1)
+		go p.checkLoop()
+	}
+
+	return p, nil
+}
+
+// ServeHTTP 把请求转发给选择的上游。没有健康的上游时返回 503，上游超时返回 504，其他失败返回 502，错误响应体是 httptool.BaseHttpResponse 格式的 JSON
+// ServeHTTP forwards the request to the chosen upstream. 503 is returned when there is no healthy upstream, 504 when the upstream times out and 502 for other failures, the error body is JSON in the format of httptool.BaseHttpResponse
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// Upstreams 返回所有上游的状态，按照创建时的顺序排列
+// Upstreams returns the states of all upstreams, in the order of creation
+func (p *ReverseProxy) Upstreams() []UpstreamStatus {
+	statuses := make([]UpstreamStatus, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		statuses = append(statuses, UpstreamStatus{URL: u.target.String(), Healthy: u.healthy.Load(), Active: u.active.Load()})
+	}
+	return statuses
+}
+
+// Close 停止健康检查并关闭空闲的上游连接，可以多次调用
+// Close stops the health check and closes the idle upstream connections, it can be called multiple times
+func (p *ReverseProxy) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+	if t, ok := p.opts.transport.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+// direct 设置转发的请求头，上游的地址由 proxyTransport 在每次尝试时设置
+// direct sets the headers of the forwarded request, the upstream URL is set by proxyTransport on each attempt
+func (p *ReverseProxy) direct(out *http.Request) {
+	// 覆盖客户端发送的 X-Forwarded-Host 和 X-Forwarded-Proto，X-Forwarded-For 由 httputil.ReverseProxy 追加
+	// Override the X-Forwarded-Host and X-Forwarded-Proto sent by clients, X-Forwarded-For is appended by httputil.ReverseProxy
+	proto := "http"
+	if out.TLS != nil {
+		proto = "https"
+	}
+	out.Header.Set("X-Forwarded-Host", out.Host)
+	out.Header.Set("X-Forwarded-Proto", proto)
+
+	// 把请求 ID 传递给上游，使日志可以关联
+	// Pass the request ID to upstreams so that the logs can be correlated
+	if id := RequestIDFromContext(out.Context()); id != "" {
+		out.Header.Set(RequestIDHeader, id)
+	}
+
+	applyHeaderRules(out.Header, p.opts.requestHeaders)
+}
+
+// modifyResponse 改写上游的响应头
+// modifyResponse rewrites the response headers of upstreams
+func (p *ReverseProxy) modifyResponse(resp *http.Response) error {
+	applyHeaderRules(resp.Header, p.opts.responseHeaders)
+	return nil
+}
+
+// handleError 根据转发的错误返回 502、503 或 504，客户端断开时不记录日志
+// handleError returns 502, 503 or 504 according to the forwarding error, nothing is logged when the client disconnects
+func (p *ReverseProxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusBadGateway, "bad gateway"
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errNoHealthyUpstream):
+		status, message = http.StatusServiceUnavailable, errNoHealthyUpstream.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		status, message = http.StatusGatewayTimeout, "gateway timeout"
+	}
+	if r.Context().Err() == nil {
+		p.opts.logger.Warn("proxy request failed", "method", r.Method, "uri", r.RequestURI, "status", status, "error", err)
+	}
+	writeError(w, status, message)
+}
+
+// pick 选择一个健康且没有尝试过的上游，没有时返回 -1
+// pick chooses a healthy upstream which has not been tried, -1 is returned when there is none
+func (p *ReverseProxy) pick(tried []bool) int {
+	n := uint64(len(p.upstreams))
+	start := p.next.Add(1) - 1
+	best := -1
+	for i := uint64(0); i < n; i++ {
+		idx := int((start + i) % n)
+		u := p.upstreams[idx]
+		if tried[idx] || !u.healthy.Load() {
+			continue
+		}
+		if p.opts.strategy != LeastConnections {
+			return idx
+		}
+		if best < 0 || u.active.Load() < p.upstreams[best].active.Load() {
+			best = idx
+		}
+	}
+	return best
+}
+
+// checkLoop 立即检查所有上游，然后每隔检查间隔检查一次，直到关闭
+// checkLoop checks all upstreams immediately and then every check interval, until closed
+func (p *ReverseProxy) checkLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.opts.checkInterval)
+	defer ticker.Stop()
+	for {
+		p.checkAll()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll 并发检查所有上游并更新它们的状态，状态变化时记录日志
+// checkAll checks all upstreams concurrently and updates their states, the changes are logged
+func (p *ReverseProxy) checkAll() {
+	wg := sync.WaitGroup{}
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+			err := p.check(u)
+			if healthy := err == nil; u.healthy.Swap(healthy) != healthy {
+				if healthy {
+					p.opts.logger.Info("upstream is healthy", "upstream", u.target.String())
+				} else {
+					p.opts.logger.Warn("upstream is unhealthy", "upstream", u.target.String(), "error", err)
+				}
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+// check 请求上游的健康检查路径，2xx 和 3xx 响应表示健康
+// check requests the health check path of the upstream, 2xx and 3xx responses mean healthy
+func (p *ReverseProxy) check(u *upstream) error {
+	target := *u.target
+	target.Path, target.RawPath, target.RawQuery = singleJoiningSlash(u.target.Path, p.opts.checkPath), "", ""
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.checker.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// proxyTransport 为每次尝试选择上游并转发请求，幂等请求失败后在其他上游上重试
+// proxyTransport chooses an upstream for each attempt and forwards the request, idempotent requests are retried on other upstreams after failing
+type proxyTransport struct {
+	// p 是所属的反向代理
+	// p is the reverse proxy it belongs to
+	p *ReverseProxy
+}
+
+// RoundTrip 转发请求，所有尝试都失败时返回最后一次的错误
+// RoundTrip forwards the request, the error of the last attempt is returned when all attempts fail
+func (t proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := t.p
+	attempts := 1
+	if retryable(req) {
+		attempts += p.opts.retries
+	}
+
+	err := errNoHealthyUpstream
+	tried := make([]bool, len(p.upstreams))
+	for i := 0; i < attempts; i++ {
+		idx := p.pick(tried)
+		if idx < 0 {
+			break
+		}
+		tried[idx] = true
+
+		var resp *http.Response
+		if resp, err = p.forward(req, p.upstreams[idx]); err == nil {
+			return resp, nil
+		}
+
+		// 客户端断开时不再重试
+		// Do not retry when the client disconnects
+		if req.Context().Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// forward 把请求转发给上游，响应体关闭前上游的请求数保持增加
+// forward forwards the request to the upstream, the request count of the upstream stays increased until the response body is closed
+func (p *ReverseProxy) forward(req *http.Request, u *upstream) (*http.Response, error) {
+	// 把请求路径和查询参数追加在上游的地址之后
+	// Append the request path and query to the upstream URL
+	out := req.Clone(req.Context())
+	out.URL.Scheme, out.URL.Host = u.target.Scheme, u.target.Host
+	out.URL.Path = singleJoiningSlash(u.target.Path, req.URL.Path)
+	if req.URL.RawPath != "" {
+		out.URL.RawPath = singleJoiningSlash(u.target.EscapedPath(), req.URL.RawPath)
+	}
+	if u.target.RawQuery != "" {
+		out.URL.RawQuery = strings.Trim(u.target.RawQuery+"&"+req.URL.RawQuery, "&")
+	}
+	if !p.opts.preserveHost {
+		out.Host = ""
+	}
+
+	u.active.Add(1)
+	resp, err := p.opts.transport.RoundTrip(out)
+	if err != nil {
+		u.active.Add(-1)
+
+		// 开启健康检查时，连接失败的上游立即被标记为不健康，等待检查恢复
+		// When the health check is enabled, upstreams failing to connect are marked unhealthy immediately and wait for the check to restore them
+		var opErr *net.OpError
+		if p.checker != nil && errors.As(err, &opErr) && opErr.Op == "dial" && u.healthy.Swap(false) {
+			p.opts.logger.Warn("upstream is unhealthy", "upstream", u.target.String(), "error", err)
+		}
+		return nil, err
+	}
+	resp.Body = trackBody(resp.Body, func() { u.active.Add(-1) })
+	return resp, nil
+}
+
+// retryable 检查请求是否可以重试，只有没有请求体的幂等请求可以重试
+// retryable checks whether the request can be retried, only idempotent requests without a body can be retried
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// singleJoiningSlash 用一个 / 连接两段路径
+// singleJoiningSlash joins two paths with a single /
+func singleJoiningSlash(a, b string) string {
+	switch aSlash, bSlash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/"); {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// trackBody 包装响应体，关闭时调用一次 done。协议升级的响应体同时支持写入，包装后保留这一能力
+// trackBody wraps the response body, done is called once on close. The body of protocol upgrades supports writing as well, which is kept after wrapping
+func trackBody(body io.ReadCloser, done func()) io.ReadCloser {
+	b := &trackedBody{ReadCloser: body, done: done}
+	if w, ok := body.(io.Writer); ok {
+		return &trackedReadWriteBody{trackedBody: b, Writer: w}
+	}
+	return b
+}
+
+// trackedBody 是关闭时调用 done 的响应体
+// trackedBody is a response body calling done on close
+type trackedBody struct {
+	io.ReadCloser
+
+	// done 在关闭时调用一次
+	// done is called once on close
+	done func()
+
+	// once 保证 done 只调用一次
+	// once ensures done is called only once
+	once sync.Once
+}
+
+// Close 关闭响应体并调用 done
+// Close closes the response body and calls done
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// trackedReadWriteBody 是支持写入的 trackedBody，用于协议升级
+// trackedReadWriteBody is a trackedBody supporting writing, used for protocol upgrades
+type trackedReadWriteBody struct {
+	*trackedBody
+	io.Writer
+}
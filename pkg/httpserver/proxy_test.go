@@ -0,0 +1,218 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nameUpstream starts an upstream writing its name and the request URI it received
+func nameUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		_, _ = io.WriteString(w, name+" "+r.URL.RequestURI())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// deadUpstream returns the URL of an upstream refusing connections
+func deadUpstream() string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+// newTestProxy creates a reverse proxy closed at the end of the test
+func newTestProxy(t *testing.T, targets []string, opts ...ProxyOption) *ReverseProxy {
+	t.Helper()
+	p, err := NewReverseProxy(targets, append([]ProxyOption{WithProxyLogger(&recordLogger{})}, opts...)...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestReverseProxy_RoundRobin(t *testing.T) {
+	a, b := nameUpstream(t, "a"), nameUpstream(t, "b")
+	p := newTestProxy(t, []string{a.URL + "/base", b.URL + "/base"})
+
+	// Requests alternate between the upstreams, the path and query are appended to the upstream path
+	var bodies []string
+	for i := 0; i < 4; i++ {
+		w := serve(p, http.MethodGet, "/orders/42?page=2")
+		assert.Equal(t, http.StatusOK, w.Code)
+		bodies = append(bodies, w.Body.String())
+	}
+	assert.Equal(t, []string{"a /base/orders/42?page=2", "b /base/orders/42?page=2", "a /base/orders/42?page=2", "b /base/orders/42?page=2"}, bodies)
+
+	// Every upstream is healthy and idle
+	for _, status := range p.Upstreams() {
+		assert.True(t, status.Healthy)
+		assert.Zero(t, status.Active)
+	}
+}
+
+func TestReverseProxy_Headers(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("X-Upstream", "yes")
+	}))
+	defer upstream.Close()
+	handler := Chain(newTestProxy(t, []string{upstream.URL},
+		WithProxyRequestHeader("X-Api-Key", "secret"),
+		WithProxyRequestHeader("Authorization", ""),
+		WithProxyResponseHeader("Server", ""),
+		WithProxyResponseHeader("X-Proxy", "tiny"),
+	), RequestID())
+
+	// Request headers are rewritten and the forwarding headers are set
+	w := serve(handler, http.MethodGet, "http://app.example.com/", "Authorization", "Bearer client", "X-Forwarded-Host", "spoofed")
+	got := <-received
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), got.Host)
+	assert.Equal(t, "secret", got.Header.Get("X-Api-Key"))
+	assert.Empty(t, got.Header.Get("Authorization"))
+	assert.Equal(t, "app.example.com", got.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", got.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "192.0.2.1", got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, w.Header().Get(RequestIDHeader), got.Header.Get(RequestIDHeader))
+
+	// Response headers are rewritten
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Equal(t, "tiny", w.Header().Get("X-Proxy"))
+	assert.Equal(t, "yes", w.Header().Get("X-Upstream"))
+
+	// The client host is kept when preserved
+	handler = newTestProxy(t, []string{upstream.URL}, WithPreserveHost())
+	serve(handler, http.MethodGet, "http://app.example.com/")
+	assert.Equal(t, "app.example.com", (<-received).Host)
+}
+
+func TestReverseProxy_LeastConnections(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := nameUpstream(t, "fast")
+	p := newTestProxy(t, []string{slow.URL, fast.URL}, WithBalanceStrategy(LeastConnections))
+
+	// The first request occupies the slow upstream
+	done := make(chan string, 1)
+	go func() {
+		done <- serve(p, http.MethodGet, "/").Body.String()
+	}()
+	assert.Eventually(t, func() bool {
+		return p.Upstreams()[0].Active == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// The following requests go to the idle upstream
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "fast /", serve(p, http.MethodGet, "/").Body.String())
+	}
+
+	// The count drops after the slow response is done
+	release <- struct{}{}
+	assert.Equal(t, "slow", <-done)
+	assert.Zero(t, p.Upstreams()[0].Active)
+}
+
+func TestReverseProxy_Retries(t *testing.T) {
+	alive := nameUpstream(t, "alive")
+	targets := []string{deadUpstream(), alive.URL}
+
+	// Without retries, requests to the dead upstream fail with 502
+	p := newTestProxy(t, targets)
+	assertErrorBody(t, serve(p, http.MethodGet, "/"), http.StatusBadGateway, "bad gateway")
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodGet, "/").Code)
+
+	// Idempotent requests are retried on the other upstream
+	p = newTestProxy(t, targets, WithProxyRetries(1))
+	for i := 0; i < 4; i++ {
+		w := serve(p, http.MethodGet, "/")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alive /", w.Body.String())
+	}
+
+	// Requests with a body and non-idempotent requests are not retried, each proxy starts with the dead upstream
+	w := httptest.NewRecorder()
+	newTestProxy(t, targets, WithProxyRetries(1)).ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("data")))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, http.StatusBadGateway, serve(newTestProxy(t, targets, WithProxyRetries(1)), http.MethodPost, "/").Code)
+}
+
+func TestReverseProxy_HealthCheck(t *testing.T) {
+	healthy := atomic.Bool{}
+	healthy.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "flaky")
+	}))
+	defer flaky.Close()
+	stable := nameUpstream(t, "stable")
+	p := newTestProxy(t, []string{flaky.URL, stable.URL}, WithUpstreamHealthCheck("healthz", 10*time.Millisecond))
+
+	// An unhealthy upstream receives no requests
+	healthy.Store(false)
+	assert.Eventually(t, func() bool {
+		return !p.Upstreams()[0].Healthy
+	}, time.Second, 5*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "stable /", serve(p, http.MethodGet, "/").Body.String())
+	}
+
+	// The upstream receives requests again after it recovers
+	healthy.Store(true)
+	assert.Eventually(t, func() bool {
+		return p.Upstreams()[0].Healthy
+	}, time.Second, 5*time.Millisecond)
+	bodies := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		bodies[serve(p, http.MethodGet, "/").Body.String()] = true
+	}
+	assert.Equal(t, map[string]bool{"flaky": true, "stable /": true}, bodies)
+
+	// Upstreams failing to connect are marked unhealthy right away, 503 is returned without healthy upstreams
+	p = newTestProxy(t, []string{deadUpstream()}, WithUpstreamHealthCheck("/healthz", time.Hour))
+	assertErrorBody(t, serve(p, http.MethodGet, "/"), http.StatusBadGateway, "bad gateway")
+	assert.False(t, p.Upstreams()[0].Healthy)
+	assertErrorBody(t, serve(p, http.MethodGet, "/"), http.StatusServiceUnavailable, "no healthy upstream")
+}
+
+func TestReverseProxy_Timeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	// Upstreams not answering in time receive 504
+	p := newTestProxy(t, []string{upstream.URL}, WithProxyResponseTimeout(50*time.Millisecond))
+	start := time.Now()
+	assertErrorBody(t, serve(p, http.MethodGet, "/"), http.StatusGatewayTimeout, "gateway timeout")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestNewReverseProxy_Invalid(t *testing.T) {
+	for _, targets := range [][]string{nil, {"ftp://example.com"}, {"localhost:8080"}, {"http://"}, {"http://%zz"}} {
+		_, err := NewReverseProxy(targets)
+		assert.Error(t, err, targets)
+	}
+}
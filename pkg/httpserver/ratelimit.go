@@ -0,0 +1,417 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm 是限流使用的算法
+// RateLimitAlgorithm is the algorithm used for rate limiting
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket 是令牌桶算法，令牌以 limit/window 的速率补充，桶满时允许突发的请求，是默认的算法
+	// TokenBucket is the token bucket algorithm, tokens are refilled at the rate of limit/window, bursts are allowed when the bucket is full, it is the default algorithm
+	TokenBucket RateLimitAlgorithm = iota
+
+	// SlidingWindow 是滑动窗口算法，按照上一个窗口的请求数加权估计最近一个窗口内的请求数，不允许窗口边界处的突发
+	// SlidingWindow is the sliding window algorithm, the number of requests in the last window is estimated by weighting the requests of the previous window, bursts at window boundaries are not allowed
+	SlidingWindow
+)
+
+// KeyFunc 返回请求所属的限流键，相同键的请求共享配额。返回空字符串表示请求不受限制
+// KeyFunc returns the rate limit key the request belongs to, requests with the same key share the quota. An empty string means the request is not limited
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP 返回按照客户端 IP 限流的键函数。IP 取自连接的远程地址，不信任 X-Forwarded-For 等可以伪造的请求头，
+// 在反向代理之后时请使用 KeyByHeader 读取代理设置的请求头
+// KeyByIP returns the key function limiting by client IP. The IP is taken from the remote address of the connection, headers which can be forged such as X-Forwarded-For are not trusted,
+// use KeyByHeader to read the header set by the proxy when behind a reverse proxy
+func KeyByIP() KeyFunc {
+	return func(r *http.Request) string {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			return host
+		}
+		return r.RemoteAddr
+	}
+}
+
+// KeyByHeader 返回按照请求头的值限流的键函数，例如 API 密钥，没有该请求头的请求不受限制
+// KeyByHeader returns the key function limiting by the value of the request header, such as an API key, requests without the header are not limited
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimitOption 是限流中间件的配置选项
+// RateLimitOption is a configuration option of the rate limit middleware
+type RateLimitOption func(*rateLimitOptions)
+
+// rateLimitOptions 是限流中间件的配置
+// rateLimitOptions is the configuration of the rate limit middleware
+type rateLimitOptions struct {
+	// algorithm 是限流使用的算法
+	// algorithm is the algorithm used for rate limiting
+	algorithm RateLimitAlgorithm
+
+	// key 是限流的键函数
+	// key is the key function of rate limiting
+	key KeyFunc
+
+	// burst 是令牌桶的容量
+	// burst is the capacity of the token bucket
+	burst int
+
+	// now 返回当前时间，用于测试
+	// now returns the current time, used for tests
+	now func() time.Time
+}
+
+// WithRateLimitAlgorithm 设置限流使用的算法，默认是 TokenBucket
+// WithRateLimitAlgorithm sets the algorithm used for rate limiting, the default is TokenBucket
+func WithRateLimitAlgorithm(algorithm RateLimitAlgorithm) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.algorithm = algorithm
+	}
+}
+
+// WithRateLimitKey 设置限流的键函数，默认是 KeyByIP
+// WithRateLimitKey sets the key function of rate limiting, the default is KeyByIP
+func WithRateLimitKey(key KeyFunc) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		if key != nil {
+			o.key = key
+		}
+	}
+}
+
+// WithBurst 设置令牌桶的容量，即允许的最大突发请求数，默认等于 limit，只对 TokenBucket 有效
+// WithBurst sets the capacity of the token bucket, which is the maximum number of requests allowed in a burst, the default equals limit, it only applies to TokenBucket
+func WithBurst(burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		if burst > 0 {
+			o.burst = burst
+		}
+	}
+}
+
+// rateDecision 是一次限流判断的结果
+// rateDecision is the result of a rate limit decision
+type rateDecision struct {
+	// allowed 表示请求是否被允许
+	// allowed indicates whether the request is allowed
+	allowed bool
+
+	// remaining 是剩余的配额
+	// remaining is the remaining quota
+	remaining int
+
+	// reset 是配额完全恢复前的时间
+	// reset is the time until the quota is fully restored
+	reset time.Duration
+
+	// retryAfter 是请求被拒绝时，下一个请求可以被允许前的时间
+	// retryAfter is the time until the next request can be allowed when the request is rejected
+	retryAfter time.Duration
+}
+
+// limiter 是限流算法的实现
+// limiter is the implementation of a rate limit algorithm
+type limiter interface {
+	// take 尝试为键消耗一个配额
+	// take tries to consume a quota for the key
+	take(key string, now time.Time) rateDecision
+}
+
+// RateLimit 返回一个限流中间件，每个键在 window 时间内最多允许 limit 个请求，超过的请求收到 429 和 httptool.BaseHttpResponse 格式的 JSON 响应体。
+// 所有响应都带有 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset 和 RateLimit-Policy 响应头，被拒绝的响应还带有 Retry-After。
+// 每个中间件都有独立的计数，在路由组或单个路由上使用不同的中间件即可实现按路由的限流。limit 或 window 不是正数时会 panic
+// RateLimit returns a rate limit middleware, each key is allowed at most limit requests within window, the requests beyond receive 429 with a JSON body in the format of httptool.BaseHttpResponse.
+// All responses carry the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, rejected responses also carry Retry-After.
+// Each middleware has its own counters, per-route limits are achieved by using different middlewares on route groups or single routes. It panics if limit or window is not positive
+func RateLimit(limit int, window time.Duration, opts ...RateLimitOption) Middleware {
+	if limit <= 0 || window <= 0 {
+		panic(fmt.Sprintf("server: invalid rate limit %d per %v", limit, window))
+	}
+
+	// 应用所有的选项
+	// Apply all options
+	o := &rateLimitOptions{algorithm: TokenBucket, key: KeyByIP(), burst: limit, now: time.Now}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// 创建限流算法的实现
+	// Create the implementation of the rate limit algorithm
+	var l limiter
+	switch o.algorithm {
+	case SlidingWindow:
+		l = newSlidingWindow(limit, window)
+	default:
+		l = newTokenBucket(limit, window, o.burst)
+	}
+	quota := strconv.Itoa(limit)
+	policy := fmt.Sprintf("%d;w=%d", limit, int64(math.Ceil(window.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := o.key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 写入配额的响应头，RateLimit-Limit 是每个窗口的配额，与 RateLimit-Policy 一致，令牌桶的容量不影响它
+			// Write the headers of the quota, RateLimit-Limit is the quota per window consistent with RateLimit-Policy, the capacity of the token bucket does not affect it
+			d := l.take(key, o.now())
+			header := w.Header()
+			header.Set("RateLimit-Limit", quota)
+			header.Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+			header.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(d.reset), 10))
+			header.Set("RateLimit-Policy", policy)
+			if d.allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 拒绝超过配额的请求
+			// Reject the request beyond the quota
+			markRejected(r, RejectRateLimit)
+			header.Set("Retry-After", strconv.FormatInt(ceilSeconds(d.retryAfter), 10))
+			writeError(w, http.StatusTooManyRequests, "too many requests")
+		})
+	}
+}
+
+// ceilSeconds 将时长向上取整为秒
+// ceilSeconds rounds the duration up to seconds
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// bucket 是一个键的令牌桶
+// bucket is the token bucket of a key
+type bucket struct {
+	// tokens 是桶中的令牌数
+	// tokens is the number of tokens in the bucket
+	tokens float64
+
+	// last 是上一次补充令牌的时间
+	// last is the time the tokens were refilled last
+	last time.Time
+}
+
+// tokenBucket 是令牌桶算法的实现
+// tokenBucket is the implementation of the token bucket algorithm
+type tokenBucket struct {
+	// interval 是补充一个令牌的时间
+	// interval is the time to refill a token
+	interval time.Duration
+
+	// burst 是桶的容量
+	// burst is the capacity of the bucket
+	burst int
+
+	// sweeper 清理长时间空闲的键
+	// sweeper cleans up keys idle for a long time
+	sweeper
+
+	// buckets 是每个键的令牌桶
+	// buckets are the token buckets of each key
+	buckets map[string]*bucket
+}
+
+// newTokenBucket 创建令牌桶算法的实现，每个令牌的补充时间是 window/limit
+// newTokenBucket creates the implementation of the token bucket algorithm, each token is refilled in window/limit
+func newTokenBucket(limit int, window time.Duration, burst int) *tokenBucket {
+	interval := window / time.Duration(limit)
+	if interval <= 0 {
+		interval = 1
+	}
+	return &tokenBucket{
+		interval: interval,
+		burst:    burst,
+		sweeper:  sweeper{every: interval * time.Duration(burst)},
+		buckets:  map[string]*bucket{},
+	}
+}
+
+// take 补充令牌并尝试消耗一个令牌
+// take refills the tokens and tries to consume a token
+func (t *tokenBucket) take(key string, now time.Time) rateDecision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 删除已经装满的桶，它们与新建的桶相同
+	// Delete the buckets already full, they are the same as new buckets
+	full := time.Duration(t.burst) * t.interval
+	t.sweep(now, func() {
+		for k, b := range t.buckets {
+			if now.Sub(b.last) >= full {
+				delete(t.buckets, k)
+			}
+		}
+	})
+
+	// 按照经过的时间补充令牌
+	// Refill the tokens according to the elapsed time
+	b := t.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(t.burst), last: now}
+		t.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(t.burst), b.tokens+float64(elapsed)/float64(t.interval))
+		b.last = now
+	}
+
+	// 消耗一个令牌，没有令牌时计算下一个令牌补充的时间
+	// Consume a token, the time to refill the next token is calculated when there is none
+	d := rateDecision{}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.allowed = true
+	} else {
+		d.retryAfter = time.Duration((1 - b.tokens) * float64(t.interval))
+	}
+	d.remaining = int(b.tokens)
+	d.reset = time.Duration((float64(t.burst) - b.tokens) * float64(t.interval))
+	return d
+}
+
+// windowCount 是一个键的滑动窗口计数
+// windowCount is the sliding window counts of a key
+type windowCount struct {
+	// start 是当前窗口的开始时间
+	// start is the start time of the current window
+	start time.Time
+
+	// current 是当前窗口的请求数
+	// current is the number of requests in the current window
+	current int
+
+	// previous 是上一个窗口的请求数
+	// previous is the number of requests in the previous window
+	previous int
+}
+
+// slidingWindow 是滑动窗口算法的实现
+// slidingWindow is the implementation of the sliding window algorithm
+type slidingWindow struct {
+	// limit 是每个窗口允许的请求数
+	// limit is the number of requests allowed per window
+	limit int
+
+	// size 是窗口的大小
+	// size is the size of the window
+	size time.Duration
+
+	// sweeper 清理长时间空闲的键
+	// sweeper cleans up keys idle for a long time
+	sweeper
+
+	// windows 是每个键的窗口计数
+	// windows are the window counts of each key
+	windows map[string]*windowCount
+}
+
+// newSlidingWindow 创建滑动窗口算法的实现
+// newSlidingWindow creates the implementation of the sliding window algorithm
+func newSlidingWindow(limit int, size time.Duration) *slidingWindow {
+	return &slidingWindow{limit: limit, size: size, sweeper: sweeper{every: size}, windows: map[string]*windowCount{}}
+}
+
+// take 估计最近一个窗口内的请求数并尝试计入当前请求
+// take estimates the number of requests in the last window and tries to count the current request
+func (s *slidingWindow) take(key string, now time.Time) rateDecision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 删除两个窗口内没有请求的键
+	// Delete the keys without requests within two windows
+	start := now.Truncate(s.size)
+	s.sweep(now, func() {
+		for k, w := range s.windows {
+			if start.Sub(w.start) > s.size {
+				delete(s.windows, k)
+			}
+		}
+	})
+
+	// 滚动到当前窗口，只有紧邻的上一个窗口的计数被保留
+	// Roll over to the current window, only the counts of the immediately previous window are kept
+	w := s.windows[key]
+	if w == nil {
+		w = &windowCount{start: start}
+		s.windows[key] = w
+	}
+	if !w.start.Equal(start) {
+		w.previous = 0
+		if start.Sub(w.start) == s.size {
+			w.previous = w.current
+		}
+		w.start, w.current = start, 0
+	}
+
+	// 按照上一个窗口与滑动窗口重叠的比例估计请求数
+	// Estimate the number of requests by the proportion of the previous window overlapping the sliding window
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(s.size)
+	estimate := float64(w.previous)*weight + float64(w.current)
+
+	d := rateDecision{reset: s.size - elapsed}
+	if estimate+1 <= float64(s.limit) {
+		w.current++
+		estimate++
+		d.allowed = true
+	} else if w.current+1 > s.limit || w.previous == 0 {
+		// 当前窗口的配额已经用完，等待下一个窗口
+		// The quota of the current window is used up, wait for the next window
+		d.retryAfter = s.size - elapsed
+	} else {
+		// 等待上一个窗口的权重下降到允许一个请求
+		// Wait for the weight of the previous window to drop enough to allow a request
+		target := float64(s.limit-w.current-1) / float64(w.previous)
+		d.retryAfter = time.Duration((1-target)*float64(s.size)) - elapsed
+	}
+	d.remaining = s.limit - int(math.Ceil(estimate))
+	if d.remaining < 0 {
+		d.remaining = 0
+	}
+	return d
+}
+
+// sweeper 定期清理长时间空闲的键，避免内存随客户端数量无限增长
+// sweeper periodically cleans up keys idle for a long time, avoiding the memory growing without bound with the number of clients
+type sweeper struct {
+	// mu 保护限流的状态
+	// mu protects the state of rate limiting
+	mu sync.Mutex
+
+	// every 是两次清理之间的最短时间
+	// every is the minimum time between two cleanups
+	every time.Duration
+
+	// last 是上一次清理的时间
+	// last is the time of the last cleanup
+	last time.Time
+}
+
+// sweep 在距离上一次清理超过间隔时调用 clean，调用者必须持有锁
+// sweep calls clean when the interval has passed since the last cleanup, the caller must hold the lock
+func (s *sweeper) sweep(now time.Time, clean func()) {
+	if now.Sub(s.last) < s.every {
+		return
+	}
+	s.last = now
+	clean()
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedClock returns an option making the middleware read the time from the pointer
+func fixedClock(now *time.Time) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.now = func() time.Time { return *now }
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	// Two tokens per second with a burst of two
+	tb := newTokenBucket(2, time.Second, 2)
+	now := time.Unix(1000, 0)
+
+	// The burst is allowed and the third request is rejected
+	d := tb.take("a", now)
+	assert.True(t, d.allowed)
+	assert.Equal(t, 1, d.remaining)
+	assert.True(t, tb.take("a", now).allowed)
+	d = tb.take("a", now)
+	assert.False(t, d.allowed)
+	assert.Equal(t, 0, d.remaining)
+	assert.Equal(t, 500*time.Millisecond, d.retryAfter)
+	assert.Equal(t, time.Second, d.reset)
+
+	// Other keys have their own buckets
+	assert.True(t, tb.take("b", now).allowed)
+
+	// A token is refilled after half a second
+	assert.True(t, tb.take("a", now.Add(500*time.Millisecond)).allowed)
+	assert.False(t, tb.take("a", now.Add(500*time.Millisecond)).allowed)
+
+	// Full buckets are cleaned up
+	tb.take("c", now.Add(time.Hour))
+	assert.Len(t, tb.buckets, 1)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	// Four requests per ten seconds
+	sw := newSlidingWindow(4, 10*time.Second)
+	start := time.Unix(1000, 0)
+
+	// The quota of the window is used up
+	for i := 0; i < 4; i++ {
+		d := sw.take("a", start.Add(time.Second))
+		assert.True(t, d.allowed)
+		assert.Equal(t, 3-i, d.remaining)
+	}
+	d := sw.take("a", start.Add(time.Second))
+	assert.False(t, d.allowed)
+	assert.Equal(t, 9*time.Second, d.retryAfter)
+	assert.Equal(t, 9*time.Second, d.reset)
+
+	// Halfway through the next window the previous requests weigh half
+	next := start.Add(15 * time.Second)
+	assert.True(t, sw.take("a", next).allowed)
+	d = sw.take("a", next)
+	assert.True(t, d.allowed)
+	assert.Equal(t, 0, d.remaining)
+	d = sw.take("a", next)
+	assert.False(t, d.allowed)
+	assert.Equal(t, 2500*time.Millisecond, d.retryAfter)
+
+	// The counts are forgotten after two windows
+	assert.True(t, sw.take("a", start.Add(35*time.Second)).allowed)
+	assert.Equal(t, 3, sw.take("b", start.Add(35*time.Second)).remaining)
+	assert.Len(t, sw.windows, 2)
+}
+
+func TestRateLimit(t *testing.T) {
+	// Limit two requests per minute per API key
+	now := time.Unix(1000, 0)
+	handler := Chain(textHandler("ok"), RateLimit(2, time.Minute, WithRateLimitKey(KeyByHeader("X-API-Key")), fixedClock(&now)))
+	request := func(key string) *httptest.ResponseRecorder {
+		return serve(handler, http.MethodGet, "/", "X-API-Key", key)
+	}
+
+	// The quota headers are written on allowed requests
+	w := request("alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, http.StatusOK, request("alice").Code)
+
+	// The request beyond the quota is rejected with the JSON body
+	w = request("alice")
+	assertErrorBody(t, w, http.StatusTooManyRequests, "too many requests")
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Other keys and requests without a key are not affected
+	assert.Equal(t, http.StatusOK, request("bob").Code)
+	w = request("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	// The quota is restored over time
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, request("alice").Code)
+}
+
+func TestRateLimit_LimitHeader(t *testing.T) {
+	// The limit header is the quota of the policy for both algorithms, the burst only affects the remaining quota
+	now := time.Unix(1000, 0)
+	tests := map[string]struct {
+		opts      []RateLimitOption
+		remaining string
+	}{
+		"token bucket":   {[]RateLimitOption{WithBurst(20)}, "19"},
+		"sliding window": {[]RateLimitOption{WithRateLimitAlgorithm(SlidingWindow), WithBurst(20)}, "9"},
+	}
+	for name, tt := range tests {
+		handler := Chain(textHandler("ok"), RateLimit(10, time.Minute, append(tt.opts, fixedClock(&now))...))
+		w := serve(handler, http.MethodGet, "/")
+		assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"), name)
+		assert.Equal(t, "10;w=60", w.Header().Get("RateLimit-Policy"), name)
+		assert.Equal(t, tt.remaining, w.Header().Get("RateLimit-Remaining"), name)
+	}
+}
+
+func TestRateLimit_PerRoute(t *testing.T) {
+	// Only the login route is limited, by client IP
+	srv, err := NewWithOptions()
+	assert.NoError(t, err)
+	srv.Get("/public", textHandler("public"))
+	auth := srv.Group("/auth")
+	auth.Use(RateLimit(1, time.Minute, WithRateLimitAlgorithm(SlidingWindow)))
+	auth.Post("/login", textHandler("login"))
+
+	// The limited route rejects the second request of the same client
+	assert.Equal(t, http.StatusOK, serve(srv, http.MethodPost, "/auth/login").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(srv, http.MethodPost, "/auth/login").Code)
+
+	// The other routes are not limited
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(srv, http.MethodGet, "/public").Code)
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:4321"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Equal(t, "192.0.2.1", KeyByIP()(r))
+	r.RemoteAddr = "@"
+	assert.Equal(t, "@", KeyByIP()(r))
+}
+
+func TestRateLimit_Invalid(t *testing.T) {
+	assert.Panics(t, func() { RateLimit(0, time.Second) })
+	assert.Panics(t, func() { RateLimit(1, 0) })
+}
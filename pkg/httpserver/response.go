@@ -0,0 +1,17 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shengyanli1982/toolkit/pkg/httptool"
+)
+
+// writeError 写入 httptool.BaseHttpResponse 格式的 JSON 错误响应，错误码等于状态码
+// writeError writes a JSON error response in the format of httptool.BaseHttpResponse, the error code equals the status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(httptool.BaseHttpResponse{Code: int64(status), ErrorMessage: message})
+}
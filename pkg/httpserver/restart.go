@@ -0,0 +1,501 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// InheritedFdsEnv 是重启时传递给新进程的环境变量，按顺序列出从 3 开始的每个继承的文件描述符，以逗号分隔。
+	// 每一项是文件描述符的用途，监听器还带有等号和转义后的地址，例如 listener=127.0.0.1%3A8080,admin=unix%3A%2Frun%2Fapp%2Fadmin.sock,ready
+	// InheritedFdsEnv is the environment variable passed to the new process on restart, listing each inherited file descriptor starting from 3 in order, separated by commas.
+	// Each entry is the purpose of the file descriptor, listeners also carry an equal sign and the escaped address, such as listener=127.0.0.1%3A8080,admin=unix%3A%2Frun%2Fapp%2Fadmin.sock,ready
+	InheritedFdsEnv = "TINY_HTTP_SERVER_FDS"
+
+	// defaultRestartTimeout 是默认的等待新进程就绪的超时时间（秒）
+	// defaultRestartTimeout is the default timeout of waiting for the new process to be ready in seconds
+	defaultRestartTimeout = 30
+
+	// defaultRestartSettle 是默认的旧进程停止接受连接后等待刚接受的连接发送第一个请求的最长时间
+	// defaultRestartSettle is the default longest time the old process waits for the connections just accepted to send their first request after it stops accepting connections
+	defaultRestartSettle = time.Second
+
+	// fdListener 是监听配置的地址的文件描述符的用途，地址是 WithAddress 的地址或者 unix: 开头的套接字路径
+	// fdListener is the purpose of the file descriptors listening on configured addresses, the address is the one of WithAddress or a socket path starting with unix:
+	fdListener = "listener"
+
+	// fdSupplied 是外部提供的监听器的文件描述符的用途，地址是监听器的地址
+	// fdSupplied is the purpose of the file descriptors of the externally supplied listeners, the address is the one of the listener
+	fdSupplied = "supplied"
+
+	// fdSystemd 是 systemd 套接字激活传递的监听器的文件描述符的用途，地址是监听器的地址
+	// fdSystemd is the purpose of the file descriptors of the listeners passed by systemd socket activation, the address is the one of the listener
+	fdSystemd = "systemd"
+
+	// fdAdmin 是管理端监听器的文件描述符的用途
+	// fdAdmin is the purpose of the file descriptor of the admin listener
+	fdAdmin = "admin"
+
+	// fdReady 是就绪管道的文件描述符的用途，新进程就绪后向它写入一个字节
+	// fdReady is the purpose of the file descriptor of the readiness pipe, the new process writes a byte to it once ready
+	fdReady = "ready"
+)
+
+// WithRestartSignals 让服务器在收到指定的信号时平滑重启，未指定信号时使用 SIGHUP。见 Restart
+// WithRestartSignals makes the server restart gracefully when receiving the given signals, SIGHUP is used when no signal is given. See Restart
+func WithRestartSignals(signals ...os.Signal) Option {
+	return func(o *options) {
+		if len(signals) == 0 {
+			signals = []os.Signal{syscall.SIGHUP}
+		}
+		o.restartSignals = signals
+	}
+}
+
+// WithRestartTimeout 设置重启时等待新进程就绪的超时时间，超时后新进程被杀死，旧进程继续服务，默认是 30 秒
+// WithRestartTimeout sets the timeout of waiting for the new process to be ready on restart, the new process is killed after the timeout and the old one keeps serving, the default is 30 seconds
+func WithRestartTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.restartTimeout = timeout
+	}
+}
+
+// WithRestartSettle 设置重启时旧进程停止接受连接后，等待刚接受的连接发送第一个请求的最长时间，默认是 1 秒。
+// 所有连接的第一个请求都被读取后旧进程立即开始关闭，0 表示不等待，这些连接上的请求可能被丢弃
+// WithRestartSettle sets the longest time the old process waits on restart, after it stops accepting connections, for the connections just accepted to send their first request, the default is 1 second.
+// The old process starts shutting down as soon as the first requests of all connections are read, 0 means no waiting and the requests on these connections may be dropped
+func WithRestartSettle(settle time.Duration) Option {
+	return func(o *options) {
+		o.restartSettle = settle
+	}
+}
+
+// filer 是可以复制文件描述符的监听器，例如 *net.TCPListener 和 *net.UnixListener
+// filer is a listener whose file descriptor can be duplicated, such as *net.TCPListener and *net.UnixListener
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Restart 平滑地重启服务器：使用相同的参数和环境重新执行当前程序，通过继承的文件描述符把所有监听器交给新进程，
+// 新进程开始服务后旧进程像 Shutdown 一样排空连接并停止，Run 和 Wait 随后返回，进程可以正常退出。
+// 整个过程中监听的套接字一直打开，新的连接不会被拒绝。新进程没有在超时时间内就绪时被杀死，旧进程继续服务并返回错误。
+// 新进程中的服务器按照用途和地址认领继承的监听器，因此重启前后服务器的地址需要保持不变，同一个进程中的多个服务器互不影响。
+// 不支持 Windows
+// Restart restarts the server gracefully: the current program is executed again with the same arguments and environment, all listeners are handed over to the new process through inherited file descriptors,
+// and once the new process serves, the old one drains the connections and stops like Shutdown, then Run and Wait return and the process can exit normally.
+// The listening sockets stay open during the whole process, new connections are never refused. If the new process is not ready within the timeout it is killed, the old one keeps serving and an error is returned.
+// The servers in the new process claim the inherited listeners by purpose and address, so the addresses of the server must stay the same across the restart, and several servers in one process do not affect each other.
+// Windows is not supported
+func (s *TinyHttpServer) Restart() error {
+	// 只有正在服务的服务器可以重启，同一时间只进行一次重启
+	// Only a serving server can restart, only one restart is in progress at a time
+	select {
+	case <-s.ready:
+	default:
+		return errors.New("http server restart: server is not started")
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("http server restart: not supported on windows")
+	}
+	if s.Draining() {
+		return errors.New("http server restart: server is shutting down")
+	}
+	if !s.restarting.CompareAndSwap(false, true) {
+		return errors.New("http server restart: restart already in progress")
+	}
+
+	// 启动新进程并等待它就绪
+	// Start the new process and wait for it to be ready
+	pid, err := s.startSuccessor()
+	if err != nil {
+		s.restarting.Store(false)
+		return fmt.Errorf("http server restart: %w", err)
+	}
+	s.log.Info("http server handed over to new process, shutting down", "pid", pid)
+
+	// 新进程接管了 Unix 域套接字，关闭旧的监听器时不能删除套接字文件
+	// The new process has taken over the Unix domain sockets, the socket files must not be removed when closing the old listeners
+	for _, ln := range append(append([]net.Listener(nil), s.listeners...), s.adminListener) {
+		if ul, ok := ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	// 立即停止接受新的连接，之后的连接全部由新进程接受。net/http 会丢弃关闭开始后才读取的请求，
+	// 所以等待服务的 goroutine 退出、刚刚接受的连接上的第一个请求被读取，最多等待 restartSettle，然后排空连接并停止旧的服务器
+	// Stop accepting new connections immediately, all later connections are accepted by the new process. net/http drops requests read after the shutdown starts,
+	// so wait for the serving goroutines to exit and the first requests on the connections just accepted to be read, for at most restartSettle, then drain the connections and stop the old server
+	s.draining.Store(true)
+	closeListeners(s.listeners)
+	timer := time.NewTimer(s.restartSettle)
+	defer timer.Stop()
+	select {
+	case <-s.served:
+		s.fresh.wait(timer.C)
+	case <-timer.C:
+	}
+	return s.Shutdown()
+}
+
+// freshConns 记录已经接受但还没有读取第一个请求的连接
+// freshConns records the connections accepted whose first request is not read yet
+type freshConns struct {
+	// mu 保护连接的集合
+	// mu protects the set of connections
+	mu sync.Mutex
+
+	// conns 是处于 http.StateNew 状态的连接
+	// conns are the connections in the http.StateNew state
+	conns map[net.Conn]struct{}
+
+	// emptied 在集合变为空时收到通知
+	// emptied is notified when the set becomes empty
+	emptied chan struct{}
+}
+
+// newFreshConns 创建一个新的连接记录
+// newFreshConns creates a new connection record
+func newFreshConns() *freshConns {
+	return &freshConns{conns: make(map[net.Conn]struct{}), emptied: make(chan struct{}, 1)}
+}
+
+// track 是 http.Server 的 ConnState 钩子，连接离开 http.StateNew 状态时说明第一个请求已经开始读取
+// track is the ConnState hook of http.Server, a connection leaving the http.StateNew state means its first request has started to be read
+func (f *freshConns) track(conn net.Conn, state http.ConnState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if state == http.StateNew {
+		f.conns[conn] = struct{}{}
+		return
+	}
+	if _, ok := f.conns[conn]; !ok {
+		return
+	}
+	delete(f.conns, conn)
+	if len(f.conns) == 0 {
+		select {
+		case f.emptied <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait 等待所有记录的连接离开 http.StateNew 状态，或者直到 expired 收到通知
+// wait waits for all recorded connections to leave the http.StateNew state, or until expired is notified
+func (f *freshConns) wait(expired <-chan time.Time) {
+	for {
+		f.mu.Lock()
+		count := len(f.conns)
+		f.mu.Unlock()
+		if count == 0 {
+			return
+		}
+		select {
+		case <-f.emptied:
+		case <-expired:
+			return
+		}
+	}
+}
+
+// startSuccessor 启动继承所有监听器的新进程，并等待它就绪，返回新进程的 pid
+// startSuccessor starts the new process inheriting all listeners and waits for it to be ready, returning the pid of the new process
+func (s *TinyHttpServer) startSuccessor() (int, error) {
+	// 复制所有监听器的文件描述符
+	// Duplicate the file descriptors of all listeners
+	var files []*os.File
+	var purposes []string
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	handOver := func(ln net.Listener, key string) error {
+		fl, ok := ln.(filer)
+		if !ok {
+			return fmt.Errorf("listener %s (%T) cannot be handed over", ln.Addr(), ln)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files, purposes = append(files, f), append(purposes, key)
+		return nil
+	}
+	for i, ln := range s.listeners {
+		if err := handOver(ln, s.listenerKeys[i]); err != nil {
+			return 0, err
+		}
+	}
+	if s.adminListener != nil {
+		if err := handOver(s.adminListener, inheritKey(fdAdmin, s.adminsvr.Addr)); err != nil {
+			return 0, err
+		}
+	}
+
+	// 新进程通过管道通知它已经就绪
+	// The new process notifies it is ready through the pipe
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	files, purposes = append(files, w), append(purposes, fdReady)
+
+	// 使用相同的参数和环境启动新进程
+	// Start the new process with the same arguments and environment
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(successorEnviron(), InheritedFdsEnv+"="+strings.Join(purposes, ","))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	// 关闭当前进程持有的副本，新进程退出时管道的读取端因此可以读到 EOF
+	// Close the copies held by the current process, so the read end of the pipe reaches EOF when the new process exits
+	for _, f := range files {
+		_ = f.Close()
+	}
+	files = nil
+
+	// 等待新进程就绪、退出或者超时
+	// Wait for the new process to be ready, to exit or to time out
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+	timer := time.NewTimer(s.restartTimeout)
+	defer timer.Stop()
+
+	pid := cmd.Process.Pid
+	select {
+	case err := <-ready:
+		if err == nil {
+			return pid, nil
+		}
+		// 新进程没有就绪就关闭了管道，通常是因为它已经退出
+		// The new process closed the pipe without being ready, usually because it has exited
+		_ = cmd.Process.Kill()
+		return 0, fmt.Errorf("new process %d exited before being ready: %v", pid, <-exited)
+	case err := <-exited:
+		return 0, fmt.Errorf("new process %d exited before being ready: %v", pid, err)
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		return 0, fmt.Errorf("new process %d is not ready within %v", pid, s.restartTimeout)
+	}
+}
+
+// successorEnviron 返回新进程的环境变量，去掉了继承的文件描述符和 systemd 套接字激活相关的变量
+// successorEnviron returns the environment variables of the new process, without the variables related to inherited file descriptors and systemd socket activation
+func successorEnviron() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		switch name := kv[:strings.IndexByte(kv+"=", '=')]; name {
+		case InheritedFdsEnv, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+		default:
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// inheritKey 返回继承的监听器的键，由用途、等号和转义后的地址组成
+// inheritKey returns the key of an inherited listener, made of the purpose, an equal sign and the escaped address
+func inheritKey(purpose, address string) string {
+	return purpose + "=" + url.QueryEscape(address)
+}
+
+// inheritance 是重启时从旧进程继承的文件，进程中的每个服务器在启动时认领自己的监听器
+// inheritance is the files inherited from the old process on restart, each server in the process claims its own listeners when starting
+type inheritance struct {
+	// mu 保护下面的字段
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// listeners 是还没有被认领的继承的监听器，键由 inheritKey 生成
+	// listeners are the inherited listeners not claimed yet, the keys are made by inheritKey
+	listeners map[string]net.Listener
+
+	// ready 是就绪管道的写入端
+	// ready is the write end of the readiness pipe
+	ready *os.File
+}
+
+// processInheritance 是当前进程从旧进程继承的文件，只读取一次，由进程中的所有服务器共享
+// processInheritance is the files the current process inherits from the old process, it is read only once and shared by all servers of the process
+var processInheritance struct {
+	once      sync.Once
+	inherited *inheritance
+	err       error
+}
+
+// inheritedFiles 返回当前进程从旧进程继承的文件，第一次调用时读取
+// inheritedFiles returns the files the current process inherits from the old process, they are read on the first call
+func inheritedFiles() (*inheritance, error) {
+	processInheritance.once.Do(func() {
+		processInheritance.inherited, processInheritance.err = inherit()
+	})
+	return processInheritance.inherited, processInheritance.err
+}
+
+// inherit 读取旧进程传递的文件描述符，并清除环境变量以免被之后的子进程继承。进程不是由重启启动时返回空的继承
+// inherit reads the file descriptors passed by the old process, clearing the environment variable so that later child processes do not inherit it. An empty inheritance is returned when the process is not started by a restart
+func inherit() (*inheritance, error) {
+	inherited := &inheritance{listeners: make(map[string]net.Listener)}
+	value := os.Getenv(InheritedFdsEnv)
+	if value == "" {
+		return inherited, nil
+	}
+	_ = os.Unsetenv(InheritedFdsEnv)
+
+	for i, key := range strings.Split(value, ",") {
+		fd := listenFdsStart + i
+		switch purpose := key[:strings.IndexByte(key+"=", '=')]; purpose {
+		case fdReady:
+			inherited.ready = os.NewFile(uintptr(fd), purpose)
+			continue
+		case fdListener, fdSupplied, fdSystemd, fdAdmin:
+		default:
+			inherited.close()
+			return nil, fmt.Errorf("inherited file descriptor %d has unknown purpose %q", fd, purpose)
+		}
+
+		// 转换为监听器，当前进程接管 Unix 域套接字，停止时删除套接字文件
+		// Convert into a listener, the current process takes over the Unix domain sockets and removes the socket files when stopping
+		listeners, err := fileListeners(fd, 1, []string{key})
+		if err != nil {
+			inherited.close()
+			return nil, err
+		}
+		if ul, ok := listeners[0].(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(true)
+		}
+		inherited.listeners[key] = listeners[0]
+	}
+	return inherited, nil
+}
+
+// claim 取出用途和地址对应的继承的监听器，没有时返回空
+// claim takes the inherited listener of the purpose and the address, nil is returned when there is none
+func (i *inheritance) claim(purpose, address string) net.Listener {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	key := inheritKey(purpose, address)
+	ln := i.listeners[key]
+	delete(i.listeners, key)
+	return ln
+}
+
+// claim 认领用途和地址对应的继承的监听器，认领到时服务器由重启启动，就绪后需要通知旧进程
+// claim claims the inherited listener of the purpose and the address, the server is started by a restart when it is claimed and needs to notify the old process once ready
+func (s *TinyHttpServer) claim(inherited *inheritance, purpose, address string) net.Listener {
+	ln := inherited.claim(purpose, address)
+	if ln != nil {
+		s.restarted = true
+	}
+	return ln
+}
+
+// claimAll 按照键的顺序取出用途对应的所有继承的监听器，同时返回它们的键
+// claimAll takes all inherited listeners of the purpose in the order of the keys, returning their keys as well
+func (i *inheritance) claimAll(purpose string) ([]net.Listener, []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var keys []string
+	for key := range i.listeners {
+		if strings.HasPrefix(key, purpose+"=") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	listeners := make([]net.Listener, 0, len(keys))
+	for _, key := range keys {
+		listeners = append(listeners, i.listeners[key])
+		delete(i.listeners, key)
+	}
+	return listeners, keys
+}
+
+// notifyReady 通知旧进程当前进程已经就绪，并关闭没有被认领的继承的监听器，新的配置不再使用它们
+// notifyReady notifies the old process that the current process is ready and closes the inherited listeners not claimed, the new configuration no longer uses them
+func (i *inheritance) notifyReady() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for key, ln := range i.listeners {
+		_ = ln.Close()
+		delete(i.listeners, key)
+	}
+	if i.ready != nil {
+		_, _ = i.ready.Write([]byte{1})
+		_ = i.ready.Close()
+		i.ready = nil
+	}
+}
+
+// abort 关闭就绪管道，启动失败时使用，旧进程因此知道当前进程没有就绪。继承为空时不做任何事
+// abort closes the readiness pipe, used when the start fails, so the old process knows the current process is not ready. Nothing is done when the inheritance is nil
+func (i *inheritance) abort() {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.ready != nil {
+		_ = i.ready.Close()
+		i.ready = nil
+	}
+}
+
+// close 关闭所有继承的文件
+// close closes all inherited files
+func (i *inheritance) close() {
+	for _, ln := range i.listeners {
+		_ = ln.Close()
+	}
+	if i.ready != nil {
+		_ = i.ready.Close()
+	}
+}
+
+// handleRestartSignals 开始接收重启信号，并在收到信号时重启服务器，服务器停止服务后不再接收信号
+// handleRestartSignals starts receiving the restart signals and restarts the server when receiving a signal, the signals are no longer received after the server stops serving
+func (s *TinyHttpServer) handleRestartSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, s.restartSignals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case sig := <-ch:
+				// 收到信号，平滑地重启服务器，失败时继续服务
+				// A signal is received, restart the server gracefully, keep serving on failure
+				s.log.Info("http server received signal, restarting", "signal", sig)
+				if err := s.Restart(); err != nil {
+					s.log.Error("http server restart failed", "error", err)
+				}
+			case <-s.served:
+				return
+			}
+		}
+	}()
+}
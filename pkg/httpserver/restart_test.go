@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTinyHttpServer_RestartNotStarted(t *testing.T) {
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"))
+	assert.NoError(t, err)
+	assert.ErrorContains(t, srv.Restart(), "server is not started")
+}
+
+func TestInherit(t *testing.T) {
+	// Nothing is inherited when the process is not started by a restart
+	inherited, err := inherit()
+	assert.NoError(t, err)
+	assert.Empty(t, inherited.listeners)
+	assert.Nil(t, inherited.ready)
+
+	// An unknown purpose is rejected and the variable is cleared
+	t.Setenv(InheritedFdsEnv, "unknown=127.0.0.1%3A8080")
+	_, err = inherit()
+	assert.ErrorContains(t, err, `unknown purpose "unknown"`)
+	assert.Empty(t, os.Getenv(InheritedFdsEnv))
+}
+
+func TestInheritance_Claim(t *testing.T) {
+	// Listeners handed over by the old process, keyed by purpose and address
+	listen := func() net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		return ln
+	}
+	public, other, admin, stale := listen(), listen(), listen(), listen()
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+	inherited := &inheritance{
+		listeners: map[string]net.Listener{
+			inheritKey(fdListener, public.Addr().String()): public,
+			inheritKey(fdListener, other.Addr().String()):  other,
+			inheritKey(fdAdmin, admin.Addr().String()):     admin,
+			inheritKey(fdListener, "127.0.0.1:1"):          stale,
+		},
+		ready: w,
+	}
+
+	// Each server claims only the listeners of its own addresses, the ports are still held by the inherited listeners
+	first, err := NewWithOptions(WithAddress(public.Addr().String()))
+	assert.NoError(t, err)
+	listeners, keys, err := first.listenAll(inherited)
+	assert.NoError(t, err)
+	assert.Equal(t, []net.Listener{public}, listeners)
+	assert.Equal(t, []string{"listener=" + strings.ReplaceAll(public.Addr().String(), ":", "%3A")}, keys)
+	assert.True(t, first.restarted)
+	second, err := NewWithOptions(WithAddress(other.Addr().String()))
+	assert.NoError(t, err)
+	listeners, _, err = second.listenAll(inherited)
+	assert.NoError(t, err)
+	assert.Equal(t, []net.Listener{other}, listeners)
+	assert.Equal(t, admin, second.claim(inherited, fdAdmin, admin.Addr().String()))
+
+	// A server with other addresses claims nothing
+	third, err := NewWithOptions(WithAddress("127.0.0.1:0"))
+	assert.NoError(t, err)
+	listeners, _, err = third.listenAll(inherited)
+	assert.NoError(t, err)
+	defer closeListeners(listeners)
+	assert.False(t, third.restarted)
+
+	// The old process is notified and the listeners not claimed are closed
+	inherited.notifyReady()
+	buf := make([]byte, 1)
+	_, err = r.Read(buf)
+	assert.NoError(t, err)
+	assert.Empty(t, inherited.listeners)
+	_, err = stale.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+	closeListeners([]net.Listener{public, other, admin})
+}
+
+func TestFreshConns(t *testing.T) {
+	fresh := newFreshConns()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	// Nothing is waited for without connections
+	fresh.wait(nil)
+
+	// Waiting ends after every new connection has left the new state
+	fresh.track(a, http.StateNew)
+	fresh.track(b, http.StateNew)
+	done := make(chan struct{})
+	go func() {
+		fresh.wait(nil)
+		close(done)
+	}()
+	fresh.track(a, http.StateActive)
+	select {
+	case <-done:
+		t.Fatal("wait returned with a new connection")
+	case <-time.After(20 * time.Millisecond):
+	}
+	fresh.track(b, http.StateClosed)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return")
+	}
+
+	// Waiting ends when expired, states after the first request are ignored
+	fresh.track(a, http.StateNew)
+	expired := make(chan time.Time)
+	close(expired)
+	fresh.wait(expired)
+	fresh.track(a, http.StateActive)
+	fresh.track(a, http.StateIdle)
+	fresh.wait(nil)
+}
+
+func TestNewWithOptions_InvalidRestart(t *testing.T) {
+	tests := map[string][]Option{
+		"negative timeout": {WithRestartTimeout(-1)},
+		"zero timeout":     {WithRestartTimeout(0)},
+		"negative settle":  {WithRestartSettle(-1)},
+	}
+	for name, opts := range tests {
+		srv, err := NewWithOptions(opts...)
+		assert.ErrorIs(t, err, ErrInvalidOption, name)
+		assert.Nil(t, srv, name)
+	}
+}
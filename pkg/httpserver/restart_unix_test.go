@@ -0,0 +1,185 @@
+//go:build unix
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// helperEnv selects the mode of the helper process
+const helperEnv = "TINY_HTTP_SERVER_HELPER"
+
+// TestRestartHelperProcess is not a real test, it is the server process restarted by the tests below
+func TestRestartHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		t.Skip("helper process of the restart tests")
+	}
+
+	// A new process which fails to start in the fail mode
+	if mode == "fail" && os.Getenv(InheritedFdsEnv) != "" {
+		os.Exit(3)
+	}
+
+	// Serve the pid, a slow request and a restart endpoint
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSignals(syscall.SIGTERM), WithRestartSignals(), WithRestartTimeout(10*time.Second))
+	if err != nil {
+		os.Exit(1)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	srv.Get("/pid", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(pid)) })
+	srv.Get("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		_, _ = w.Write([]byte(pid))
+	})
+	srv.Post("/restart", func(w http.ResponseWriter, _ *http.Request) {
+		go func() {
+			if err := srv.Restart(); err != nil {
+				fmt.Printf("restart failed: %v\n", err)
+			}
+		}()
+	})
+	if err := srv.Start(); err != nil {
+		os.Exit(1)
+	}
+
+	// Report the address and the pid to the test
+	fmt.Printf("%s %s\n", srv.Addr(), pid)
+	if err := srv.Wait(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// startHelper starts the helper process in the mode and returns it with the lines of its output
+func startHelper(t *testing.T, mode string) (*exec.Cmd, *bufio.Scanner) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestartHelperProcess$")
+	cmd.Env = append(os.Environ(), helperEnv+"="+mode)
+	stdout, err := cmd.StdoutPipe()
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Start())
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	return cmd, bufio.NewScanner(stdout)
+}
+
+// readLine reads the next line of the helper output
+func readLine(t *testing.T, lines *bufio.Scanner) string {
+	t.Helper()
+	line := make(chan string, 1)
+	go func() {
+		lines.Scan()
+		line <- lines.Text()
+	}()
+	select {
+	case l := <-line:
+		return l
+	case <-time.After(20 * time.Second):
+		t.Fatal("helper process did not report")
+		return ""
+	}
+}
+
+// readAddr reads the address and the pid reported by the helper
+func readAddr(t *testing.T, lines *bufio.Scanner) (string, string) {
+	t.Helper()
+	var addr, pid string
+	_, err := fmt.Sscan(readLine(t, lines), &addr, &pid)
+	assert.NoError(t, err)
+	return addr, pid
+}
+
+func TestTinyHttpServer_Restart(t *testing.T) {
+	cmd, lines := startHelper(t, "serve")
+	addr, oldPid := readAddr(t, lines)
+	url := fmt.Sprintf("http://%s", addr)
+
+	// Send requests continuously on new connections during the restart
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	stop := make(chan struct{})
+	failures := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			resp, err := client.Get(url + "/pid")
+			if err != nil {
+				failures.Add(1)
+				continue
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				failures.Add(1)
+			}
+		}
+	}()
+
+	// Start a slow request and restart the server with the signal while it is in flight
+	slow := make(chan string, 1)
+	go func() {
+		_, body := get(t, url+"/slow")
+		slow <- body
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, cmd.Process.Signal(syscall.SIGHUP))
+
+	// The new process serves on the same address
+	newAddr, newPid := readAddr(t, lines)
+	if pid, err := strconv.Atoi(newPid); err == nil {
+		t.Cleanup(func() { _ = syscall.Kill(pid, syscall.SIGKILL) })
+	}
+	assert.Equal(t, addr, newAddr)
+	assert.NotEqual(t, oldPid, newPid)
+
+	// The old process finishes the slow request and exits normally
+	assert.Equal(t, oldPid, <-slow)
+	assert.NoError(t, cmd.Wait())
+	_, body := get(t, url+"/pid")
+	assert.Equal(t, newPid, body)
+
+	// No request failed during the restart
+	close(stop)
+	wg.Wait()
+	assert.Zero(t, failures.Load())
+
+	// The new process stops on SIGTERM
+	pid, err := strconv.Atoi(newPid)
+	assert.NoError(t, err)
+	assert.NoError(t, syscall.Kill(pid, syscall.SIGTERM))
+}
+
+func TestTinyHttpServer_RestartFailure(t *testing.T) {
+	_, lines := startHelper(t, "fail")
+	addr, pid := readAddr(t, lines)
+	url := fmt.Sprintf("http://%s", addr)
+
+	// The new process exits before being ready
+	resp, err := http.Post(url+"/restart", "", nil)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Contains(t, readLine(t, lines), "exited before being ready")
+
+	// The old process keeps serving
+	_, body := get(t, url+"/pid")
+	assert.Equal(t, pid, body)
+}
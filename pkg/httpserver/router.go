@@ -0,0 +1,485 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// contextKey 是服务器在请求上下文中使用的键的类型
+// contextKey is the type of the keys used by the server in the request context
+type contextKey int
+
+const (
+	// paramsContextKey 是路径参数在请求上下文中的键
+	// paramsContextKey is the key of the path parameters in the request context
+	paramsContextKey contextKey = iota
+
+	// requestIDContextKey 是请求 ID 在请求上下文中的键
+	// requestIDContextKey is the key of the request ID in the request context
+	requestIDContextKey
+
+	// requestStateContextKey 是请求状态在请求上下文中的键
+	// requestStateContextKey is the key of the request state in the request context
+	requestStateContextKey
+
+	// principalContextKey 是认证主体在请求上下文中的键
+	// principalContextKey is the key of the authenticated principal in the request context
+	principalContextKey
+
+	// claimsContextKey 是 JWT 声明在请求上下文中的键
+	// claimsContextKey is the key of the JWT claims in the request context
+	claimsContextKey
+)
+
+// segmentKind 是路由模式中一段路径的类型
+// segmentKind is the kind of a path segment in a route pattern
+type segmentKind int
+
+const (
+	// literalSegment 是固定的路径段，例如 /users
+	// literalSegment is a fixed path segment, such as /users
+	literalSegment segmentKind = iota
+
+	// paramSegment 是匹配一段路径的参数，例如 /{id}
+	// paramSegment is a parameter matching one path segment, such as /{id}
+	paramSegment
+
+	// catchAllSegment 是匹配剩余所有路径的参数，例如 /{path...}
+	// catchAllSegment is a parameter matching all the remaining path, such as /{path...}
+	catchAllSegment
+)
+
+// segment 是路由模式中的一段路径
+// segment is a path segment in a route pattern
+type segment struct {
+	// kind 是路径段的类型
+	// kind is the kind of the path segment
+	kind segmentKind
+
+	// value 是固定路径段的内容或参数的名称
+	// value is the content of a fixed path segment or the name of a parameter
+	value string
+}
+
+// route 是一条注册的路由
+// route is a registered route
+type route struct {
+	// method 是路由的 HTTP 方法，为空表示匹配所有方法
+	// method is the HTTP method of the route, empty means all methods are matched
+	method string
+
+	// pattern 是路由的模式
+	// pattern is the pattern of the route
+	pattern string
+
+	// segments 是路由模式中的路径段
+	// segments are the path segments of the route pattern
+	segments []segment
+
+	// subtree 表示模式以 "/" 结尾，匹配该路径下的所有子路径
+	// subtree indicates the pattern ends with "/", matching all sub paths under it
+	subtree bool
+
+	// handler 是路由的处理器
+	// handler is the handler of the route
+	handler http.Handler
+}
+
+// parsePattern 解析路由模式，模式必须以 "/" 开头，支持 {name} 参数、结尾的 {name...} 参数，以及以 "/" 结尾的子路径匹配
+// parsePattern parses a route pattern, the pattern must start with "/", and supports {name} parameters, a trailing {name...} parameter, and sub path matching with a trailing "/"
+func parsePattern(pattern string) ([]segment, bool, error) {
+	// 模式必须以 "/" 开头
+	// The pattern must start with "/"
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, false, fmt.Errorf("pattern %q must start with \"/\"", pattern)
+	}
+
+	// 以 "/" 结尾的模式匹配子路径
+	// A pattern ending with "/" matches sub paths
+	parts := strings.Split(pattern[1:], "/")
+	subtree := parts[len(parts)-1] == ""
+	if subtree {
+		parts = parts[:len(parts)-1]
+	}
+
+	// 解析每一段路径
+	// Parse each path segment
+	segments := make([]segment, 0, len(parts))
+	names := make(map[string]struct{})
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			// 参数路径段
+			// Parameter path segment
+			name, kind := part[1:len(part)-1], paramSegment
+			if strings.HasSuffix(name, "...") {
+				name, kind = strings.TrimSuffix(name, "..."), catchAllSegment
+				if i != len(parts)-1 || subtree {
+					return nil, false, fmt.Errorf("pattern %q: {%s...} must be the last segment", pattern, name)
+				}
+			}
+			if name == "" {
+				return nil, false, fmt.Errorf("pattern %q: empty parameter name", pattern)
+			}
+			if _, ok := names[name]; ok {
+				return nil, false, fmt.Errorf("pattern %q: duplicate parameter %q", pattern, name)
+			}
+			names[name] = struct{}{}
+			segments = append(segments, segment{kind: kind, value: name})
+		case part == "":
+			// 空的路径段
+			// Empty path segment
+			return nil, false, fmt.Errorf("pattern %q: empty segment", pattern)
+		case strings.ContainsAny(part, "{}"):
+			// 参数必须占据整个路径段
+			// A parameter must occupy the whole path segment
+			return nil, false, fmt.Errorf("pattern %q: parameter must be a whole segment", pattern)
+		default:
+			// 固定路径段
+			// Fixed path segment
+			segments = append(segments, segment{kind: literalSegment, value: part})
+		}
+	}
+
+	return segments, subtree, nil
+}
+
+// match 检查路径是否匹配路由，返回路径参数
+// match checks whether the path matches the route, returning the path parameters
+func (rt *route) match(parts []string) (map[string]string, bool) {
+	// 非子路径匹配时路径段的数量必须相同，子路径匹配时路径必须更长
+	// The number of path segments must be equal for a non sub path match, and the path must be longer for a sub path match
+	last := len(rt.segments) - 1
+	catchAll := last >= 0 && rt.segments[last].kind == catchAllSegment
+	switch {
+	case catchAll && len(parts) < last:
+		return nil, false
+	case rt.subtree && len(parts) <= len(rt.segments):
+		return nil, false
+	case !catchAll && !rt.subtree && len(parts) != len(rt.segments):
+		return nil, false
+	}
+
+	// 逐段匹配
+	// Match segment by segment
+	var params map[string]string
+	for i, seg := range rt.segments {
+		switch seg.kind {
+		case literalSegment:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case paramSegment:
+			if parts[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg.value] = parts[i]
+		case catchAllSegment:
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg.value] = strings.Join(parts[i:], "/")
+		}
+	}
+
+	return params, true
+}
+
+// moreSpecific 检查路由 rt 是否比 other 更具体：固定路径段优先于参数，参数优先于剩余路径参数，较长的模式优先于较短的模式，精确匹配优先于子路径匹配
+// moreSpecific checks whether route rt is more specific than other: fixed segments win over parameters, parameters win over catch-all parameters, longer patterns win over shorter ones, and exact matches win over sub path matches
+func (rt *route) moreSpecific(other *route) bool {
+	// 逐段比较路径段的类型
+	// Compare the kinds of path segments one by one
+	for i := 0; i < len(rt.segments) && i < len(other.segments); i++ {
+		if rt.segments[i].kind != other.segments[i].kind {
+			return rt.segments[i].kind < other.segments[i].kind
+		}
+	}
+
+	// 较长的模式更具体
+	// A longer pattern is more specific
+	if len(rt.segments) != len(other.segments) {
+		return len(rt.segments) > len(other.segments)
+	}
+
+	// 精确匹配比子路径匹配更具体，指定方法的路由比匹配所有方法的路由更具体
+	// An exact match is more specific than a sub path match, and a route with a method is more specific than a route matching all methods
+	if rt.subtree != other.subtree {
+		return !rt.subtree
+	}
+	return rt.method != "" && other.method == ""
+}
+
+// router 是一个支持 HTTP 方法和路径参数的路由器，可以在服务器启动前后注册路由
+// router is a router supporting HTTP methods and path parameters, routes can be registered before or after the server starts
+type router struct {
+	// mu 保护路由表
+	// mu protects the route table
+	mu sync.RWMutex
+
+	// routes 是注册的路由
+	// routes are the registered routes
+	routes []*route
+
+	// notFound 是处理未匹配任何路由的请求的处理器，为空时返回 404
+	// notFound is the handler for requests matching no route, 404 is returned when it is nil
+	notFound http.Handler
+}
+
+// newRouter 创建一个新的路由器
+// newRouter creates a new router
+func newRouter() *router {
+	return &router{}
+}
+
+// handle 注册一条路由，模式无效或者重复注册时会 panic，与 http.ServeMux 的行为一致
+// handle registers a route, it panics if the pattern is invalid or registered twice, consistent with the behavior of http.ServeMux
+func (rr *router) handle(method, pattern string, handler http.Handler) {
+	// 处理器不能为空
+	// The handler cannot be nil
+	if handler == nil {
+		panic("server: nil handler for " + pattern)
+	}
+
+	// 解析路由模式
+	// Parse the route pattern
+	segments, subtree, err := parsePattern(pattern)
+	if err != nil {
+		panic("server: " + err.Error())
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	// 检查是否重复注册
+	// Check whether the route is registered twice
+	method = strings.ToUpper(method)
+	for _, rt := range rr.routes {
+		if rt.method == method && rt.pattern == pattern {
+			panic(fmt.Sprintf("server: multiple registrations for %s %s", method, pattern))
+		}
+	}
+
+	// 添加路由
+	// Add the route
+	rr.routes = append(rr.routes, &route{method: method, pattern: pattern, segments: segments, subtree: subtree, handler: handler})
+}
+
+// ServeHTTP 将请求分发到最具体的匹配路由，路径匹配但方法不匹配时返回 405
+// ServeHTTP dispatches the request to the most specific matching route, 405 is returned if the path matches but the method does not
+func (rr *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 查找匹配的路由
+	// Find the matching route
+	rt, params, allowed := rr.lookup(r.Method, cleanPath(r.URL.Path))
+
+	// 没有匹配的路由
+	// No matching route
+	if rt == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if rr.notFound != nil {
+			rr.notFound.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	// 记录匹配的路由模式，供指标使用
+	// Record the matched route pattern for the metrics
+	setMatchedRoute(r, rt.pattern)
+
+	// 将路径参数放入请求上下文
+	// Put the path parameters into the request context
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), paramsContextKey, params))
+	}
+
+	// 调用路由的处理器
+	// Call the handler of the route
+	rt.handler.ServeHTTP(w, r)
+}
+
+// lookup 查找与方法和路径匹配的最具体的路由，如果没有匹配的方法，返回路径匹配的路由允许的方法
+// lookup finds the most specific route matching the method and path, if no method matches, it returns the methods allowed by the routes matching the path
+func (rr *router) lookup(method, p string) (*route, map[string]string, []string) {
+	parts := strings.Split(p[1:], "/")
+
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	var (
+		best       *route
+		bestParams map[string]string
+		allowed    []string
+	)
+	for _, rt := range rr.routes {
+		// 检查路径是否匹配
+		// Check whether the path matches
+		params, ok := rt.match(parts)
+		if !ok {
+			continue
+		}
+
+		// 检查方法是否匹配，HEAD 请求可以使用 GET 路由
+		// Check whether the method matches, HEAD requests can use GET routes
+		if rt.method != "" && rt.method != method && !(method == http.MethodHead && rt.method == http.MethodGet) {
+			allowed = append(allowed, rt.method)
+			if rt.method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+			continue
+		}
+
+		// 选择最具体的路由
+		// Choose the most specific route
+		if best == nil || rt.moreSpecific(best) || (rt.method == method && best.method != method && !best.moreSpecific(rt)) {
+			best, bestParams = rt, params
+		}
+	}
+
+	// 去重并排序允许的方法
+	// Deduplicate and sort the allowed methods
+	if best == nil && len(allowed) > 0 {
+		sort.Strings(allowed)
+		unique := allowed[:1]
+		for _, m := range allowed[1:] {
+			if m != unique[len(unique)-1] {
+				unique = append(unique, m)
+			}
+		}
+		allowed = unique
+	}
+
+	return best, bestParams, allowed
+}
+
+// cleanPath 返回规范化的路径，保留结尾的 "/"
+// cleanPath returns the canonical path, keeping the trailing "/"
+func cleanPath(p string) string {
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// PathParam 返回请求中指定名称的路径参数，参数不存在时返回空字符串
+// PathParam returns the path parameter with the given name in the request, an empty string is returned if the parameter does not exist
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsContextKey).(map[string]string)
+	return params[name]
+}
+
+// RouteGroup 是一组共享路径前缀的路由
+// RouteGroup is a group of routes sharing a path prefix
+type RouteGroup struct {
+	// router 是注册路由的路由器
+	// router is the router where the routes are registered
+	router *router
+
+	// prefix 是组内所有路由的路径前缀
+	// prefix is the path prefix of all routes in the group
+	prefix string
+
+	// middlewares 是包装组内路由的中间件
+	// middlewares are the middlewares wrapping the routes in the group
+	middlewares []Middleware
+}
+
+// Group 创建一个子路由组，它的前缀是当前组的前缀加上 prefix，并继承当前组的中间件
+// Group creates a sub route group, whose prefix is the prefix of the current group plus prefix, inheriting the middlewares of the current group
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{router: g.router, prefix: g.join(prefix), middlewares: append([]Middleware(nil), g.middlewares...)}
+}
+
+// Handle 注册一个匹配所有方法的处理器
+// Handle registers a handler matching all methods
+func (g *RouteGroup) Handle(pattern string, handler http.Handler) {
+	g.HandleMethod("", pattern, handler)
+}
+
+// HandleFunc 注册一个匹配所有方法的处理函数
+// HandleFunc registers a handler function matching all methods
+func (g *RouteGroup) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	g.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// HandleMethod 注册一个只匹配指定方法的处理器
+// HandleMethod registers a handler matching only the given method
+func (g *RouteGroup) HandleMethod(method, pattern string, handler http.Handler) {
+	// nil 的 http.HandlerFunc 转换为 http.Handler 后不再是 nil，把它还原为 nil，使注册时就 panic 而不是在第一个请求时
+	// A nil http.HandlerFunc is no longer nil after converting to http.Handler, restore it to nil so that registration panics instead of the first request
+	if f, ok := handler.(http.HandlerFunc); ok && f == nil {
+		handler = nil
+	}
+	if handler != nil {
+		handler = Chain(handler, g.middlewares...)
+	}
+	g.router.handle(method, g.join(pattern), handler)
+}
+
+// Get 注册一个 GET 请求的处理函数，它也会处理 HEAD 请求
+// Get registers a handler function for GET requests, it also handles HEAD requests
+func (g *RouteGroup) Get(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodGet, pattern, handler)
+}
+
+// Head 注册一个 HEAD 请求的处理函数
+// Head registers a handler function for HEAD requests
+func (g *RouteGroup) Head(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodHead, pattern, handler)
+}
+
+// Post 注册一个 POST 请求的处理函数
+// Post registers a handler function for POST requests
+func (g *RouteGroup) Post(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodPost, pattern, handler)
+}
+
+// Put 注册一个 PUT 请求的处理函数
+// Put registers a handler function for PUT requests
+func (g *RouteGroup) Put(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodPut, pattern, handler)
+}
+
+// Patch 注册一个 PATCH 请求的处理函数
+// Patch registers a handler function for PATCH requests
+func (g *RouteGroup) Patch(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodPatch, pattern, handler)
+}
+
+// Delete 注册一个 DELETE 请求的处理函数
+// Delete registers a handler function for DELETE requests
+func (g *RouteGroup) Delete(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodDelete, pattern, handler)
+}
+
+// Options 注册一个 OPTIONS 请求的处理函数
+// Options registers a handler function for OPTIONS requests
+func (g *RouteGroup) Options(pattern string, handler http.HandlerFunc) {
+	g.HandleMethod(http.MethodOptions, pattern, handler)
+}
+
+// join 将组的前缀和模式连接成完整的模式
+// join joins the prefix of the group and the pattern into the full pattern
+func (g *RouteGroup) join(pattern string) string {
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	return strings.TrimSuffix(g.prefix, "/") + pattern
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// textHandler returns a handler function writing the given text
+func textHandler(text string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, text)
+	}
+}
+
+func TestRouter_Match(t *testing.T) {
+	// Register routes on a root group
+	r := newRouter()
+	g := &RouteGroup{router: r}
+	g.HandleFunc("/", textHandler("root"))
+	g.Get("/users", textHandler("list"))
+	g.Post("/users", textHandler("create"))
+	g.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "user "+PathParam(r, "id"))
+	})
+	g.Get("/users/me", textHandler("me"))
+	g.Get("/files/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "file "+PathParam(r, "path"))
+	})
+	g.Handle("/static/", textHandler("static"))
+
+	// Verify the most specific route is chosen
+	tests := []struct {
+		method, target, body string
+		code                 int
+	}{
+		{http.MethodGet, "/users", "list", http.StatusOK},
+		{http.MethodPost, "/users", "create", http.StatusOK},
+		{http.MethodHead, "/users", "", http.StatusOK},
+		{http.MethodGet, "/users/42", "user 42", http.StatusOK},
+		{http.MethodGet, "/users/me", "me", http.StatusOK},
+		{http.MethodGet, "/users/../users/7", "user 7", http.StatusOK},
+		{http.MethodGet, "/files/a/b.txt", "file a/b.txt", http.StatusOK},
+		{http.MethodGet, "/files", "file ", http.StatusOK},
+		{http.MethodGet, "/static/css/app.css", "static", http.StatusOK},
+		{http.MethodGet, "/static", "root", http.StatusOK},
+		{http.MethodGet, "/unknown", "root", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := serve(r, tt.method, tt.target)
+		assert.Equal(t, tt.code, rec.Code, tt.target)
+		if tt.method != http.MethodHead {
+			assert.Equal(t, tt.body, rec.Body.String(), tt.target)
+		}
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	// Register routes with methods only
+	r := newRouter()
+	g := &RouteGroup{router: r}
+	g.Get("/items/{id}", textHandler("get"))
+	g.Delete("/items/{id}", textHandler("delete"))
+	g.Put("/items/{id}", textHandler("put"))
+
+	// A matching path with another method returns 405, HEAD is allowed through the GET route
+	rec := serve(r, http.MethodPost, "/items/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, PUT", rec.Header().Get("Allow"))
+
+	// An unknown path returns 404
+	rec = serve(r, http.MethodGet, "/other")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRouteGroup(t *testing.T) {
+	// Register routes in nested groups
+	r := newRouter()
+	api := (&RouteGroup{router: r}).Group("/api/")
+	v1 := api.Group("v1")
+	v1.Get("/ping", textHandler("v1 pong"))
+	v1.Patch("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "patch "+PathParam(r, "id"))
+	})
+	api.Handle("/", textHandler("api"))
+
+	// Verify the prefixes are applied
+	assert.Equal(t, "v1 pong", serve(r, http.MethodGet, "/api/v1/ping").Body.String())
+	assert.Equal(t, "patch 3", serve(r, http.MethodPatch, "/api/v1/items/3").Body.String())
+	assert.Equal(t, "api", serve(r, http.MethodGet, "/api/v2/ping").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(r, http.MethodGet, "/v1/ping").Code)
+}
+
+func TestRouter_InvalidPatterns(t *testing.T) {
+	g := &RouteGroup{router: newRouter()}
+	g.Get("/a/{id}", textHandler("a"))
+
+	// Invalid and duplicated patterns panic
+	assert.Panics(t, func() { g.router.handle("", "a", textHandler("a")) })
+
+	// Nil handlers panic at registration, including nil handler functions
+	assert.Panics(t, func() { g.HandleFunc("/nil", nil) })
+	assert.Panics(t, func() { g.Post("/nil", nil) })
+	assert.Panics(t, func() { g.HandleMethod(http.MethodPut, "/nil", http.HandlerFunc(nil)) })
+	assert.Panics(t, func() { g.Get("/a//b", textHandler("a")) })
+	assert.Panics(t, func() { g.Get("/a/{}", textHandler("a")) })
+	assert.Panics(t, func() { g.Get("/a/x{id}", textHandler("a")) })
+	assert.Panics(t, func() { g.Get("/a/{p...}/b", textHandler("a")) })
+	assert.Panics(t, func() { g.Get("/a/{id}/{id}", textHandler("a")) })
+	assert.Panics(t, func() { g.Get("/a/{id}", textHandler("a")) })
+	assert.Panics(t, func() { g.Handle("/b", nil) })
+	assert.NotPanics(t, func() { g.Post("/a/{id}", textHandler("a")) })
+}
+
+func TestTinyHttpServer_Routes(t *testing.T) {
+	// Create a server on a random port
+	srv := NewTinyHttpServer(0, nil, nil)
+	defer srv.Stop()
+
+	// Register routes after the server is created
+	srv.Get("/hello/{name}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello "+PathParam(r, "name"))
+	})
+
+	// Verify the routes and the health check are served
+	assert.Equal(t, "hello lee", serve(srv.httpsvr.Handler, http.MethodGet, "/hello/lee").Body.String())
+	assert.Equal(t, "ok!!", serve(srv.httpsvr.Handler, http.MethodGet, "/ping").Body.String())
+}
@@ -2,9 +2,13 @@ package server
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -45,61 +49,282 @@ func defaultHealthCheckFuncHandler(w http.ResponseWriter, _ *http.Request) {
 // TinyHttpServer 定义了一个简单的HTTP服务器
 // TinyHttpServer defines a simple HTTP server
 type TinyHttpServer struct {
+	// RouteGroup 是服务器的根路由组，用于在服务器启动前后注册处理器
+	// RouteGroup is the root route group of the server, used to register handlers before or after the server starts
+	*RouteGroup
+
 	// port 是服务器监听的端口
 	// port is the port the server listens on
 	port uint16
 
+	// shutdownTimeout 是关闭服务器的宽限期
+	// shutdownTimeout is the grace period for shutting down the server
+	shutdownTimeout time.Duration
+
 	// httpsvr 是http服务器实例
 	// httpsvr is the http server instance
 	httpsvr *http.Server
 
-	// once 用于确保服务器只启动一次
-	// once is used to ensure the server only starts once
+	// once 用于确保服务器只停止一次
+	// once is used to ensure the server only stops once
 	once *sync.Once
 
+	// startOnce 用于确保服务器只启动一次
+	// startOnce is used to ensure the server only starts once
+	startOnce *sync.Once
+
+	// startErr 是启动服务器时的错误
+	// startErr is the error when starting the server
+	startErr error
+
+	// listeners 是服务器的所有监听器
+	// listeners are all listeners of the server
+	listeners []net.Listener
+
+	// listenerKeys 是每个监听器在重启时交给新进程使用的键
+	// listenerKeys are the keys of the listeners used by the new process on restart
+	listenerKeys []string
+
+	// listenerSpecs 是额外的监听器
+	// listenerSpecs are the extra listeners
+	listenerSpecs []listenerSpec
+
+	// listenAddr 表示配置了其他监听器时是否仍然监听地址和端口
+	// listenAddr indicates whether the address and the port are still listened on when other listeners are configured
+	listenAddr bool
+
+	// systemd 表示是否使用 systemd 套接字激活传递的监听器
+	// systemd indicates whether the listeners passed by systemd socket activation are used
+	systemd bool
+
+	// useTLS 表示是否使用 HTTPS 提供服务，在创建时确定，因为 http.Server 在服务时可能会填充 TLSConfig
+	// useTLS indicates whether HTTPS is used for serving, it is decided on creation because http.Server may fill in TLSConfig while serving
+	useTLS bool
+
+	// adminsvr 是管理端的 http 服务器，为空表示没有开启管理端
+	// adminsvr is the http server of the admin endpoint, nil means the admin endpoint is disabled
+	adminsvr *http.Server
+
+	// adminListener 是管理端的监听器
+	// adminListener is the listener of the admin endpoint
+	adminListener net.Listener
+
+	// ready 在服务器开始监听后关闭
+	// ready is closed after the server starts listening
+	ready chan struct{}
+
+	// done 在服务器停止服务后关闭
+	// done is closed after the server stops serving
+	done chan struct{}
+
+	// served 在服务的 goroutine 全部退出后关闭
+	// served is closed after all serving goroutines exit
+	served chan struct{}
+
+	// stopped 在关闭过程完成后关闭
+	// stopped is closed after the shutdown completes
+	stopped chan struct{}
+
+	// draining 表示服务器正在关闭，健康检查返回失败
+	// draining indicates the server is shutting down, the health check fails
+	draining atomic.Bool
+
+	// drainDelay 是关闭时健康检查开始失败后等待的时间
+	// drainDelay is the time to wait after the health check starts failing on shutdown
+	drainDelay time.Duration
+
+	// signals 是触发优雅关闭的信号
+	// signals are the signals triggering a graceful shutdown
+	signals []os.Signal
+
+	// restartSignals 是触发平滑重启的信号
+	// restartSignals are the signals triggering a graceful restart
+	restartSignals []os.Signal
+
+	// restartTimeout 是重启时等待新进程就绪的超时时间
+	// restartTimeout is the timeout of waiting for the new process to be ready on restart
+	restartTimeout time.Duration
+
+	// restartSettle 是重启时等待刚接受的连接发送第一个请求的最长时间
+	// restartSettle is the longest time of waiting for the connections just accepted to send their first request on restart
+	restartSettle time.Duration
+
+	// restarting 表示是否正在重启
+	// restarting indicates whether a restart is in progress
+	restarting atomic.Bool
+
+	// restarted 表示服务器认领了从旧进程继承的监听器，就绪后需要通知旧进程
+	// restarted indicates the server claims listeners inherited from the old process and needs to notify the old process once ready
+	restarted bool
+
+	// fresh 记录还没有读取第一个请求的连接
+	// fresh records the connections whose first request is not read yet
+	fresh *freshConns
+
+	// mwMu 保护服务器的中间件
+	// mwMu protects the middlewares of the server
+	mwMu sync.Mutex
+
+	// middlewares 是包装整个服务器的中间件
+	// middlewares are the middlewares wrapping the whole server
+	middlewares []Middleware
+
+	// handler 是使用中间件包装后的路由器，可以原子地替换
+	// handler is the router wrapped with the middlewares, it can be replaced atomically
+	handler atomic.Pointer[http.Handler]
+
+	// health 是服务器的健康子系统
+	// health is the health subsystem of the server
+	health *health
+
+	// metrics 是服务器的请求指标，为空表示没有开启指标
+	// metrics are the request metrics of the server, nil means the metrics are disabled
+	metrics *metrics
+
+	// hooksMu 保护关闭钩子
+	// hooksMu protects the shutdown hooks
+	hooksMu sync.Mutex
+
+	// hooks 是关闭钩子，按照注册的顺序排列
+	// hooks are the shutdown hooks, in the order of registration
+	hooks []shutdownHook
+
+	// hookTimeout 是每个关闭钩子的超时时间
+	// hookTimeout is the timeout of each shutdown hook
+	hookTimeout time.Duration
+
+	// shutdownErr 是关闭的结果
+	// shutdownErr is the result of the shutdown
+	shutdownErr error
+
+	// errMu 保护服务的错误
+	// errMu protects the serve error
+	errMu sync.Mutex
+
+	// serveErr 是服务器停止服务的错误
+	// serveErr is the error the server stopped serving with
+	serveErr error
+
 	// wg 用于等待服务器关闭
 	// wg is used to wait for the server to shut down
 	wg *sync.WaitGroup
 
 	// log 是服务器的日志记录器
 	// log is the server's logger
-	log Logger
+	log LeveledLogger
 }
 
-// NewTinyHttpServer 创建一个新的 TinyHttpServer 实例
-// NewTinyHttpServer creates a new TinyHttpServer instance
+// NewTinyHttpServer 创建一个新的 TinyHttpServer 实例并立即启动，启动失败时只记录错误日志
+// NewTinyHttpServer creates a new TinyHttpServer instance and starts it immediately, a start failure is only logged
 func NewTinyHttpServer(port uint16, logger Logger, hcFunc func(w http.ResponseWriter, r *http.Request)) *TinyHttpServer {
-	// 创建一个新的 HTTP 服务路由
-	// Create a new HTTP service route
-	mux := http.NewServeMux()
-
-	// 如果 hcFunc 不为空，则将其作为默认的健康检查 URL 的处理函数
-	// If hcFunc is not nil, use it as the handler function for the default health check URL
-	if hcFunc != nil {
-		mux.HandleFunc(defaultHealthCheckUrl, hcFunc)
-	} else {
-		// 否则，使用默认的健康检查函数处理器
-		// Otherwise, use the default health check function handler
-		mux.HandleFunc(defaultHealthCheckUrl, defaultHealthCheckFuncHandler)
+	// 创建一个新的 TinyHttpServer 实例
+	// Create a new TinyHttpServer instance
+	srv := New(port, logger, hcFunc)
+
+	// 启动服务器，如果启动失败，打印错误信息
+	// Start the server, if it fails to start, print the error message
+	if err := srv.Start(); err != nil {
+		srv.log.Error("http server start failed", "error", err)
+	}
+
+	// 返回新创建的 TinyHttpServer 实例
+	// Return the newly created TinyHttpServer instance
+	return srv
+}
+
+// New 创建一个新的 TinyHttpServer 实例，但不启动它，需要调用 Start 或 Run 启动服务器
+// New creates a new TinyHttpServer instance without starting it, Start or Run must be called to start the server
+func New(port uint16, logger Logger, hcFunc func(w http.ResponseWriter, r *http.Request)) *TinyHttpServer {
+	// 这些选项总是有效的，不会返回错误
+	// These options are always valid, no error is returned
+	srv, _ := NewWithOptions(WithPort(port), WithLogger(logger), WithHealthCheck(hcFunc))
+	return srv
+}
+
+// NewWithOptions 使用选项创建一个新的 TinyHttpServer 实例，但不启动它，选项无效或相互冲突时返回 ErrInvalidOption
+// NewWithOptions creates a new TinyHttpServer instance with options without starting it, ErrInvalidOption is returned if the options are invalid or conflicting
+func NewWithOptions(opts ...Option) (*TinyHttpServer, error) {
+	// 应用所有的选项
+	// Apply all options
+	o := newOptions()
+	for _, opt := range opts {
+		opt(o)
 	}
 
-	// 如果 logger 为空，则使用默认的 logger
-	// If logger is nil, use the default logger
-	if logger == nil {
-		logger = &defaultLogger{}
+	// 检查选项是否有效
+	// Check whether the options are valid
+	addr, err := o.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建一个新的 HTTP 服务路由，未匹配任何路由的请求交给自定义的处理器
+	// Create a new HTTP service route, requests matching no route are passed to the custom handler
+	mux := newRouter()
+	mux.notFound = o.handler
+
+	// 如果 logger 为空，则使用默认的 logger，只有 Errorf 的 logger 会被适配为带级别的 logger
+	// If logger is nil, use the default logger, a logger with only Errorf is adapted to a leveled logger
+	logger := leveled(o.logger)
+
+	// 创建 TLS 配置，证书无法加载时返回错误
+	// Create the TLS configuration, an error is returned if the certificate cannot be loaded
+	var tlsConfig *tls.Config
+	if o.tls != nil {
+		if tlsConfig, err = buildTLSConfig(o.tls, logger); err != nil {
+			return nil, err
+		}
 	}
 
 	// 创建一个新的 TinyHttpServer 实例
 	// Create a new TinyHttpServer instance
 	srv := &TinyHttpServer{
+		// 根路由组
+		// Root route group
+		RouteGroup: &RouteGroup{router: mux},
+
 		// 端口号
 		// Port number
-		port: port,
+		port: o.port,
+
+		// 关闭服务器的宽限期
+		// Grace period for shutting down the server
+		shutdownTimeout: o.shutdownTimeout,
+
+		// 监听器
+		// Listeners
+		listenerSpecs: o.listeners,
+		listenAddr:    o.addressSet || o.portSet,
+		systemd:       o.systemd,
+
+		// 关闭时的排空延迟、信号和钩子超时时间
+		// Drain delay, signals and hook timeout of the shutdown
+		drainDelay:  o.drainDelay,
+		signals:     o.signals,
+		hookTimeout: o.hookTimeout,
+
+		// 重启的信号、超时时间和等待连接的时间
+		// Signals, timeout and settle time of the restart
+		restartSignals: o.restartSignals,
+		restartTimeout: o.restartTimeout,
+		restartSettle:  o.restartSettle,
+		fresh:          newFreshConns(),
 
-		// sync.Once 用于只执行一次初始化
-		// sync.Once is used for one-time initialization
+		// sync.Once 用于只执行一次停止
+		// sync.Once is used for one-time stopping
 		once: &sync.Once{},
 
+		// sync.Once 用于只执行一次启动
+		// sync.Once is used for one-time starting
+		startOnce: &sync.Once{},
+
+		// 服务器就绪和停止的通知通道
+		// Notification channels of the server being ready and stopped
+		ready:   make(chan struct{}),
+		served:  make(chan struct{}),
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+
 		// sync.WaitGroup 用于等待所有的 goroutine 完成
 		// sync.WaitGroup is used to wait for all goroutines to complete
 		wg: &sync.WaitGroup{},
@@ -113,69 +338,282 @@ func NewTinyHttpServer(port uint16, logger Logger, hcFunc func(w http.ResponseWr
 		httpsvr: &http.Server{
 			// 服务器的监听地址
 			// The listening address of the server
-			Addr: fmt.Sprintf("%s:%d", listenAddr, port),
-
-			// 处理 HTTP 请求的路由器
-			// Router that handles HTTP requests
-			Handler: mux,
+			Addr: addr,
 
 			// 服务器空闲超时时间
 			// Server idle timeout
-			IdleTimeout: time.Second * defaultIdleTimeout,
+			IdleTimeout: o.idleTimeout,
 
 			// 读取请求体的超时时间
 			// Timeout for reading the request body
-			ReadTimeout: time.Second * defaultIdleTimeout,
+			ReadTimeout: o.readTimeout,
 
 			// 读取请求头的超时时间
 			// Timeout for reading the request header
-			ReadHeaderTimeout: time.Duration(defaultIdleTimeout/2) * time.Second,
+			ReadHeaderTimeout: o.readHeaderTimeout,
 
 			// 写入响应的超时时间
 			// Timeout for writing the response
-			WriteTimeout: time.Second * defaultIdleTimeout,
+			WriteTimeout: o.writeTimeout,
+
+			// 请求头的最大字节数
+			// Maximum number of bytes of the request header
+			MaxHeaderBytes: o.maxHeaderBytes,
+
+			// 所有请求上下文的父上下文
+			// Parent context of all request contexts
+			BaseContext: func(net.Listener) context.Context { return o.baseContext },
+
+			// TLS 配置，为空时使用 HTTP
+			// TLS configuration, HTTP is used when it is nil
+			TLSConfig: tlsConfig,
 		},
+
+		// 配置了 TLS 时使用 HTTPS
+		// HTTPS is used when TLS is configured
+		useTLS: tlsConfig != nil,
 	}
 
-	// 增加等待组的计数
-	// Increase the count of the wait group
-	srv.wg.Add(1)
-	// 在一个新的 goroutine 中启动 HTTP 服务器
-	// Start the HTTP server in a new goroutine
-	go func() {
-		defer srv.wg.Done()
-		if err := srv.httpsvr.ListenAndServe(); err != nil {
-			// 如果 HTTP 服务器启动失败，打印错误信息
-			// If the HTTP server fails to start, print the error message
-			srv.log.Errorf("http server start failed: %v\n", err)
+	// 如果 hcFunc 不为空，则将其作为默认的健康检查 URL 的处理函数，否则使用默认的健康检查函数处理器。服务器关闭时健康检查返回 503
+	// If hcFunc is not nil, use it as the handler function for the default health check URL, otherwise use the default health check function handler. The health check returns 503 when the server shuts down
+	hcFunc := o.healthCheck
+	if hcFunc == nil {
+		hcFunc = defaultHealthCheckFuncHandler
+	}
+	mux.handle("", defaultHealthCheckUrl, srv.drainAware(hcFunc))
+
+	// 按需开启请求指标并注册指标端点
+	// Enable the request metrics and register the metrics endpoint if required
+	if o.metricsPath != "" {
+		srv.metrics = newMetrics()
+		mux.handle(http.MethodGet, o.metricsPath, srv.metrics)
+	}
+
+	// 服务器使用中间件包装后的路由器处理 HTTP 请求，初始时没有中间件
+	// The server handles HTTP requests with the router wrapped with the middlewares, there is no middleware initially
+	srv.Use()
+	srv.httpsvr.Handler = srv
+
+	// 记录还没有读取第一个请求的连接，重启时旧进程等待它们
+	// Record the connections whose first request is not read yet, the old process waits for them on restart
+	srv.httpsvr.ConnState = srv.fresh.track
+
+	// 按需创建管理端的 http 服务器，它使用独立的处理器，不经过公开的路由和中间件
+	// Create the http server of the admin endpoint if required, it uses a separate handler without the public routes and middlewares
+	if o.admin != nil {
+		srv.adminsvr = &http.Server{
+			Addr:              o.admin.address,
+			Handler:           newAdminHandler(o.admin.token),
+			ReadHeaderTimeout: o.readHeaderTimeout,
+			IdleTimeout:       o.idleTimeout,
 		}
-	}()
+	}
+
+	// 创建健康子系统，并按需注册存活、就绪和启动探针
+	// Create the health subsystem and register the liveness, readiness and startup probes if required
+	srv.health = newHealth(srv.Draining)
+	if o.healthProbes {
+		mux.handle(http.MethodGet, LivenessPath, srv.health.liveness)
+		mux.handle(http.MethodGet, ReadinessPath, srv.health.readiness)
+		mux.handle(http.MethodGet, StartupPath, srv.health.startup)
+	}
 
 	// 返回新创建的 TinyHttpServer 实例
 	// Return the newly created TinyHttpServer instance
-	return srv
+	return srv, nil
 }
 
-// Stop 停止服务器
-// Stop stops the server
-func (s *TinyHttpServer) Stop() {
-	// 使用 sync.Once 确保服务器只停止一次
-	// Use sync.Once to ensure the server only stops once
-	s.once.Do(func() {
-		// 创建一个5秒的超时上下文
-		// Create a timeout context of 5 seconds
-		ctx, cannel := context.WithTimeout(context.Background(), time.Second*5)
-
-		// 尝试关闭http服务器
-		// Try to shutdown the http server
-		if err := s.httpsvr.Shutdown(ctx); err != nil {
-			// 如果关闭失败，记录错误日志
-			// If shutdown fails, log the error
-			s.log.Errorf("http server stop failed` %v\n", err)
+// Start 同步绑定监听地址并在后台开始服务，返回绑定时的错误。服务器只能启动一次，重复调用返回第一次的结果
+// Start binds the listening address synchronously and starts serving in the background, returning the bind error. The server can only be started once, repeated calls return the result of the first call
+func (s *TinyHttpServer) Start() error {
+	s.startOnce.Do(func() {
+		// 读取重启时从旧进程继承的文件，然后打开所有的监听器
+		// Read the files inherited from the old process on restart, then open all listeners
+		inherited, err := inheritedFiles()
+		var listeners []net.Listener
+		var keys []string
+		if err == nil {
+			listeners, keys, err = s.listenAll(inherited)
+		}
+		if err != nil {
+			// 绑定失败，服务器不会提供服务
+			// The bind failed, the server will not serve
+			inherited.abort()
+			s.startErr, s.serveErr = err, err
+			close(s.done)
+			return
+		}
+		s.listeners, s.listenerKeys = listeners, keys
+
+		// 绑定管理端的监听地址，优先使用继承的监听器，失败时关闭公开的监听器
+		// Bind the listening address of the admin endpoint, preferring the inherited listener, the public listener is closed on failure
+		if s.adminsvr != nil {
+			adminLn := s.claim(inherited, fdAdmin, s.adminsvr.Addr)
+			if adminLn == nil {
+				adminLn, err = listen(s.adminsvr.Addr, adminSocketMode)
+			}
+			if err != nil {
+				closeListeners(listeners)
+				inherited.abort()
+				s.startErr, s.serveErr = err, err
+				close(s.done)
+				return
+			}
+			s.adminListener = adminLn
+
+			// 管理端不影响服务器的等待，它随服务器一起关闭
+			// The admin endpoint does not affect waiting for the server, it is shut down together with the server
+			go func() {
+				if err := s.adminsvr.Serve(adminLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					s.log.Error("http admin server serve failed", "error", err)
+				}
+			}()
+		}
+
+		// 在每个监听器上启动 HTTP 服务器
+		// Start the HTTP server on each listener
+		for _, ln := range listeners {
+			// 增加等待组的计数
+			// Increase the count of the wait group
+			s.wg.Add(1)
+
+			// 在一个新的 goroutine 中启动 HTTP 服务器
+			// Start the HTTP server in a new goroutine
+			go func(ln net.Listener) {
+				defer s.wg.Done()
+				if err := s.serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					// 如果 HTTP 服务器异常退出，打印错误信息并记录第一个错误
+					// If the HTTP server exits abnormally, print the error message and record the first error
+					s.log.Error("http server serve failed", "addr", ln.Addr(), "error", err)
+					s.errMu.Lock()
+					if s.serveErr == nil {
+						s.serveErr = err
+					}
+					s.errMu.Unlock()
+				}
+			}(ln)
+		}
+
+		// 所有服务的 goroutine 退出后通知等待者，正在关闭时等待关闭过程完成
+		// Notify the waiters after all serving goroutines exit, waiting for the shutdown to complete when shutting down
+		go func() {
+			s.wg.Wait()
+			close(s.served)
+			if s.draining.Load() {
+				<-s.stopped
+			}
+			close(s.done)
+		}()
+
+		// 在收到信号时优雅地关闭服务器
+		// Shut the server down gracefully when receiving a signal
+		if len(s.signals) > 0 {
+			s.handleSignals()
+		}
+
+		// 在收到重启信号时平滑地重启服务器
+		// Restart the server gracefully when receiving a restart signal
+		if len(s.restartSignals) > 0 {
+			s.handleRestartSignals()
 		}
 
-		// 取消上下文
-		// Cancel the context
-		cannel()
+		// 通知服务器已经就绪，由重启启动时同时通知旧进程
+		// Notify the server is ready, the old process is also notified when started by a restart
+		close(s.ready)
+		if s.restarted {
+			inherited.notifyReady()
+		}
 	})
+
+	// 返回启动的结果
+	// Return the result of starting
+	return s.startErr
+}
+
+// serve 在监听器上提供服务，配置了 TLS 时使用 HTTPS
+// serve serves on the listener, HTTPS is used when TLS is configured
+func (s *TinyHttpServer) serve(ln net.Listener) error {
+	var err error
+	if s.useTLS {
+		// 证书已经在 TLS 配置中，不需要证书文件
+		// The certificates are already in the TLS configuration, no certificate files are needed
+		err = s.httpsvr.ServeTLS(ln, "", "")
+	} else {
+		err = s.httpsvr.Serve(ln)
+	}
+
+	// 重启时监听器在关闭前被提前关闭，这也是正常的停止
+	// On restart the listener is closed ahead of the shutdown, this is also a normal stop
+	if s.draining.Load() && errors.Is(err, net.ErrClosed) {
+		return http.ErrServerClosed
+	}
+	return err
+}
+
+// Run 启动服务器并阻塞直到服务器停止，返回启动或服务时的错误
+// Run starts the server and blocks until the server stops, returning the error of starting or serving
+func (s *TinyHttpServer) Run() error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	return s.Wait()
+}
+
+// Ready 返回一个在服务器开始监听后关闭的通道，启动失败时通道永远不会关闭
+// Ready returns a channel closed after the server starts listening, the channel is never closed if the start fails
+func (s *TinyHttpServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Wait 阻塞直到服务器停止服务，返回服务时的错误，正常停止时返回 nil
+// Wait blocks until the server stops serving, returning the serve error, nil is returned on a normal stop
+func (s *TinyHttpServer) Wait() error {
+	<-s.done
+	return s.serveErr
+}
+
+// Addr 返回服务器实际监听的地址，有多个监听器时返回第一个的地址，服务器未启动时返回 nil
+// Addr returns the address the server actually listens on, the address of the first one is returned when there are several listeners, nil is returned if the server is not started
+func (s *TinyHttpServer) Addr() net.Addr {
+	select {
+	case <-s.ready:
+		return s.listeners[0].Addr()
+	default:
+		return nil
+	}
+}
+
+// Addrs 返回服务器所有监听器实际监听的地址，服务器未启动时返回 nil
+// Addrs returns the addresses all listeners of the server actually listen on, nil is returned if the server is not started
+func (s *TinyHttpServer) Addrs() []net.Addr {
+	select {
+	case <-s.ready:
+		addrs := make([]net.Addr, 0, len(s.listeners))
+		for _, ln := range s.listeners {
+			addrs = append(addrs, ln.Addr())
+		}
+		return addrs
+	default:
+		return nil
+	}
+}
+
+// Stop 优雅地关闭服务器，关闭中的超时只记录错误日志，需要关闭结果时使用 Shutdown
+// Stop shuts the server down gracefully, timeouts during the shutdown are only logged, use Shutdown when the result is needed
+func (s *TinyHttpServer) Stop() {
+	if err := s.Shutdown(); err != nil {
+		s.log.Error("http server stop failed", "error", err)
+	}
+}
+
+// drainAware 包装健康检查，服务器关闭时返回 503
+// drainAware wraps the health check, 503 is returned when the server shuts down
+func (s *TinyHttpServer) drainAware(hcFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		hcFunc(w, r)
+	}
 }
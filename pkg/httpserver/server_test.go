@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// get sends a GET request to the server and returns the status code and body
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if !assert.NoError(t, err) {
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestTinyHttpServer_StartWaitStop(t *testing.T) {
+	// Create a server on a random port without starting it
+	srv := New(0, nil, nil)
+	assert.Nil(t, srv.Addr())
+
+	// Start the server
+	assert.NoError(t, srv.Start())
+	assert.NoError(t, srv.Start())
+	select {
+	case <-srv.Ready():
+	default:
+		t.Fatal("server is not ready after start")
+	}
+
+	// Verify the health check is served
+	code, body := get(t, fmt.Sprintf("http://%s/ping", srv.Addr()))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok!!", body)
+
+	// Stop the server and wait for it
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- srv.Wait() }()
+	srv.Stop()
+	select {
+	case err := <-waitErr:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return after stop")
+	}
+}
+
+func TestTinyHttpServer_BindError(t *testing.T) {
+	// Occupy a port
+	ln, err := net.Listen("tcp", "0.0.0.0:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+
+	// Start a server on the same port
+	srv := New(port, nil, nil)
+	err = srv.Start()
+	assert.Error(t, err)
+
+	// Run and Wait return the bind error
+	assert.Equal(t, err, srv.Run())
+	assert.Equal(t, err, srv.Wait())
+	select {
+	case <-srv.Ready():
+		t.Fatal("server is ready after a bind error")
+	default:
+	}
+}
+
+func TestTinyHttpServer_StopBeforeStart(t *testing.T) {
+	// Stop a server which has not been started
+	srv := New(0, nil, nil)
+	srv.Stop()
+
+	// The server can no longer be started
+	assert.ErrorIs(t, srv.Start(), http.ErrServerClosed)
+	assert.NoError(t, srv.Wait())
+}
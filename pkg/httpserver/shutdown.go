@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultHookTimeout 是默认的关闭钩子超时时间（秒）
+	// defaultHookTimeout is the default timeout of a shutdown hook in seconds
+	defaultHookTimeout = 5
+)
+
+// ShutdownHook 是服务器关闭时调用的钩子，上下文在钩子超时后取消
+// ShutdownHook is a hook called when the server shuts down, the context is cancelled after the hook times out
+type ShutdownHook func(ctx context.Context) error
+
+// shutdownHook 是一个带名称的关闭钩子
+// shutdownHook is a named shutdown hook
+type shutdownHook struct {
+	// name 是钩子的名称，用于报告错误
+	// name is the name of the hook, used to report errors
+	name string
+
+	// fn 是钩子的函数
+	// fn is the function of the hook
+	fn ShutdownHook
+}
+
+// HookError 是一个关闭钩子的错误
+// HookError is the error of a shutdown hook
+type HookError struct {
+	// Name 是钩子的名称
+	// Name is the name of the hook
+	Name string
+
+	// Err 是钩子返回的错误，超时时是 context.DeadlineExceeded
+	// Err is the error returned by the hook, it is context.DeadlineExceeded on timeout
+	Err error
+}
+
+// TimedOut 返回钩子是否超时
+// TimedOut returns whether the hook timed out
+func (e HookError) TimedOut() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// ShutdownError 报告关闭过程中未能在宽限期内关闭的连接和失败或超时的钩子
+// ShutdownError reports the connections not closed within the grace period and the hooks failed or timed out during the shutdown
+type ShutdownError struct {
+	// ConnectionsTimedOut 表示宽限期结束时仍有活跃的连接，这些连接被强制关闭
+	// ConnectionsTimedOut indicates there were still active connections when the grace period ended, these connections were closed forcibly
+	ConnectionsTimedOut bool
+
+	// Hooks 是失败或超时的钩子，按照注册的顺序排列
+	// Hooks are the hooks failed or timed out, in the order of registration
+	Hooks []HookError
+}
+
+// Error 返回错误的描述
+// Error returns the description of the error
+func (e *ShutdownError) Error() string {
+	parts := make([]string, 0, len(e.Hooks)+1)
+	if e.ConnectionsTimedOut {
+		parts = append(parts, "connections did not close within the grace period")
+	}
+	for _, hook := range e.Hooks {
+		if hook.TimedOut() {
+			parts = append(parts, fmt.Sprintf("hook %q timed out", hook.Name))
+		} else {
+			parts = append(parts, fmt.Sprintf("hook %q failed: %v", hook.Name, hook.Err))
+		}
+	}
+	return "http server shutdown: " + strings.Join(parts, "; ")
+}
+
+// WithSignals 让服务器在收到指定的信号时自行优雅关闭，未指定信号时使用 SIGINT 和 SIGTERM
+// WithSignals makes the server shut itself down gracefully when receiving the given signals, SIGINT and SIGTERM are used when no signal is given
+func WithSignals(signals ...os.Signal) Option {
+	return func(o *options) {
+		if len(signals) == 0 {
+			signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+		}
+		o.signals = signals
+	}
+}
+
+// WithDrainDelay 设置关闭时健康检查开始失败后等待的时间，让负载均衡器在连接关闭前摘除服务器，默认不等待
+// WithDrainDelay sets the time to wait after the health check starts failing on shutdown, letting load balancers remove the server before connections are closed, the default is no wait
+func WithDrainDelay(delay time.Duration) Option {
+	return func(o *options) {
+		o.drainDelay = delay
+	}
+}
+
+// WithShutdownHookTimeout 设置每个关闭钩子的超时时间，默认是 5 秒
+// WithShutdownHookTimeout sets the timeout of each shutdown hook, the default is 5 seconds
+func WithShutdownHookTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.hookTimeout = timeout
+	}
+}
+
+// OnShutdown 注册一个关闭钩子，钩子在所有连接关闭后按照注册的顺序依次调用，例如用于关闭数据库连接
+// OnShutdown registers a shutdown hook, the hooks are called one by one in the order of registration after all connections are closed, such as to close database connections
+func (s *TinyHttpServer) OnShutdown(name string, hook ShutdownHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks = append(s.hooks, shutdownHook{name: name, fn: hook})
+}
+
+// Draining 返回服务器是否正在关闭，关闭开始后健康检查返回 503
+// Draining returns whether the server is shutting down, the health check returns 503 after the shutdown starts
+func (s *TinyHttpServer) Draining() bool {
+	return s.draining.Load()
+}
+
+// Shutdown 优雅地关闭服务器并返回关闭的结果。健康检查先开始失败，等待排空延迟后在宽限期内关闭连接，最后依次调用关闭钩子。
+// 有连接或钩子超时时返回 *ShutdownError。服务器只关闭一次，重复调用返回第一次的结果
+// Shutdown shuts the server down gracefully and returns the result of the shutdown. The health check starts failing first, then the connections are closed within the grace period after the drain delay, and finally the shutdown hooks are called one by one.
+// A *ShutdownError is returned if connections or hooks time out. The server only shuts down once, repeated calls return the result of the first call
+func (s *TinyHttpServer) Shutdown() error {
+	// 使用 sync.Once 确保服务器只停止一次
+	// Use sync.Once to ensure the server only stops once
+	s.once.Do(func() {
+		defer close(s.stopped)
+
+		// 如果服务器还没有启动，阻止它再启动
+		// If the server has not been started yet, prevent it from starting
+		started := true
+		s.startOnce.Do(func() {
+			started = false
+			s.startErr = http.ErrServerClosed
+			close(s.done)
+		})
+
+		// 让健康检查开始失败，并等待负载均衡器摘除服务器
+		// Make the health check start failing and wait for load balancers to remove the server
+		s.draining.Store(true)
+		if started && s.startErr == nil && s.drainDelay > 0 {
+			time.Sleep(s.drainDelay)
+		}
+
+		// 在宽限期内关闭连接，超时后强制关闭剩余的连接
+		// Close the connections within the grace period, the remaining connections are closed forcibly after the timeout
+		report := &ShutdownError{}
+		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		if err := s.httpsvr.Shutdown(ctx); err != nil {
+			report.ConnectionsTimedOut = errors.Is(err, context.DeadlineExceeded)
+			if !report.ConnectionsTimedOut {
+				s.log.Error("http server stop failed", "error", err)
+			}
+			_ = s.httpsvr.Close()
+		}
+		// 在同一个宽限期内关闭管理端
+		// Shut the admin endpoint down within the same grace period
+		if s.adminsvr != nil {
+			if err := s.adminsvr.Shutdown(ctx); err != nil {
+				_ = s.adminsvr.Close()
+			}
+		}
+		cancel()
+
+		// 依次调用关闭钩子
+		// Call the shutdown hooks one by one
+		s.hooksMu.Lock()
+		hooks := append([]shutdownHook(nil), s.hooks...)
+		s.hooksMu.Unlock()
+		for _, hook := range hooks {
+			if err := s.runHook(hook); err != nil {
+				report.Hooks = append(report.Hooks, HookError{Name: hook.name, Err: err})
+			}
+		}
+
+		// 记录关闭的结果
+		// Record the result of the shutdown
+		if report.ConnectionsTimedOut || len(report.Hooks) > 0 {
+			s.shutdownErr = report
+		}
+	})
+
+	// 等待第一次关闭完成并返回结果
+	// Wait for the first shutdown to complete and return the result
+	<-s.stopped
+	return s.shutdownErr
+}
+
+// runHook 在超时时间内调用关闭钩子，钩子没有及时返回时不再等待它
+// runHook calls the shutdown hook within the timeout, the hook is no longer waited for if it does not return in time
+func (s *TinyHttpServer) runHook(hook shutdownHook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.hookTimeout)
+	defer cancel()
+
+	// 在新的 goroutine 中调用钩子，避免阻塞的钩子拖住关闭过程
+	// Call the hook in a new goroutine to avoid a blocking hook holding up the shutdown
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				result <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		result <- hook.fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleSignals 开始接收信号，并在收到信号时关闭服务器，服务器停止服务后不再接收信号。信号在返回前已经开始接收
+// handleSignals starts receiving the signals and shuts the server down when receiving a signal, the signals are no longer received after the server stops serving. The signals are received before it returns
+func (s *TinyHttpServer) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, s.signals...)
+	go s.waitSignal(ch)
+}
+
+// waitSignal 等待信号并关闭服务器
+// waitSignal waits for a signal and shuts the server down
+func (s *TinyHttpServer) waitSignal(ch chan os.Signal) {
+	defer signal.Stop(ch)
+
+	select {
+	case sig := <-ch:
+		// 收到信号，优雅地关闭服务器
+		// A signal is received, shut the server down gracefully
+		s.log.Info("http server received signal, shutting down", "signal", sig)
+		if err := s.Shutdown(); err != nil {
+			s.log.Error("http server stop failed", "error", err)
+		}
+	case <-s.served:
+	}
+}
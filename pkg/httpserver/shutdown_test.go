@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTinyHttpServer_ShutdownDrain(t *testing.T) {
+	// Start a server with a drain delay
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithDrainDelay(200*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	url := fmt.Sprintf("http://%s/ping", srv.Addr())
+
+	// Register hooks recording their order
+	var mu sync.Mutex
+	var order []string
+	for _, name := range []string{"first", "second"} {
+		name := name
+		srv.OnShutdown(name, func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	// Shut the server down in the background
+	code, _ := get(t, url)
+	assert.Equal(t, http.StatusOK, code)
+	result := make(chan error, 1)
+	go func() { result <- srv.Shutdown() }()
+
+	// The health check fails during the drain delay while the server still serves
+	assert.Eventually(t, srv.Draining, time.Second, 5*time.Millisecond)
+	code, _ = get(t, url)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// Wait returns after the hooks are called in order
+	assert.NoError(t, srv.Wait())
+	mu.Lock()
+	assert.Equal(t, []string{"first", "second"}, order)
+	mu.Unlock()
+	assert.NoError(t, <-result)
+
+	// Repeated calls return the same result
+	assert.NoError(t, srv.Shutdown())
+}
+
+func TestTinyHttpServer_ShutdownTimeouts(t *testing.T) {
+	// Start a server with a short grace period and hook timeout
+	srv, err := NewWithOptions(
+		WithAddress("127.0.0.1:0"),
+		WithShutdownTimeout(50*time.Millisecond),
+		WithShutdownHookTimeout(50*time.Millisecond),
+	)
+	assert.NoError(t, err)
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{})
+	srv.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+	assert.NoError(t, srv.Start())
+
+	// Register hooks which block, fail and succeed
+	srv.OnShutdown("blocking", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	srv.OnShutdown("failing", func(context.Context) error { return errors.New("boom") })
+	srv.OnShutdown("fine", func(context.Context) error { return nil })
+
+	// Keep a request in flight
+	go func() {
+		if resp, err := http.Get(fmt.Sprintf("http://%s/slow", srv.Addr())); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	// The shutdown reports the timed out connections and the failed hooks
+	err = srv.Shutdown()
+	var report *ShutdownError
+	if assert.ErrorAs(t, err, &report) {
+		assert.True(t, report.ConnectionsTimedOut)
+		assert.Len(t, report.Hooks, 2)
+		assert.Equal(t, "blocking", report.Hooks[0].Name)
+		assert.True(t, report.Hooks[0].TimedOut())
+		assert.Equal(t, "failing", report.Hooks[1].Name)
+		assert.False(t, report.Hooks[1].TimedOut())
+	}
+	assert.Equal(t, `http server shutdown: connections did not close within the grace period; hook "blocking" timed out; hook "failing" failed: boom`, err.Error())
+}
+
+func TestNewWithOptions_InvalidShutdown(t *testing.T) {
+	tests := map[string][]Option{
+		"negative drain delay": {WithDrainDelay(-time.Second)},
+		"zero hook timeout":    {WithShutdownHookTimeout(0)},
+	}
+	for name, opts := range tests {
+		srv, err := NewWithOptions(opts...)
+		assert.ErrorIs(t, err, ErrInvalidOption, name)
+		assert.Nil(t, srv, name)
+	}
+}
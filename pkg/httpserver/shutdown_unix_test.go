@@ -0,0 +1,39 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTinyHttpServer_ShutdownOnSignal(t *testing.T) {
+	// Start a server handling SIGUSR1
+	srv, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSignals(syscall.SIGUSR1))
+	assert.NoError(t, err)
+	called := make(chan struct{})
+	srv.OnShutdown("hook", func(context.Context) error {
+		close(called)
+		return nil
+	})
+
+	// Run the server and send the signal to the process
+	result := make(chan error, 1)
+	go func() { result <- srv.Run() }()
+	<-srv.Ready()
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+
+	// The server shuts itself down and calls the hook
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down on signal")
+	}
+	<-called
+	assert.True(t, srv.Draining())
+}
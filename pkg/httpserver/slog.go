@@ -0,0 +1,56 @@
+//go:build go1.21
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// slogLogger 是基于 log/slog 的 LeveledLogger
+// slogLogger is a LeveledLogger based on log/slog
+type slogLogger struct {
+	// logger 是底层的 slog 日志记录器
+	// logger is the underlying slog logger
+	logger *slog.Logger
+}
+
+// NewSlogLogger 将 slog.Logger 适配为 LeveledLogger，可以通过 WithLogger 设置为服务器的日志记录器。logger 为空时使用 slog.Default()
+// NewSlogLogger adapts a slog.Logger to a LeveledLogger, it can be set as the logger of the server with WithLogger. slog.Default() is used when logger is nil
+func NewSlogLogger(logger *slog.Logger) LeveledLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+// Errorf 以错误级别记录格式化的消息
+// Errorf records the formatted message at error level
+func (l *slogLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+}
+
+// Debug 以调试级别记录日志
+// Debug records a log at debug level
+func (l *slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+// Info 以信息级别记录日志
+// Info records a log at info level
+func (l *slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+// Warn 以警告级别记录日志
+// Warn records a log at warning level
+func (l *slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+// Error 以错误级别记录日志
+// Error records a log at error level
+func (l *slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
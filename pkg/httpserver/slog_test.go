@@ -0,0 +1,39 @@
+//go:build go1.21
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	// decode returns the last record written
+	decode := func() map[string]interface{} {
+		record := map[string]interface{}{}
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		assert.NoError(t, json.Unmarshal(lines[len(lines)-1], &record))
+		return record
+	}
+
+	// Leveled logs keep the level and the fields
+	logger.Warn("slow request", "path", "/items", "status", 200)
+	record := decode()
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "slow request", record["msg"])
+	assert.Equal(t, "/items", record["path"])
+	assert.Equal(t, float64(200), record["status"])
+
+	// Errorf records the formatted message at error level
+	logger.Errorf("start failed: %v\n", "port in use")
+	record = decode()
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "start failed: port in use", record["msg"])
+}
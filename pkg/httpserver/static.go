@@ -0,0 +1,336 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultIndexFile 是目录的默认索引文件
+	// defaultIndexFile is the default index file of directories
+	defaultIndexFile = "index.html"
+
+	// gzipSuffix 是预压缩文件的后缀
+	// gzipSuffix is the suffix of the precompressed files
+	gzipSuffix = ".gz"
+)
+
+// StaticOption 是静态文件处理器的配置选项
+// StaticOption is a configuration option of the static file handler
+type StaticOption func(*staticHandler)
+
+// WithDirectoryListing 开启目录列表，没有索引文件的目录返回文件列表，默认关闭并返回 404
+// WithDirectoryListing enables the directory listing, directories without an index file return the file list, it is disabled by default and 404 is returned
+func WithDirectoryListing() StaticOption {
+	return func(h *staticHandler) {
+		h.listing = true
+	}
+}
+
+// WithHiddenFiles 允许访问以 . 开头的文件和目录，例如 .well-known，默认返回 404 以免泄露 .env 或 .git 等文件
+// WithHiddenFiles allows access to files and directories starting with ., such as .well-known, 404 is returned by default so that files such as .env or .git are not leaked
+func WithHiddenFiles() StaticOption {
+	return func(h *staticHandler) {
+		h.hidden = true
+	}
+}
+
+// WithoutPrecompressed 关闭预压缩文件。默认在客户端接受 gzip 且存在同名的 .gz 文件时发送 .gz 文件的内容
+// WithoutPrecompressed disables the precompressed files. By default the content of the .gz file is sent when the client accepts gzip and a .gz file with the same name exists
+func WithoutPrecompressed() StaticOption {
+	return func(h *staticHandler) {
+		h.precompressed = false
+	}
+}
+
+// WithCacheControl 设置文件响应的 Cache-Control 响应头，例如对带有哈希的资源使用 "public, max-age=31536000, immutable"，默认不设置，由 ETag 和 Last-Modified 验证缓存
+// WithCacheControl sets the Cache-Control header of file responses, such as "public, max-age=31536000, immutable" for assets with hashes, it is not set by default and caches are validated with ETag and Last-Modified
+func WithCacheControl(value string) StaticOption {
+	return func(h *staticHandler) {
+		h.cacheControl = value
+	}
+}
+
+// WithSPAFallback 开启单页应用模式：没有扩展名的未知路径返回 index 文件，使前端路由可以处理它们。
+// 以 excludes 中的前缀开头的路径（例如 "/api/"）仍然返回 404。index 文件总是带有 Cache-Control: no-cache，使新的版本立即生效
+// WithSPAFallback enables the single page application mode: unknown paths without an extension return the index file so that the frontend router can handle them.
+// Paths starting with the prefixes in excludes (such as "/api/") still return 404. The index file always carries Cache-Control: no-cache so that new versions take effect immediately
+func WithSPAFallback(index string, excludes ...string) StaticOption {
+	return func(h *staticHandler) {
+		h.spaIndex = strings.TrimPrefix(path.Clean("/"+index), "/")
+		h.spaExcludes = append(h.spaExcludes, excludes...)
+	}
+}
+
+// staticHandler 从文件系统提供静态文件
+// staticHandler serves static files from a file system
+type staticHandler struct {
+	// fsys 是文件所在的文件系统
+	// fsys is the file system of the files
+	fsys fs.FS
+
+	// listing 表示是否开启目录列表
+	// listing indicates whether the directory listing is enabled
+	listing bool
+
+	// hidden 表示是否允许访问以 . 开头的文件
+	// hidden indicates whether files starting with . are accessible
+	hidden bool
+
+	// precompressed 表示是否使用预压缩的 .gz 文件
+	// precompressed indicates whether the precompressed .gz files are used
+	precompressed bool
+
+	// cacheControl 是文件响应的 Cache-Control 响应头
+	// cacheControl is the Cache-Control header of file responses
+	cacheControl string
+
+	// spaIndex 是单页应用的 index 文件，为空表示不开启单页应用模式
+	// spaIndex is the index file of the single page application, empty means the mode is disabled
+	spaIndex string
+
+	// spaExcludes 是不回退到 index 文件的路径前缀
+	// spaExcludes are the path prefixes not falling back to the index file
+	spaExcludes []string
+
+	// digests 缓存没有修改时间的文件的内容摘要，例如 embed.FS 中的文件，这些文件不会变化
+	// digests caches the content digests of files without a modification time, such as files in embed.FS, these files never change
+	digests sync.Map
+}
+
+// Static 返回一个从 fsys 提供静态文件的处理器，fsys 可以是 embed.FS 或者 os.DirFS。请求路径相对于 fsys 的根目录，
+// 挂载在子路径时使用 http.StripPrefix 去掉前缀。响应带有 ETag 和 Last-Modified，支持条件请求和 Range 请求，
+// 目录返回其中的 index.html，目录列表默认关闭。只接受 GET 和 HEAD 请求
+// Static returns a handler serving static files from fsys, fsys can be an embed.FS or an os.DirFS. Request paths are relative to the root of fsys,
+// use http.StripPrefix to remove the prefix when mounted on a sub path. Responses carry ETag and Last-Modified, conditional and Range requests are supported,
+// directories return the index.html in them, the directory listing is disabled by default. Only GET and HEAD requests are accepted
+func Static(fsys fs.FS, opts ...StaticOption) http.Handler {
+	h := &staticHandler{fsys: fsys, precompressed: true}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// StaticDir 返回一个从本地目录 dir 提供静态文件的处理器
+// StaticDir returns a handler serving static files from the local directory dir
+func StaticDir(dir string, opts ...StaticOption) http.Handler {
+	return Static(os.DirFS(dir), opts...)
+}
+
+// ServeHTTP 处理静态文件请求
+// ServeHTTP handles the static file requests
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 清理路径，拒绝隐藏文件
+	// Clean the path and reject hidden files
+	urlPath := path.Clean("/" + r.URL.Path)
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" {
+		name = "."
+	}
+	if !h.hidden && hasHiddenSegment(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := fs.Stat(h.fsys, name)
+	switch {
+	case err != nil:
+		h.fallback(w, r, urlPath)
+	case info.IsDir():
+		h.serveDir(w, r, name)
+	default:
+		h.serveFile(w, r, name, h.cacheControl)
+	}
+}
+
+// serveDir 提供目录中的 index.html，没有时返回目录列表或者 404
+// serveDir serves the index.html in the directory, the directory listing or 404 is returned when there is none
+func (h *staticHandler) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	// 目录必须以 / 结尾，使页面中的相对链接正确。直接设置相对地址而不使用 http.Redirect，因为后者会按照 http.StripPrefix 去掉前缀后的路径解析地址
+	// Directories must end with / so that the relative links in pages are correct. The relative location is set directly instead of using http.Redirect, which resolves it against the path stripped by http.StripPrefix
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		target := path.Base(r.URL.Path) + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	index := path.Join(name, defaultIndexFile)
+	if info, err := fs.Stat(h.fsys, index); err == nil && !info.IsDir() {
+		h.serveFile(w, r, index, h.cacheControl)
+		return
+	}
+	if h.listing {
+		h.serveListing(w, r, name)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// serveListing 以 HTML 返回目录中的文件列表，隐藏文件不列出
+// serveListing returns the list of files in the directory as HTML, hidden files are not listed
+func (h *staticHandler) serveListing(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if !h.hidden && strings.HasPrefix(entryName, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := (&url.URL{Path: entryName}).String()
+		fmt.Fprintf(buf, "<a href=\"%s\">%s</a>\n", htmlEscaper.Replace(link), htmlEscaper.Replace(entryName))
+	}
+	buf.WriteString("</pre>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// fallback 处理不存在的路径，单页应用模式下没有扩展名且不在排除列表中的路径返回 index 文件
+// fallback handles paths which do not exist, in the single page application mode the paths without an extension and not excluded return the index file
+func (h *staticHandler) fallback(w http.ResponseWriter, r *http.Request, urlPath string) {
+	if h.spaIndex == "" || path.Ext(urlPath) != "" {
+		http.NotFound(w, r)
+		return
+	}
+	for _, prefix := range h.spaExcludes {
+		if strings.HasPrefix(urlPath, prefix) || urlPath+"/" == prefix {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	h.serveFile(w, r, h.spaIndex, "no-cache")
+}
+
+// serveFile 提供文件的内容，客户端接受 gzip 时优先使用预压缩的 .gz 文件
+// serveFile serves the content of the file, the precompressed .gz file is preferred when the client accepts gzip
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name, cacheControl string) {
+	header := w.Header()
+	contentType := mime.TypeByExtension(path.Ext(name))
+	served := name
+
+	// 预压缩的内容需要已知的内容类型，否则会按照压缩后的数据探测类型
+	// The precompressed content requires a known content type, otherwise the type would be sniffed from the compressed data
+	if h.precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		if contentType != "" && acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			if info, err := fs.Stat(h.fsys, name+gzipSuffix); err == nil && !info.IsDir() {
+				served = name + gzipSuffix
+				header.Set("Content-Encoding", "gzip")
+			}
+		}
+	}
+
+	f, err := h.fsys.Open(served)
+	if err != nil {
+		header.Del("Content-Encoding")
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		header.Del("Content-Encoding")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// 文件不支持 Seek 时读取到内存中
+	// Read the file into memory when it does not support Seek
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			header.Del("Content-Encoding")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	etag, err := h.etag(served, info, content)
+	if err != nil {
+		header.Del("Content-Encoding")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	header.Set("ETag", etag)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag 返回文件的 ETag。有修改时间的文件使用大小和修改时间，没有修改时间的文件使用内容的摘要并缓存
+// etag returns the ETag of the file. Files with a modification time use the size and the modification time, files without one use the digest of the content, which is cached
+func (h *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	}
+	if etag, ok := h.digests.Load(name); ok {
+		return etag.(string), nil
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(digest.Sum(nil)[:16]) + `"`
+	h.digests.Store(name, etag)
+	return etag, nil
+}
+
+// acceptsGzip 检查客户端是否接受 gzip 编码
+// acceptsGzip checks whether the client accepts the gzip coding
+func acceptsGzip(accept string) bool {
+	return encodingQuality(parseAcceptEncoding(accept), encodingGzip) > 0
+}
+
+// hasHiddenSegment 检查路径中是否有以 . 开头的部分
+// hasHiddenSegment checks whether any segment of the path starts with .
+func hasHiddenSegment(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") && segment != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlEscaper 转义目录列表中的文件名
+// htmlEscaper escapes the file names in the directory listing
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;")
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles writes the files with the contents under the directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+}
+
+func TestStaticDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app.js":           "console.log('app')",
+		"docs/index.html":  "<h1>docs</h1>",
+		"assets/logo.txt":  "logo",
+		".env":             "SECRET=1",
+		".git/config":      "[core]",
+		"docs/.hidden.txt": "hidden",
+	})
+	handler := StaticDir(dir, WithCacheControl("public, max-age=60"))
+
+	// Files are served with the content type, the validators and the cache control
+	w := serve(handler, http.MethodGet, "/app.js")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "console.log('app')", w.Body.String())
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") || strings.HasPrefix(w.Header().Get("Content-Type"), "application/javascript"))
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Conditional requests are answered with 304
+	w = serve(handler, http.MethodGet, "/app.js", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// Range requests are supported
+	w = serve(handler, http.MethodGet, "/app.js", "Range", "bytes=0-6")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "console", w.Body.String())
+
+	// Directories are redirected to the path with a trailing slash and serve their index
+	w = serve(handler, http.MethodGet, "/docs?v=1")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "docs/?v=1", w.Header().Get("Location"))
+	w = serve(handler, http.MethodGet, "/docs/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>docs</h1>", w.Body.String())
+
+	// The relative redirect works when mounted with http.StripPrefix
+	mounted := http.StripPrefix("/static", handler)
+	assert.Equal(t, "docs/", serve(mounted, http.MethodGet, "/static/docs").Header().Get("Location"))
+	assert.Equal(t, "<h1>docs</h1>", serve(mounted, http.MethodGet, "/static/docs/").Body.String())
+
+	// Directories without an index, missing files, hidden files and traversals return 404
+	for _, target := range []string{"/assets/", "/missing.js", "/.env", "/.git/config", "/docs/.hidden.txt", "/../" + filepath.Base(dir) + "/app.js"} {
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, target).Code, target)
+	}
+
+	// Only GET and HEAD are accepted
+	w = serve(handler, http.MethodPost, "/app.js")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	w = serve(handler, http.MethodHead, "/app.js")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestStatic_Listing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"assets/a&b.txt":    {Data: []byte("a")},
+		"assets/img/x.png":  {Data: []byte("x")},
+		"assets/.gitignore": {Data: []byte("*")},
+	}
+
+	// The listing is disabled by default
+	assert.Equal(t, http.StatusNotFound, serve(Static(fsys), http.MethodGet, "/assets/").Code)
+
+	// The listing escapes the names and skips hidden files
+	w := serve(Static(fsys, WithDirectoryListing()), http.MethodGet, "/assets/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<a href="a&amp;b.txt">a&amp;b.txt</a>`)
+	assert.Contains(t, w.Body.String(), `<a href="img/">img/</a>`)
+	assert.NotContains(t, w.Body.String(), ".gitignore")
+
+	// Hidden files can be allowed
+	w = serve(Static(fsys, WithDirectoryListing(), WithHiddenFiles()), http.MethodGet, "/assets/")
+	assert.Contains(t, w.Body.String(), ".gitignore")
+	assert.Equal(t, "*", serve(Static(fsys, WithHiddenFiles()), http.MethodGet, "/assets/.gitignore").Body.String())
+}
+
+func TestStatic_Precompressed(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("plain"), ModTime: modTime},
+		"app.js.gz": {Data: []byte("compressed"), ModTime: modTime},
+		"data.bin":  {Data: []byte("plain"), ModTime: modTime},
+	}
+
+	// The .gz file is served when the client accepts gzip
+	w := serve(Static(fsys), http.MethodGet, "/app.js", "Accept-Encoding", "br, gzip")
+	assert.Equal(t, "compressed", w.Body.String())
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.True(t, strings.HasSuffix(w.Header().Get("Content-Type"), "javascript; charset=utf-8"))
+	gzipETag := w.Header().Get("ETag")
+
+	// Clients without gzip, disabled precompression and unknown types receive the original file
+	for _, w := range []*httptest.ResponseRecorder{
+		serve(Static(fsys), http.MethodGet, "/app.js"),
+		serve(Static(fsys), http.MethodGet, "/app.js", "Accept-Encoding", "gzip;q=0"),
+		serve(Static(fsys, WithoutPrecompressed()), http.MethodGet, "/app.js", "Accept-Encoding", "gzip"),
+		serve(Static(fsys), http.MethodGet, "/data.bin", "Accept-Encoding", "gzip"),
+	} {
+		assert.Equal(t, "plain", w.Body.String())
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.NotEqual(t, gzipETag, w.Header().Get("ETag"))
+	}
+}
+
+func TestStatic_EmbedETag(t *testing.T) {
+	// Files without a modification time, like those in embed.FS, use the digest of the content
+	fsys := fstest.MapFS{"index.html": {Data: []byte("<h1>home</h1>")}}
+	handler := Static(fsys)
+	w := serve(handler, http.MethodGet, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+	etag := w.Header().Get("ETag")
+	assert.Len(t, etag, 34)
+	assert.Equal(t, etag, serve(handler, http.MethodGet, "/index.html").Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, serve(handler, http.MethodGet, "/", "If-None-Match", etag).Code)
+}
+
+func TestStatic_SPAFallback(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("<div id=app></div>")},
+		"assets/app.js":  {Data: []byte("app")},
+		"robots.txt":     {Data: []byte("robots")},
+		"docs/page.html": {Data: []byte("page")},
+	}
+	handler := Static(fsys, WithSPAFallback("index.html", "/api/"), WithCacheControl("public, max-age=31536000, immutable"))
+
+	// Unknown paths without an extension return the index without caching
+	for _, target := range []string{"/orders/42", "/settings"} {
+		w := serve(handler, http.MethodGet, target)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, "<div id=app></div>", w.Body.String())
+		assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	}
+
+	// Existing directories are still redirected
+	assert.Equal(t, http.StatusMovedPermanently, serve(handler, http.MethodGet, "/docs").Code)
+
+	// Existing files keep their cache control
+	w := serve(handler, http.MethodGet, "/assets/app.js")
+	assert.Equal(t, "app", w.Body.String())
+	assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	// Missing assets and excluded paths return 404
+	for _, target := range []string{"/assets/missing.js", "/favicon.ico", "/api/orders", "/api"} {
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, target).Code, target)
+	}
+}
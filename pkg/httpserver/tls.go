@@ -0,0 +1,327 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTLSReloadInterval 是默认的证书文件变化检查间隔（秒）
+	// defaultTLSReloadInterval is the default interval for checking changes of the certificate files in seconds
+	defaultTLSReloadInterval = 10
+)
+
+// tlsOptions 是 TLS 的配置
+// tlsOptions is the configuration of TLS
+type tlsOptions struct {
+	// certFile 是证书文件的路径
+	// certFile is the path of the certificate file
+	certFile string
+
+	// keyFile 是私钥文件的路径
+	// keyFile is the path of the private key file
+	keyFile string
+
+	// certificates 是内存中的证书
+	// certificates are the in-memory certificates
+	certificates []tls.Certificate
+
+	// minVersion 是允许的最低 TLS 版本
+	// minVersion is the minimum TLS version allowed
+	minVersion uint16
+
+	// cipherSuites 是允许的加密套件，为空时使用 Go 的默认值
+	// cipherSuites are the cipher suites allowed, the Go defaults are used when empty
+	cipherSuites []uint16
+
+	// reloadInterval 是检查证书文件变化的间隔
+	// reloadInterval is the interval for checking changes of the certificate files
+	reloadInterval time.Duration
+
+	// clientCAFiles 是验证客户端证书的 CA 文件
+	// clientCAFiles are the CA files used to verify client certificates
+	clientCAFiles []string
+
+	// clientCAs 是验证客户端证书的 CA 池
+	// clientCAs is the CA pool used to verify client certificates
+	clientCAs *x509.CertPool
+
+	// clientAuth 是客户端证书的验证策略
+	// clientAuth is the verification policy of client certificates
+	clientAuth tls.ClientAuthType
+
+	// clientAuthSet 表示验证策略是否通过 WithClientAuth 设置
+	// clientAuthSet indicates whether the verification policy is set by WithClientAuth
+	clientAuthSet bool
+}
+
+// tlsOpts 返回 TLS 的配置，不存在时创建一个
+// tlsOpts returns the configuration of TLS, creating one if it does not exist
+func (o *options) tlsOpts() *tlsOptions {
+	if o.tls == nil {
+		o.tls = &tlsOptions{minVersion: tls.VersionTLS12, reloadInterval: time.Second * defaultTLSReloadInterval}
+	}
+	return o.tls
+}
+
+// WithTLSCertFiles 使用证书和私钥文件开启 HTTPS，文件在磁盘上变化时会自动重新加载，无需重启服务器
+// WithTLSCertFiles enables HTTPS with the certificate and private key files, the files are reloaded automatically when they change on disk without restarting the server
+func WithTLSCertFiles(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.tlsOpts().certFile, o.tlsOpts().keyFile = certFile, keyFile
+	}
+}
+
+// WithTLSCertificate 使用内存中的证书开启 HTTPS，可以多次使用以提供多个证书
+// WithTLSCertificate enables HTTPS with an in-memory certificate, it can be used several times to provide several certificates
+func WithTLSCertificate(cert tls.Certificate) Option {
+	return func(o *options) {
+		o.tlsOpts().certificates = append(o.tlsOpts().certificates, cert)
+	}
+}
+
+// WithTLSMinVersion 设置允许的最低 TLS 版本，默认是 TLS 1.2
+// WithTLSMinVersion sets the minimum TLS version allowed, the default is TLS 1.2
+func WithTLSMinVersion(version uint16) Option {
+	return func(o *options) {
+		o.tlsOpts().minVersion = version
+	}
+}
+
+// WithTLSCipherSuites 设置 TLS 1.2 及以下版本允许的加密套件，TLS 1.3 的加密套件不可配置
+// WithTLSCipherSuites sets the cipher suites allowed for TLS 1.2 and below, the cipher suites of TLS 1.3 are not configurable
+func WithTLSCipherSuites(suites ...uint16) Option {
+	return func(o *options) {
+		o.tlsOpts().cipherSuites = suites
+	}
+}
+
+// WithTLSReloadInterval 设置检查证书文件变化的间隔，默认是 10 秒
+// WithTLSReloadInterval sets the interval for checking changes of the certificate files, the default is 10 seconds
+func WithTLSReloadInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.tlsOpts().reloadInterval = interval
+	}
+}
+
+// WithClientCAFile 添加验证客户端证书的 CA 文件以开启双向 TLS，未设置验证策略时要求并验证客户端证书
+// WithClientCAFile adds a CA file used to verify client certificates to enable mutual TLS, client certificates are required and verified when no verification policy is set
+func WithClientCAFile(caFile string) Option {
+	return func(o *options) {
+		o.tlsOpts().clientCAFiles = append(o.tlsOpts().clientCAFiles, caFile)
+	}
+}
+
+// WithClientCAPool 设置验证客户端证书的 CA 池以开启双向 TLS，未设置验证策略时要求并验证客户端证书
+// WithClientCAPool sets the CA pool used to verify client certificates to enable mutual TLS, client certificates are required and verified when no verification policy is set
+func WithClientCAPool(pool *x509.CertPool) Option {
+	return func(o *options) {
+		o.tlsOpts().clientCAs = pool
+	}
+}
+
+// WithClientAuth 设置客户端证书的验证策略
+// WithClientAuth sets the verification policy of client certificates
+func WithClientAuth(auth tls.ClientAuthType) Option {
+	return func(o *options) {
+		o.tlsOpts().clientAuth = auth
+		o.tlsOpts().clientAuthSet = true
+	}
+}
+
+// validate 检查 TLS 配置是否有效
+// validate checks whether the TLS configuration is valid
+func (t *tlsOptions) validate() error {
+	// 必须提供证书文件或内存证书之一
+	// Either the certificate files or in-memory certificates must be provided
+	hasFiles := t.certFile != "" || t.keyFile != ""
+	switch {
+	case !hasFiles && len(t.certificates) == 0:
+		return fmt.Errorf("%w: TLS requires a certificate", ErrInvalidOption)
+	case hasFiles && len(t.certificates) > 0:
+		return fmt.Errorf("%w: certificate files and in-memory certificates cannot be used together", ErrInvalidOption)
+	case hasFiles && (t.certFile == "" || t.keyFile == ""):
+		return fmt.Errorf("%w: both the certificate file and the key file are required", ErrInvalidOption)
+	}
+
+	// 检查 TLS 版本
+	// Check the TLS version
+	if t.minVersion < tls.VersionTLS10 || t.minVersion > tls.VersionTLS13 {
+		return fmt.Errorf("%w: unsupported TLS version 0x%04x", ErrInvalidOption, t.minVersion)
+	}
+	if t.minVersion == tls.VersionTLS13 && len(t.cipherSuites) > 0 {
+		return fmt.Errorf("%w: cipher suites are not configurable with TLS 1.3 as minimum version", ErrInvalidOption)
+	}
+
+	// 检查证书文件变化的间隔
+	// Check the interval for checking changes of the certificate files
+	if t.reloadInterval <= 0 {
+		return fmt.Errorf("%w: TLS reload interval must be positive", ErrInvalidOption)
+	}
+
+	// 要求验证客户端证书时必须提供 CA
+	// A CA must be provided when client certificates are verified
+	hasCA := t.clientCAs != nil || len(t.clientCAFiles) > 0
+	if !hasCA && (t.clientAuth == tls.VerifyClientCertIfGiven || t.clientAuth == tls.RequireAndVerifyClientCert) {
+		return fmt.Errorf("%w: client certificate verification requires a client CA", ErrInvalidOption)
+	}
+
+	return nil
+}
+
+// buildTLSConfig 根据 TLS 配置创建 tls.Config，证书文件会立即加载以尽早报告错误
+// buildTLSConfig creates a tls.Config from the TLS configuration, the certificate files are loaded immediately to report errors early
+func buildTLSConfig(t *tlsOptions, logger LeveledLogger) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:   t.minVersion,
+		CipherSuites: t.cipherSuites,
+		Certificates: t.certificates,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	// 加载证书文件，并在文件变化时自动重新加载
+	// Load the certificate files and reload them automatically when they change
+	if t.certFile != "" {
+		reloader, err := newCertReloader(t.certFile, t.keyFile, t.reloadInterval, logger)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+	}
+
+	// 加载验证客户端证书的 CA
+	// Load the CA used to verify client certificates
+	pool := t.clientCAs
+	for _, file := range t.clientCAFiles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client CA file %q", file)
+		}
+	}
+
+	// 设置客户端证书的验证策略
+	// Set the verification policy of client certificates
+	if pool != nil {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if t.clientAuthSet {
+		config.ClientAuth = t.clientAuth
+	}
+
+	return config, nil
+}
+
+// certReloader 在证书文件变化时重新加载证书，检查最多每个间隔进行一次，并在 TLS 握手时触发
+// certReloader reloads the certificate when the certificate files change, the check is done at most once per interval and triggered by TLS handshakes
+type certReloader struct {
+	// certFile 是证书文件的路径
+	// certFile is the path of the certificate file
+	certFile string
+
+	// keyFile 是私钥文件的路径
+	// keyFile is the path of the private key file
+	keyFile string
+
+	// interval 是检查证书文件变化的间隔
+	// interval is the interval for checking changes of the certificate files
+	interval time.Duration
+
+	// log 是记录重新加载错误的日志记录器
+	// log is the logger recording reload errors
+	log LeveledLogger
+
+	// mu 保护下面的字段
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// cert 是当前的证书
+	// cert is the current certificate
+	cert *tls.Certificate
+
+	// stamp 是当前证书对应的文件修改时间和大小
+	// stamp is the modification time and size of the files of the current certificate
+	stamp string
+
+	// checked 是最近一次检查文件变化的时间
+	// checked is the time of the last check for changes of the files
+	checked time.Time
+}
+
+// newCertReloader 创建一个新的证书重新加载器并立即加载证书
+// newCertReloader creates a new certificate reloader and loads the certificate immediately
+func newCertReloader(certFile, keyFile string, interval time.Duration, logger LeveledLogger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval, log: logger}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate 返回当前的证书，必要时先检查文件是否变化，重新加载失败时继续使用旧的证书
+// GetCertificate returns the current certificate, checking whether the files changed first when necessary, the old certificate is kept if the reload fails
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 到达检查间隔时检查文件是否变化
+	// Check whether the files changed when the check interval is reached
+	if time.Since(r.checked) >= r.interval {
+		if err := r.reload(); err != nil {
+			r.log.Error("tls certificate reload failed", "cert", r.certFile, "error", err)
+		}
+	}
+
+	return r.cert, nil
+}
+
+// reload 在文件变化时重新加载证书，调用者必须持有锁或者独占 r
+// reload reloads the certificate when the files change, the caller must hold the lock or own r exclusively
+func (r *certReloader) reload() error {
+	r.checked = time.Now()
+
+	// 计算文件的修改时间和大小
+	// Compute the modification time and size of the files
+	stamp, err := fileStamp(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if stamp == r.stamp {
+		return nil
+	}
+
+	// 加载新的证书，失败时也记录标记，避免在文件再次变化前重复报告同一个错误
+	// Load the new certificate, the stamp is recorded on failure as well to avoid reporting the same error again before the files change again
+	r.stamp = stamp
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+
+	return nil
+}
+
+// fileStamp 返回文件的修改时间和大小组成的标记
+// fileStamp returns a stamp made of the modification time and size of the files
+func fileStamp(files ...string) (string, error) {
+	stamp := ""
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
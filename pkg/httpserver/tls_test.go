@@ -0,0 +1,238 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCert is a generated certificate with its key
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert generates a certificate signed by parent, a self-signed CA is generated when parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeFiles writes the certificate and key into the directory and returns their paths
+func (c *testCert) writeFiles(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, c.certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0o600))
+	return certFile, keyFile
+}
+
+// tlsPair returns the certificate as a tls.Certificate
+func (c *testCert) tlsPair(t *testing.T) tls.Certificate {
+	t.Helper()
+	pair, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	assert.NoError(t, err)
+	return pair
+}
+
+// httpsClient returns a client trusting the CA and presenting the client certificates
+func httpsClient(ca *testCert, clientCerts ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: clientCerts},
+		DisableKeepAlives: true,
+	}}
+}
+
+// getWith sends a GET request with the client and returns the body
+func getWith(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestTinyHttpServer_TLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", ca)
+
+	// Start a HTTPS server with an in-memory certificate
+	srv, err := NewWithOptions(
+		WithAddress("127.0.0.1:0"),
+		WithTLSCertificate(server.tlsPair(t)),
+		WithTLSMinVersion(tls.VersionTLS12),
+		WithTLSCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+
+	// HTTPS is served
+	body, err := getWith(httpsClient(ca), fmt.Sprintf("https://%s/ping", srv.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, "ok!!", body)
+
+	// HTTP is rejected
+	code, _ := get(t, fmt.Sprintf("http://%s/ping", srv.Addr()))
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestTinyHttpServer_MutualTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", ca)
+	client := newTestCert(t, "client", ca)
+	stranger := newTestCert(t, "stranger", newTestCert(t, "other ca", nil))
+
+	// Write the files of the server
+	dir := t.TempDir()
+	certFile, keyFile := server.writeFiles(t, dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, ca.certPEM, 0o600))
+
+	// Start a HTTPS server requiring client certificates
+	srv, err := NewWithOptions(
+		WithAddress("127.0.0.1:0"),
+		WithTLSCertFiles(certFile, keyFile),
+		WithClientCAFile(caFile),
+	)
+	assert.NoError(t, err)
+	srv.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	})
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+	url := fmt.Sprintf("https://%s/whoami", srv.Addr())
+
+	// A client with a trusted certificate is accepted
+	body, err := getWith(httpsClient(ca, client.tlsPair(t)), url)
+	assert.NoError(t, err)
+	assert.Equal(t, "client", body)
+
+	// Clients without a certificate or with an untrusted certificate are rejected
+	_, err = getWith(httpsClient(ca), url)
+	assert.Error(t, err)
+	_, err = getWith(httpsClient(ca, stranger.tlsPair(t)), url)
+	assert.Error(t, err)
+}
+
+func TestTinyHttpServer_TLSReload(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	first := newTestCert(t, "first", ca)
+	second := newTestCert(t, "second", ca)
+
+	// Start a HTTPS server with certificate files
+	dir := t.TempDir()
+	certFile, keyFile := first.writeFiles(t, dir)
+	srv, err := NewWithOptions(
+		WithAddress("127.0.0.1:0"),
+		WithTLSCertFiles(certFile, keyFile),
+		WithTLSReloadInterval(10*time.Millisecond),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	defer srv.Stop()
+
+	// peer returns the common name of the certificate served
+	peer := func() string {
+		conn, err := tls.Dial("tcp", srv.Addr().String(), httpsClient(ca).Transport.(*http.Transport).TLSClientConfig)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "first", peer())
+
+	// Replace the certificate files, the new certificate is served without restarting
+	second.writeFiles(t, dir)
+	future := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "second", peer())
+
+	// A broken certificate file keeps the old certificate
+	assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "second", peer())
+}
+
+func TestNewWithOptions_InvalidTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	pair := ca.tlsPair(t)
+	tests := map[string][]Option{
+		"no certificate":    {WithTLSMinVersion(tls.VersionTLS13)},
+		"files and memory":  {WithTLSCertFiles("cert.pem", "key.pem"), WithTLSCertificate(pair)},
+		"missing key file":  {WithTLSCertFiles("cert.pem", "")},
+		"bad version":       {WithTLSCertificate(pair), WithTLSMinVersion(0x0200)},
+		"tls13 ciphers":     {WithTLSCertificate(pair), WithTLSMinVersion(tls.VersionTLS13), WithTLSCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)},
+		"reload interval":   {WithTLSCertificate(pair), WithTLSReloadInterval(0)},
+		"verify without ca": {WithTLSCertificate(pair), WithClientAuth(tls.RequireAndVerifyClientCert)},
+		"ca without cert":   {WithClientCAPool(x509.NewCertPool())},
+	}
+	for name, opts := range tests {
+		srv, err := NewWithOptions(opts...)
+		assert.ErrorIs(t, err, ErrInvalidOption, name)
+		assert.Nil(t, srv, name)
+	}
+
+	// Missing certificate files are reported when the server is created
+	srv, err := NewWithOptions(WithTLSCertFiles(filepath.Join(t.TempDir(), "cert.pem"), "key.pem"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidOption)
+	assert.Nil(t, srv)
+}